@@ -36,7 +36,8 @@ var commands = []Command{
 	{`testCodeGen`, testCodeGen},
 
 	{`lint`, runLinters},
-	{`verify`, func() { testLib(); testCodeGen(); runLinters() }},
+	{`vet`, vetBuildModes},
+	{`verify`, func() { testLib(); testCodeGen(); vetBuildModes(); runLinters() }},
 
 	{`generateTestAllocator`, generateTestAllocator},
 	{`clean`, clean},
@@ -93,12 +94,20 @@ func generateTestAllocator() {
 		`-type`, `StablePointsVector`,
 		`-dir`, `./generator/internal/testdata/etalon/`,
 	)
+	b.Run(Go, `run`, `./generator/main.go`,
+		`-type`, `StablePointsVector`,
+		`-map-key`, `Point`,
+		`-dir`, `./generator/internal/testdata/etalon/`,
+	)
 }
 
 func testLib() {
 	defer b.AddTarget("🧪 test library code")()
 	defer forceClean()
 	b.Run(Go, `test`, `-parallel`, parallelism, arenaModule+`/...`)
+	if runtime.GOOS == "linux" {
+		b.Run(Go, `test`, `-tags`, `arenadebug`, `-parallel`, parallelism, arenaModule+`/...`)
+	}
 	generateTestAllocator()
 	defer b.AddTarget("🎯 test generated code")()
 	b.Run(Go, `test`, `-parallel`, parallelism, generatorModule+`/internal/testdata/testdata_test`)
@@ -143,6 +152,15 @@ func cleanExecutables() {
 	b.Run(`rm`, `-rf`, binDirName)
 }
 
+func vetBuildModes() {
+	defer b.AddTarget("🩺 vet checked and debug build modes")()
+	// default build mode is covered by govet linter
+	b.Run(Go, `vet`, `-tags`, `arenachecked`, arenaModule+`/...`, generatorModule+`/...`)
+	if runtime.GOOS == "linux" {
+		b.Run(Go, `vet`, `-tags`, `arenadebug`, arenaModule+`/...`, generatorModule+`/...`)
+	}
+}
+
 func runLinters() {
 	defer b.AddTarget("🕵️  run linters")()
 	ciLinterExec, downloadErr := downloadCILinter()
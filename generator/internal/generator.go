@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
+	"go/build"
 	"go/format"
 	"go/importer"
 	"go/parser"
@@ -24,20 +25,78 @@ type allocatorDefinition struct {
 	Exported                     bool
 }
 
+type mapDefinition struct {
+	DirName                         string
+	PkgName                         string
+	KeyTypeName                     string
+	ValueTypeName                   string
+	MapTypeName                     string
+	MapTypeNameWithUpperFirstLetter string
+	Exported                        bool
+}
+
 type Generator struct {
-	template *template.Template
+	template    *template.Template
+	mapTemplate *template.Template
 }
 
 func NewGenerator() *Generator {
-	return &Generator{template: template.Must(template.New("embedded").Parse(embeddedTemplate))}
+	return &Generator{
+		template:    template.Must(template.New("embedded").Parse(embeddedTemplate)),
+		mapTemplate: template.Must(template.New("embeddedMap").Parse(embeddedMapTemplate)),
+	}
 }
 
 // RunGeneratorForTypes generates code for targetTypes into dirName
 func (g *Generator) RunGeneratorForTypes(dirName string, targetTypes []string) error {
+	fset, typeCheckedPkg, loadErr := g.loadPackage(dirName)
+	if loadErr != nil {
+		return loadErr
+	}
+	for _, t := range targetTypes {
+		obj := typeCheckedPkg.Scope().Lookup(t)
+		if obj == nil {
+			continue
+		}
+		generationErr := g.generateAllocators(fset, obj, t)
+		if generationErr != nil {
+			return fmt.Errorf("can't generate allocator for type: %v: \n%v", obj.Type(), generationErr)
+		}
+	}
+	return nil
+}
+
+// RunMapGeneratorForTypes generates arena maps with keyType keys for every type of valueTypes into dirName
+func (g *Generator) RunMapGeneratorForTypes(dirName string, keyType string, valueTypes []string) error {
+	fset, typeCheckedPkg, loadErr := g.loadPackage(dirName)
+	if loadErr != nil {
+		return loadErr
+	}
+	keyObj := typeCheckedPkg.Scope().Lookup(keyType)
+	if keyObj == nil {
+		return fmt.Errorf("can't find map key type: %v", keyType)
+	}
+	for _, t := range valueTypes {
+		valueObj := typeCheckedPkg.Scope().Lookup(t)
+		if valueObj == nil {
+			continue
+		}
+		generationErr := g.generateMap(fset, keyObj, valueObj)
+		if generationErr != nil {
+			return fmt.Errorf(
+				"can't generate map for key type: %v and value type: %v: \n%v",
+				keyObj.Type(), valueObj.Type(), generationErr,
+			)
+		}
+	}
+	return nil
+}
+
+func (g *Generator) loadPackage(dirName string) (*token.FileSet, *types.Package, error) {
 	fset := token.NewFileSet()
 	pkgs, err := parser.ParseDir(fset, dirName, nil, parser.SpuriousErrors)
 	if err != nil {
-		return fmt.Errorf("can't parse destination dir: %v", err)
+		return nil, nil, fmt.Errorf("can't parse destination dir: %v", err)
 	}
 	var filesToCheck []*ast.File
 	for _, pkg := range pkgs {
@@ -51,22 +110,53 @@ func (g *Generator) RunGeneratorForTypes(dirName string, targetTypes []string) e
 	conf := &types.Config{IgnoreFuncBodies: true, Importer: importer.ForCompiler(fset, "source", nil)}
 	typeCheckedPkg, checkErr := conf.Check(dirName, fset, filesToCheck, nil)
 	if checkErr != nil {
-		return fmt.Errorf("can't check types: %v", checkErr)
-	}
-	for _, t := range targetTypes {
-		obj := typeCheckedPkg.Scope().Lookup(t)
-		if obj == nil {
-			continue
-		}
-		generationErr := g.generateAllocators(fset, obj, t)
-		if generationErr != nil {
-			return fmt.Errorf("can't generate allocator for type: %v: \n%v", obj.Type(), generationErr)
-		}
+		return nil, nil, fmt.Errorf("can't check types: %v", checkErr)
 	}
-	return nil
+	return fset, typeCheckedPkg, nil
 }
 
 func (g *Generator) generateAllocators(fset *token.FileSet, obj types.Object, typeName string) error {
+	checkErr := g.checkTargetObj(fset, obj)
+	if checkErr != nil {
+		return checkErr
+	}
+	definition := allocatorDefinition{
+		DirName:                      obj.Pkg().Path(),
+		PkgName:                      obj.Pkg().Name(),
+		TargetTypeName:               typeName,
+		TypeNameWithUpperFirstLetter: withUpperFirstLetter(typeName),
+		Exported:                     obj.Exported(),
+	}
+	return g.generateFromTemplateAndWriteToFile(g.template, definition, definition.DirName, definition.TargetTypeName)
+}
+
+func (g *Generator) generateMap(fset *token.FileSet, keyObj types.Object, valueObj types.Object) error {
+	keyCheckErr := g.checkTargetObj(fset, keyObj)
+	if keyCheckErr != nil {
+		return keyCheckErr
+	}
+	keyBytesCheckErr := g.checkMapKeyObj(fset, keyObj)
+	if keyBytesCheckErr != nil {
+		return keyBytesCheckErr
+	}
+	valueCheckErr := g.checkTargetObj(fset, valueObj)
+	if valueCheckErr != nil {
+		return valueCheckErr
+	}
+	mapTypeName := keyObj.Name() + withUpperFirstLetter(valueObj.Name()) + "Map"
+	definition := mapDefinition{
+		DirName:                         valueObj.Pkg().Path(),
+		PkgName:                         valueObj.Pkg().Name(),
+		KeyTypeName:                     keyObj.Name(),
+		ValueTypeName:                   valueObj.Name(),
+		MapTypeName:                     mapTypeName,
+		MapTypeNameWithUpperFirstLetter: withUpperFirstLetter(mapTypeName),
+		Exported:                        keyObj.Exported(),
+	}
+	return g.generateFromTemplateAndWriteToFile(g.mapTemplate, definition, definition.DirName, definition.MapTypeName)
+}
+
+func (g *Generator) checkTargetObj(fset *token.FileSet, obj types.Object) error {
 	checkPos, checkErr := g.checkObjForInternalPointers(obj, 0)
 	if checkErr != nil {
 		return fmt.Errorf(
@@ -74,23 +164,62 @@ func (g *Generator) generateAllocators(fset *token.FileSet, obj types.Object, ty
 			obj.Type(), fset.Position(obj.Pos()), fset.Position(checkPos), checkErr,
 		)
 	}
-	typeNameRunes := bytes.Runes([]byte(typeName))
-	typeNameRunes[0] = unicode.ToUpper(typeNameRunes[0])
-	typeNameWithUpperFirstLetter := string(typeNameRunes)
+	return nil
+}
 
-	definition := allocatorDefinition{
-		DirName:                      obj.Pkg().Path(),
-		PkgName:                      obj.Pkg().Name(),
-		TargetTypeName:               typeName,
-		TypeNameWithUpperFirstLetter: typeNameWithUpperFirstLetter,
-		Exported:                     obj.Exported(),
+// checkMapKeyObj checks that key can be hashed and compared as raw bytes,
+// so it can't have padding bytes with undefined content or floats, where +0 == -0 and NaN != NaN.
+func (g *Generator) checkMapKeyObj(fset *token.FileSet, obj types.Object) error {
+	checkErr := g.checkTypeForRawBytesComparison(obj.Type(), types.SizesFor("gc", build.Default.GOARCH))
+	if checkErr != nil {
+		return fmt.Errorf(
+			"map key '%v' can't be compared as raw bytes: %v\n%v",
+			obj.Type(), fset.Position(obj.Pos()), checkErr,
+		)
+	}
+	return nil
+}
+
+func (g *Generator) checkTypeForRawBytesComparison(t types.Type, sizes types.Sizes) error {
+	switch underlying := t.Underlying().(type) {
+	case *types.Basic:
+		if underlying.Info()&(types.IsFloat|types.IsComplex) != 0 {
+			return fmt.Errorf("float based type: '%v'", t)
+		}
+		return nil
+	case *types.Array:
+		return g.checkTypeForRawBytesComparison(underlying.Elem(), sizes)
+	case *types.Struct:
+		fields := make([]*types.Var, underlying.NumFields())
+		for i := range fields {
+			fields[i] = underlying.Field(i)
+		}
+		offsets := sizes.Offsetsof(fields)
+		expectedOffset := int64(0)
+		for i, field := range fields {
+			if offsets[i] != expectedOffset {
+				return fmt.Errorf("padding before field '%v' of type '%v'", field.Name(), t)
+			}
+			fieldErr := g.checkTypeForRawBytesComparison(field.Type(), sizes)
+			if fieldErr != nil {
+				return fmt.Errorf("field '%v' of type '%v': %v", field.Name(), t, fieldErr)
+			}
+			expectedOffset += sizes.Sizeof(field.Type())
+		}
+		if expectedOffset != sizes.Sizeof(t) {
+			return fmt.Errorf("trailing padding of type '%v'", t)
+		}
+		return nil
+	default:
+		return nil
 	}
-	return g.generateFromTemplateAndWriteToFile(definition)
 }
 
-func (g *Generator) generateFromTemplateAndWriteToFile(definition allocatorDefinition) error {
+func (g *Generator) generateFromTemplateAndWriteToFile(
+	t *template.Template, definition interface{}, dirName string, outputTypeName string,
+) error {
 	var b bytes.Buffer
-	templateErr := g.template.Execute(&b, definition)
+	templateErr := t.Execute(&b, definition)
 	if templateErr != nil {
 		return fmt.Errorf("can't render embedded template: %v", templateErr)
 	}
@@ -98,10 +227,10 @@ func (g *Generator) generateFromTemplateAndWriteToFile(definition allocatorDefin
 	if formatErr != nil {
 		return fmt.Errorf("can't format generated template: %v", formatErr)
 	}
-	output := strings.ToLower(definition.TargetTypeName + ".alloc.go")
-	absPath, pathErr := filepath.Abs(definition.DirName)
+	output := strings.ToLower(outputTypeName + ".alloc.go")
+	absPath, pathErr := filepath.Abs(dirName)
 	if pathErr != nil {
-		return fmt.Errorf("can't calculate abs path for %v: %v", definition.DirName, pathErr)
+		return fmt.Errorf("can't calculate abs path for %v: %v", dirName, pathErr)
 	}
 	outputPath := filepath.Join(absPath, output)
 	writeErr := ioutil.WriteFile(outputPath, src, 0664)
@@ -163,3 +292,9 @@ func (g *Generator) checkTypeForInternalPointers(t types.Type, pos token.Pos, de
 	}
 	return pos, fmt.Errorf("pointer based type: '%v'", t)
 }
+
+func withUpperFirstLetter(typeName string) string {
+	typeNameRunes := bytes.Runes([]byte(typeName))
+	typeNameRunes[0] = unicode.ToUpper(typeNameRunes[0])
+	return string(typeNameRunes)
+}
@@ -38,6 +38,34 @@ func TestGeneratorForStablePointsVector(t *testing.T) {
 	compareOutputFiles(t, "StablePointsVector")
 }
 
+func TestGeneratorForCoordinatePointMap(t *testing.T) {
+	t.Parallel()
+	failOnError(t, NewGenerator().RunMapGeneratorForTypes("./testdata/etalon/", "coordinate", []string{"Point"}))
+	compareOutputFiles(t, "coordinatePointMap")
+}
+
+func TestGeneratorForInvalidMapKey(t *testing.T) {
+	t.Parallel()
+	expectErr(t, NewGenerator().RunMapGeneratorForTypes("./testdata/etalon/", "coordinates", []string{"Point"}))
+}
+
+func TestGeneratorForInvalidMapValue(t *testing.T) {
+	t.Parallel()
+	expectErr(t, NewGenerator().RunMapGeneratorForTypes("./testdata/etalon/", "coordinate", []string{"CircleWithPointer"}))
+}
+
+func TestGeneratorForMapKeysThatCantBeComparedAsBytes(t *testing.T) {
+	t.Parallel()
+	for _, keyType := range []string{"paddedKey", "trailingPaddedKey", "floatKey"} {
+		expectErr(t, NewGenerator().RunMapGeneratorForTypes("./testdata/etalon/", keyType, []string{"Point"}))
+	}
+}
+
+func TestGeneratorForUnknownMapKey(t *testing.T) {
+	t.Parallel()
+	expectErr(t, NewGenerator().RunMapGeneratorForTypes("./testdata/etalon/", "unknown", []string{"Point"}))
+}
+
 func TestGeneratorForInvalidCirclePtr(t *testing.T) {
 	t.Parallel()
 	expectErr(t, NewGenerator().RunGeneratorForTypes("./testdata/etalon/", []string{"CircleWithPointer"}))
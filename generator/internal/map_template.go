@@ -0,0 +1,95 @@
+package generator
+
+const embeddedMapTemplate = `
+package {{.PkgName}}
+{{$mName := .MapTypeName}}
+{{$kName := .KeyTypeName}}
+{{$vName := .ValueTypeName}}
+
+import (
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type internal{{.MapTypeNameWithUpperFirstLetter}}Allocator interface {
+	Alloc(size uintptr, alignment uintptr) (arena.Ptr, error)
+	ToRef(p arena.Ptr) unsafe.Pointer
+}
+
+// {{$mName}} is an analog to map[{{$kName}}]{{$vName}},
+// but it stores all its buckets, keys and values inside one of the arenas.
+//
+// {{$mName}} is built on top of arena.Map, so it grows one bucket at a time
+// and the GC doesn't scan its content.
+// Keys are compared by their memory representation, and values are copied
+// in and out of the target allocator.
+//
+// As with arena.Ptr, if you call Clear on the target allocator, the map becomes invalid
+// and any subsequent call to its methods panics.
+type {{$mName}} struct {
+	m *arena.Map
+}
+
+{{ if .Exported}}
+// New{{.MapTypeNameWithUpperFirstLetter}} creates {{$mName}} on top of target allocator
+func New{{.MapTypeNameWithUpperFirstLetter}}(alloc internal{{.MapTypeNameWithUpperFirstLetter}}Allocator) (*{{$mName}}, error) {
+{{- else}}
+// new{{.MapTypeNameWithUpperFirstLetter}} creates {{$mName}} on top of target allocator
+func new{{.MapTypeNameWithUpperFirstLetter}}(alloc internal{{.MapTypeNameWithUpperFirstLetter}}Allocator) (*{{$mName}}, error) {
+{{- end}}
+	if alloc == nil {
+		alloc = &arena.GenericAllocator{}
+	}
+	m, allocErr := arena.NewMap(alloc)
+	if allocErr != nil {
+		return nil, allocErr
+	}
+	return &{{$mName}}{m: m}, nil
+}
+
+// Len is direct analog to len(map[{{$kName}}]{{$vName}})
+func (s *{{$mName}}) Len() int {
+	return s.m.Len()
+}
+
+// Get is an analog to v, ok := map[{{$kName}}]{{$vName}}[key]
+// Returns a copy of the value stored inside the target allocator.
+func (s *{{$mName}}) Get(key {{$kName}}) ({{$vName}}, bool) {
+	var value {{$vName}}
+	valueBytes, found := s.m.Get((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:])
+	if !found {
+		return value, false
+	}
+	copy((*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:], valueBytes)
+	return value, true
+}
+
+// Put is an analog to map[{{$kName}}]{{$vName}}[key] = value
+// It copies the key and the value inside the target allocator.
+func (s *{{$mName}}) Put(key {{$kName}}, value {{$vName}}) error {
+	return s.m.Put(
+		(*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:],
+		(*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:],
+	)
+}
+
+// Delete is an analog to delete(map[{{$kName}}]{{$vName}}, key)
+// Reports whether the key was present.
+func (s *{{$mName}}) Delete(key {{$kName}}) bool {
+	return s.m.Delete((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:])
+}
+
+// Range is an analog to for k, v := range map[{{$kName}}]{{$vName}}
+// If f returns false, range stops the iteration.
+// The map shouldn't be modified during the iteration.
+func (s *{{$mName}}) Range(f func(key {{$kName}}, value {{$vName}}) bool) {
+	s.m.Range(func(keyBytes []byte, valueBytes []byte) bool {
+		var key {{$kName}}
+		var value {{$vName}}
+		copy((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:], keyBytes)
+		copy((*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:], valueBytes)
+		return f(key, value)
+	})
+}
+`
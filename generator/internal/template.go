@@ -17,6 +17,26 @@ type internal{{.TypeNameWithUpperFirstLetter}}Allocator interface {
 	Metrics() arena.Metrics
 }
 
+type internal{{.TypeNameWithUpperFirstLetter}}FreeingAllocator interface {
+	Free(p arena.Ptr)
+}
+
+type internal{{.TypeNameWithUpperFirstLetter}}SizedFreeingAllocator interface {
+	Free(p arena.Ptr, size uintptr)
+}
+
+type internal{{.TypeNameWithUpperFirstLetter}}CheckedFreeingAllocator interface {
+	Free(p arena.Ptr, size uintptr) error
+}
+
+type internal{{.TypeNameWithUpperFirstLetter}}Reallocator interface {
+	Realloc(p arena.Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (arena.Ptr, error)
+}
+
+type internal{{.TypeNameWithUpperFirstLetter}}UninitializedAllocator interface {
+	AllocNoZero(size uintptr, alignment uintptr) (arena.Ptr, error)
+}
+
 // {{$ttName}}Ptr, which basically represents an offset of the allocated value {{$ttName}}
 // inside one of the arenas.
 //
@@ -37,6 +57,12 @@ type {{$ttName}}Ptr struct {
 	ptr arena.Ptr
 }
 
+// Translate maps {{$ttName}}Ptr allocated before compaction of the allocator
+// to the new location of the same value, by using the translator returned by the Compact method of the allocator.
+func (s {{$ttName}}Ptr) Translate(translate arena.PtrTranslator) {{$ttName}}Ptr {
+	return {{$ttName}}Ptr{ptr: translate(s.ptr)}
+}
+
 // {{$ttName}}Buffer is an analog to []{{$ttName}}, 
 // but it represents a slice allocated inside one of the arenas.
 // {{$ttName}}Buffer is a simple struct that should be passed by value and
@@ -77,19 +103,14 @@ func (s {{$ttName}}Buffer) SubSlice(low int, high int) {{$ttName}}Buffer {
 	}
 	var tVar {{$ttName}}
 	tSize := unsafe.Sizeof(tVar)
+	// only the offset is changed, so the rest of arena.Ptr, which depends on the build mode, is kept as is
 	type internalPtr struct{
-		offset    uintptr
-		bucketIdx uint8
-		arenaMask uint16
-	}
-	currentPtr := *(*internalPtr)(unsafe.Pointer(&s.data))
-	newPtr := internalPtr{
-			offset:    currentPtr.offset + uintptr(low*int(tSize)),
-			bucketIdx: currentPtr.bucketIdx,
-			arenaMask: currentPtr.arenaMask,
+		offset uintptr
 	}
+	newPtr := s.data
+	(*internalPtr)(unsafe.Pointer(&newPtr)).offset += uintptr(low*int(tSize))
 	return {{$ttName}}Buffer{
-		data: *(*arena.Ptr)(unsafe.Pointer(&newPtr)),
+		data: newPtr,
 		len: high - low,
 		cap: s.cap - low,
 	}
@@ -107,22 +128,24 @@ func (s {{$ttName}}Buffer) Get(idx int) {{$ttName}}Ptr {
 	}
 	var tVar {{$ttName}}
 	tSize := unsafe.Sizeof(tVar)
+	// only the offset is changed, so the rest of arena.Ptr, which depends on the build mode, is kept as is
 	type internalPtr struct{
-		offset    uintptr
-		bucketIdx uint8
-		arenaMask uint16
-	}
-	currentPtr := *(*internalPtr)(unsafe.Pointer(&s.data))
-	newPtr := internalPtr{
-			offset:    currentPtr.offset + uintptr(idx*int(tSize)),
-			bucketIdx: currentPtr.bucketIdx,
-			arenaMask: currentPtr.arenaMask,
+		offset uintptr
 	}
+	newPtr := s.data
+	(*internalPtr)(unsafe.Pointer(&newPtr)).offset += uintptr(idx*int(tSize))
 	return {{$ttName}}Ptr{
-		ptr: *(*arena.Ptr)(unsafe.Pointer(&newPtr)),
+		ptr: newPtr,
 	}
 }
 
+// Translate maps {{$ttName}}Buffer allocated before compaction of the allocator
+// to the new location of the same buffer, by using the translator returned by the Compact method of the allocator.
+func (s {{$ttName}}Buffer) Translate(translate arena.PtrTranslator) {{$ttName}}Buffer {
+	s.data = translate(s.data)
+	return s
+}
+
 // {{$ttName}}View is an allocation view that can be constructed on top of the target allocator
 // and then used to allocate {{$ttName}}, its slices and buffers inside target allocator.
 //
@@ -178,7 +201,8 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}PtrView) New() ({{$ttName}}Ptr
 // Embed copies passed value inside target allocator, and returns {{$ttName}}Ptr to it.
 // {{$ttName}}Ptr can be converted to *{{$ttName}} or dereferenced by using other methods of this view.
 func (s *internal{{.TypeNameWithUpperFirstLetter}}PtrView) Embed(value {{$ttName}}) ({{$ttName}}Ptr, error) {
-	slice, allocErr := s.state.makeSlice(1)
+	// the whole value is overwritten, so there is no need to zero it
+	slice, allocErr := s.state.makeUninitializedSlice(1)
 	if allocErr != nil {
 		return {{$ttName}}Ptr{}, allocErr
 	}
@@ -203,6 +227,17 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}PtrView) ToRef(allocPtr {{$ttN
 	return valuePtr
 }
 
+// Free returns memory of {{$ttName}} referenced by {{$ttName}}Ptr to the target allocator,
+// so it can be reused by subsequent allocations.
+// Only allocators that can free individual values, like arena.SlabAllocator or arena.SizeClassAllocator,
+// or arena.GenericAllocator on top of them, support it, for other allocators it returns arena.UnsupportedOperationError.
+//
+// Any usage of {{$ttName}}Ptr or *{{$ttName}} converted by ToRef after Free is a "use after free" error.
+func (s *internal{{.TypeNameWithUpperFirstLetter}}PtrView) Free(allocPtr {{$ttName}}Ptr) error {
+	var tVar {{$ttName}}
+	return s.state.free(allocPtr.ptr, unsafe.Sizeof(tVar))
+}
+
 type internal{{.TypeNameWithUpperFirstLetter}}SliceView struct {
 	state internal{{.TypeNameWithUpperFirstLetter}}State
 }
@@ -265,26 +300,22 @@ requiredLen int) (*internal{{.TypeNameWithUpperFirstLetter}}SliceHeader, error)
 		return sliceHdr, nil
 	}
 
+	minLen := sliceHdr.Cap + requiredLen
+	newLen := max{{.TypeNameWithUpperFirstLetter}}Len(minLen, 2*sliceHdr.Cap)
 	emptyPtr := arena.Ptr{}
+	// only the last allocated slice can be referenced by arena.Ptr to be reallocated
 	if s.state.lastAllocatedPtr != emptyPtr && sliceHdr.Data == uintptr(s.state.alloc.ToRef(s.state.lastAllocatedPtr)) {
-		nextPtr, probeAllocErr := s.state.alloc.Alloc(0, 1)
-		if probeAllocErr != nil {
-			return nil, probeAllocErr
+		newPtr, newCap, ok, reallocErr := s.state.realloc(s.state.lastAllocatedPtr, sliceHdr.Cap, minLen, newLen)
+		if reallocErr != nil {
+			return nil, reallocErr
 		}
-		// current allocation offset is the same as previous
-		// we can try to just enhance current buffer
-		nextPtrAddr := uintptr(s.state.alloc.ToRef(nextPtr))
-		nextAllocationIsRightAfterTargetSlice := nextPtrAddr == sliceHdr.Data+(uintptr(sliceHdr.Cap) * tSize)
-		if nextAllocationIsRightAfterTargetSlice && s.state.alloc.Metrics().AvailableBytes >= requiredSizeInBytes {
-			_, enhancingErr := s.state.alloc.Alloc(uintptr(requiredSizeInBytes), 1)
-			if enhancingErr != nil {
-				return nil, enhancingErr
-			}
-			sliceHdr.Cap += requiredLen
+		if ok {
+			sliceHdr.Data = uintptr(s.state.alloc.ToRef(newPtr))
+			sliceHdr.Cap = newCap
 			return sliceHdr, nil
 		}
 	}
-	newDstSlice, allocErr := s.makeGoSlice(2*(int(sliceHdr.Cap)+requiredLen))
+	newDstSlice, allocErr := s.makeGoSlice(newLen)
 	if allocErr != nil {
 		return nil, allocErr
 	}
@@ -385,6 +416,19 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}BufferView) ToRef(slice {{$ttN
 	return *(*[]{{$ttName}})(unsafe.Pointer(&sliceHdr))
 }
 
+// Free returns memory of {{$ttName}}Buffer to the target allocator,
+// so it can be reused by subsequent allocations.
+// Only allocators that can free values of any size, like arena.SizeClassAllocator or arena.BuddyAllocator,
+// support it, for other allocators it returns arena.UnsupportedOperationError.
+//
+// Please free only buffers returned by allocation and append methods of this view, but not their sub-slices.
+// If Append has to move the data, it frees the previous buffer for such allocators,
+// and any usage of {{$ttName}}Buffer or []{{$ttName}} converted by ToRef after Free is a "use after free" error.
+func (s *internal{{.TypeNameWithUpperFirstLetter}}BufferView) Free(slice {{$ttName}}Buffer) error {
+	var tVar {{$ttName}}
+	return s.state.free(slice.data, uintptr(slice.cap)*unsafe.Sizeof(tVar))
+}
+
 func (s *internal{{.TypeNameWithUpperFirstLetter}}BufferView) growIfNecessary(
 		slice {{$ttName}}Buffer,
 		requiredLen int,
@@ -404,30 +448,19 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}BufferView) grow(
 		slice {{$ttName}}Buffer,
 		requiredLen int,
 ) ({{$ttName}}Buffer, error) {
-	var tVar {{$ttName}}
-	tSize := unsafe.Sizeof(tVar)
-	requiredSizeInBytes := requiredLen * int(tSize)
-	emptyPtr := arena.Ptr{}
-	if s.state.lastAllocatedPtr != emptyPtr && slice.data == s.state.lastAllocatedPtr {
-		nextPtr, probeAllocErr := s.state.alloc.Alloc(0, 1)
-		if probeAllocErr != nil {
-			return {{$ttName}}Buffer{}, probeAllocErr
-		}
-		// current allocation offset is the same as previous
-		// we can try to just enhance current buffer
-		sliceDataAddr := uintptr(s.state.alloc.ToRef(slice.data))
-		nextPtrAddr := uintptr(s.state.alloc.ToRef(nextPtr))
-		nextAllocationIsRightAfterTargetSlice := nextPtrAddr == sliceDataAddr+(uintptr(slice.cap)*tSize)
-		if nextAllocationIsRightAfterTargetSlice && s.state.alloc.Metrics().AvailableBytes >= requiredSizeInBytes {
-			_, enhancingErr := s.state.alloc.Alloc(uintptr(requiredSizeInBytes), 1)
-			if enhancingErr != nil {
-				return {{$ttName}}Buffer{}, enhancingErr
-			}
-			slice.cap += requiredLen
-			return slice, nil
-		}
+	minLen := slice.cap + requiredLen
+	newLen := max{{.TypeNameWithUpperFirstLetter}}Len(minLen, 2*slice.cap)
+	newPtr, newCap, ok, reallocErr := s.state.realloc(slice.data, slice.cap, minLen, newLen)
+	if reallocErr != nil {
+		return {{$ttName}}Buffer{}, reallocErr
+	}
+	if ok {
+		slice.data = newPtr
+		slice.cap = newCap
+		return slice, nil
 	}
-	newDstSlice, allocErr := s.state.makeSlice(2 * (int(slice.cap) + requiredLen))
+	// allocators without Realloc can't extend the buffer in place
+	newDstSlice, allocErr := s.state.makeSlice(newLen)
 	if allocErr != nil {
 		return {{$ttName}}Buffer{}, allocErr
 	}
@@ -436,6 +469,10 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}BufferView) grow(
 		prev := s.ToRef(slice)
 		copy(dst, prev)
 	}
+	if slice.data != (arena.Ptr{}) {
+		var tVar {{$ttName}}
+		_ = s.state.free(slice.data, uintptr(slice.cap)*unsafe.Sizeof(tVar))
+	}
 	return newDstSlice, nil
 }
 
@@ -461,6 +498,73 @@ func (s *internal{{.TypeNameWithUpperFirstLetter}}State) makeSlice(len int) ({{$
 	return sliceHdr, nil
 }
 
+// makeUninitializedSlice allocates the slice without zeroing, if the allocator supports it,
+// so it can be used only if the whole slice is overwritten right away.
+func (s *internal{{.TypeNameWithUpperFirstLetter}}State) makeUninitializedSlice(len int) ({{$ttName}}Buffer, error) {
+	alloc, ok := s.alloc.(internal{{.TypeNameWithUpperFirstLetter}}UninitializedAllocator)
+	if !ok {
+		return s.makeSlice(len)
+	}
+	var tVar {{$ttName}}
+	tSize := unsafe.Sizeof(tVar)
+	tAlignment := unsafe.Alignof(tVar)
+	slicePtr, allocErr := alloc.AllocNoZero(uintptr(len)*tSize, tAlignment)
+	if allocErr != nil {
+		return {{$ttName}}Buffer{}, allocErr
+	}
+	s.lastAllocatedPtr = slicePtr
+	sliceHdr := {{$ttName}}Buffer{
+		data: slicePtr,
+		len:  len,
+		cap:  len,
+	}
+	return sliceHdr, nil
+}
+
+func (s *internal{{.TypeNameWithUpperFirstLetter}}State) free(ptr arena.Ptr, size uintptr) error {
+	switch alloc := s.alloc.(type) {
+	case internal{{.TypeNameWithUpperFirstLetter}}FreeingAllocator:
+		alloc.Free(ptr)
+		return nil
+	case internal{{.TypeNameWithUpperFirstLetter}}SizedFreeingAllocator:
+		alloc.Free(ptr, size)
+		return nil
+	case internal{{.TypeNameWithUpperFirstLetter}}CheckedFreeingAllocator:
+		return alloc.Free(ptr, size)
+	default:
+		return arena.UnsupportedOperationError
+	}
+}
+
+// realloc extends the slice in place or moves it, if the allocator supports it,
+// it tries newLen first and falls back to minLen if there is not enough memory for newLen.
+func (s *internal{{.TypeNameWithUpperFirstLetter}}State) realloc(ptr arena.Ptr, oldLen int, minLen int, newLen int) (arena.Ptr, int, bool, error) {
+	alloc, ok := s.alloc.(internal{{.TypeNameWithUpperFirstLetter}}Reallocator)
+	if !ok {
+		return arena.Ptr{}, 0, false, nil
+	}
+	var tVar {{$ttName}}
+	tSize := unsafe.Sizeof(tVar)
+	tAlignment := unsafe.Alignof(tVar)
+	newPtr, reallocErr := alloc.Realloc(ptr, uintptr(oldLen)*tSize, uintptr(newLen)*tSize, tAlignment)
+	if reallocErr == arena.AllocationLimitError && newLen > minLen {
+		newLen = minLen
+		newPtr, reallocErr = alloc.Realloc(ptr, uintptr(oldLen)*tSize, uintptr(newLen)*tSize, tAlignment)
+	}
+	if reallocErr != nil {
+		return arena.Ptr{}, 0, true, reallocErr
+	}
+	s.lastAllocatedPtr = newPtr
+	return newPtr, newLen, true, nil
+}
+
+func max{{.TypeNameWithUpperFirstLetter}}Len(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 type internal{{.TypeNameWithUpperFirstLetter}}SliceHeader struct {
 	Data uintptr
 	Len  int
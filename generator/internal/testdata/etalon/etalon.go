@@ -40,3 +40,18 @@ type EmbeddedCircleWithPointer struct {
 type FixedEmbeddedCircleWithPointerVector struct {
 	circles [3]EmbeddedCircleWithPointer
 }
+
+type paddedKey struct {
+	flag  bool
+	value int64
+}
+
+type trailingPaddedKey struct {
+	value int64
+	flag  bool
+}
+
+type floatKey struct {
+	Point
+	weight float64
+}
@@ -0,0 +1,83 @@
+package etalon
+
+import (
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type internalCoordinatePointMapAllocator interface {
+	Alloc(size uintptr, alignment uintptr) (arena.Ptr, error)
+	ToRef(p arena.Ptr) unsafe.Pointer
+}
+
+// coordinatePointMap is an analog to map[coordinate]Point,
+// but it stores all its buckets, keys and values inside one of the arenas.
+//
+// coordinatePointMap is built on top of arena.Map, so it grows one bucket at a time
+// and the GC doesn't scan its content.
+// Keys are compared by their memory representation, and values are copied
+// in and out of the target allocator.
+//
+// As with arena.Ptr, if you call Clear on the target allocator, the map becomes invalid
+// and any subsequent call to its methods panics.
+type coordinatePointMap struct {
+	m *arena.Map
+}
+
+// newCoordinatePointMap creates coordinatePointMap on top of target allocator
+func newCoordinatePointMap(alloc internalCoordinatePointMapAllocator) (*coordinatePointMap, error) {
+	if alloc == nil {
+		alloc = &arena.GenericAllocator{}
+	}
+	m, allocErr := arena.NewMap(alloc)
+	if allocErr != nil {
+		return nil, allocErr
+	}
+	return &coordinatePointMap{m: m}, nil
+}
+
+// Len is direct analog to len(map[coordinate]Point)
+func (s *coordinatePointMap) Len() int {
+	return s.m.Len()
+}
+
+// Get is an analog to v, ok := map[coordinate]Point[key]
+// Returns a copy of the value stored inside the target allocator.
+func (s *coordinatePointMap) Get(key coordinate) (Point, bool) {
+	var value Point
+	valueBytes, found := s.m.Get((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:])
+	if !found {
+		return value, false
+	}
+	copy((*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:], valueBytes)
+	return value, true
+}
+
+// Put is an analog to map[coordinate]Point[key] = value
+// It copies the key and the value inside the target allocator.
+func (s *coordinatePointMap) Put(key coordinate, value Point) error {
+	return s.m.Put(
+		(*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:],
+		(*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:],
+	)
+}
+
+// Delete is an analog to delete(map[coordinate]Point, key)
+// Reports whether the key was present.
+func (s *coordinatePointMap) Delete(key coordinate) bool {
+	return s.m.Delete((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:])
+}
+
+// Range is an analog to for k, v := range map[coordinate]Point
+// If f returns false, range stops the iteration.
+// The map shouldn't be modified during the iteration.
+func (s *coordinatePointMap) Range(f func(key coordinate, value Point) bool) {
+	s.m.Range(func(keyBytes []byte, valueBytes []byte) bool {
+		var key coordinate
+		var value Point
+		copy((*[unsafe.Sizeof(key)]byte)(unsafe.Pointer(&key))[:], keyBytes)
+		copy((*[unsafe.Sizeof(value)]byte)(unsafe.Pointer(&value))[:], valueBytes)
+		return f(key, value)
+	})
+}
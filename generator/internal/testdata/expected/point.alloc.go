@@ -13,6 +13,26 @@ type internalPointAllocator interface {
 	Metrics() arena.Metrics
 }
 
+type internalPointFreeingAllocator interface {
+	Free(p arena.Ptr)
+}
+
+type internalPointSizedFreeingAllocator interface {
+	Free(p arena.Ptr, size uintptr)
+}
+
+type internalPointCheckedFreeingAllocator interface {
+	Free(p arena.Ptr, size uintptr) error
+}
+
+type internalPointReallocator interface {
+	Realloc(p arena.Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (arena.Ptr, error)
+}
+
+type internalPointUninitializedAllocator interface {
+	AllocNoZero(size uintptr, alignment uintptr) (arena.Ptr, error)
+}
+
 // PointPtr, which basically represents an offset of the allocated value Point
 // inside one of the arenas.
 //
@@ -33,6 +53,12 @@ type PointPtr struct {
 	ptr arena.Ptr
 }
 
+// Translate maps PointPtr allocated before compaction of the allocator
+// to the new location of the same value, by using the translator returned by the Compact method of the allocator.
+func (s PointPtr) Translate(translate arena.PtrTranslator) PointPtr {
+	return PointPtr{ptr: translate(s.ptr)}
+}
+
 // PointBuffer is an analog to []Point,
 // but it represents a slice allocated inside one of the arenas.
 // PointBuffer is a simple struct that should be passed by value and
@@ -73,19 +99,14 @@ func (s PointBuffer) SubSlice(low int, high int) PointBuffer {
 	}
 	var tVar Point
 	tSize := unsafe.Sizeof(tVar)
+	// only the offset is changed, so the rest of arena.Ptr, which depends on the build mode, is kept as is
 	type internalPtr struct {
-		offset    uintptr
-		bucketIdx uint8
-		arenaMask uint16
-	}
-	currentPtr := *(*internalPtr)(unsafe.Pointer(&s.data))
-	newPtr := internalPtr{
-		offset:    currentPtr.offset + uintptr(low*int(tSize)),
-		bucketIdx: currentPtr.bucketIdx,
-		arenaMask: currentPtr.arenaMask,
+		offset uintptr
 	}
+	newPtr := s.data
+	(*internalPtr)(unsafe.Pointer(&newPtr)).offset += uintptr(low * int(tSize))
 	return PointBuffer{
-		data: *(*arena.Ptr)(unsafe.Pointer(&newPtr)),
+		data: newPtr,
 		len:  high - low,
 		cap:  s.cap - low,
 	}
@@ -103,22 +124,24 @@ func (s PointBuffer) Get(idx int) PointPtr {
 	}
 	var tVar Point
 	tSize := unsafe.Sizeof(tVar)
+	// only the offset is changed, so the rest of arena.Ptr, which depends on the build mode, is kept as is
 	type internalPtr struct {
-		offset    uintptr
-		bucketIdx uint8
-		arenaMask uint16
-	}
-	currentPtr := *(*internalPtr)(unsafe.Pointer(&s.data))
-	newPtr := internalPtr{
-		offset:    currentPtr.offset + uintptr(idx*int(tSize)),
-		bucketIdx: currentPtr.bucketIdx,
-		arenaMask: currentPtr.arenaMask,
+		offset uintptr
 	}
+	newPtr := s.data
+	(*internalPtr)(unsafe.Pointer(&newPtr)).offset += uintptr(idx * int(tSize))
 	return PointPtr{
-		ptr: *(*arena.Ptr)(unsafe.Pointer(&newPtr)),
+		ptr: newPtr,
 	}
 }
 
+// Translate maps PointBuffer allocated before compaction of the allocator
+// to the new location of the same buffer, by using the translator returned by the Compact method of the allocator.
+func (s PointBuffer) Translate(translate arena.PtrTranslator) PointBuffer {
+	s.data = translate(s.data)
+	return s
+}
+
 // PointView is an allocation view that can be constructed on top of the target allocator
 // and then used to allocate Point, its slices and buffers inside target allocator.
 //
@@ -169,7 +192,8 @@ func (s *internalPointPtrView) New() (PointPtr, error) {
 // Embed copies passed value inside target allocator, and returns PointPtr to it.
 // PointPtr can be converted to *Point or dereferenced by using other methods of this view.
 func (s *internalPointPtrView) Embed(value Point) (PointPtr, error) {
-	slice, allocErr := s.state.makeSlice(1)
+	// the whole value is overwritten, so there is no need to zero it
+	slice, allocErr := s.state.makeUninitializedSlice(1)
 	if allocErr != nil {
 		return PointPtr{}, allocErr
 	}
@@ -194,6 +218,17 @@ func (s *internalPointPtrView) ToRef(allocPtr PointPtr) *Point {
 	return valuePtr
 }
 
+// Free returns memory of Point referenced by PointPtr to the target allocator,
+// so it can be reused by subsequent allocations.
+// Only allocators that can free individual values, like arena.SlabAllocator or arena.SizeClassAllocator,
+// or arena.GenericAllocator on top of them, support it, for other allocators it returns arena.UnsupportedOperationError.
+//
+// Any usage of PointPtr or *Point converted by ToRef after Free is a "use after free" error.
+func (s *internalPointPtrView) Free(allocPtr PointPtr) error {
+	var tVar Point
+	return s.state.free(allocPtr.ptr, unsafe.Sizeof(tVar))
+}
+
 type internalPointSliceView struct {
 	state internalPointState
 }
@@ -256,26 +291,22 @@ func (s *internalPointSliceView) growIfNecessary(slice []Point,
 		return sliceHdr, nil
 	}
 
+	minLen := sliceHdr.Cap + requiredLen
+	newLen := maxPointLen(minLen, 2*sliceHdr.Cap)
 	emptyPtr := arena.Ptr{}
+	// only the last allocated slice can be referenced by arena.Ptr to be reallocated
 	if s.state.lastAllocatedPtr != emptyPtr && sliceHdr.Data == uintptr(s.state.alloc.ToRef(s.state.lastAllocatedPtr)) {
-		nextPtr, probeAllocErr := s.state.alloc.Alloc(0, 1)
-		if probeAllocErr != nil {
-			return nil, probeAllocErr
+		newPtr, newCap, ok, reallocErr := s.state.realloc(s.state.lastAllocatedPtr, sliceHdr.Cap, minLen, newLen)
+		if reallocErr != nil {
+			return nil, reallocErr
 		}
-		// current allocation offset is the same as previous
-		// we can try to just enhance current buffer
-		nextPtrAddr := uintptr(s.state.alloc.ToRef(nextPtr))
-		nextAllocationIsRightAfterTargetSlice := nextPtrAddr == sliceHdr.Data+(uintptr(sliceHdr.Cap)*tSize)
-		if nextAllocationIsRightAfterTargetSlice && s.state.alloc.Metrics().AvailableBytes >= requiredSizeInBytes {
-			_, enhancingErr := s.state.alloc.Alloc(uintptr(requiredSizeInBytes), 1)
-			if enhancingErr != nil {
-				return nil, enhancingErr
-			}
-			sliceHdr.Cap += requiredLen
+		if ok {
+			sliceHdr.Data = uintptr(s.state.alloc.ToRef(newPtr))
+			sliceHdr.Cap = newCap
 			return sliceHdr, nil
 		}
 	}
-	newDstSlice, allocErr := s.makeGoSlice(2 * (int(sliceHdr.Cap) + requiredLen))
+	newDstSlice, allocErr := s.makeGoSlice(newLen)
 	if allocErr != nil {
 		return nil, allocErr
 	}
@@ -376,6 +407,19 @@ func (s *internalPointBufferView) ToRef(slice PointBuffer) []Point {
 	return *(*[]Point)(unsafe.Pointer(&sliceHdr))
 }
 
+// Free returns memory of PointBuffer to the target allocator,
+// so it can be reused by subsequent allocations.
+// Only allocators that can free values of any size, like arena.SizeClassAllocator or arena.BuddyAllocator,
+// support it, for other allocators it returns arena.UnsupportedOperationError.
+//
+// Please free only buffers returned by allocation and append methods of this view, but not their sub-slices.
+// If Append has to move the data, it frees the previous buffer for such allocators,
+// and any usage of PointBuffer or []Point converted by ToRef after Free is a "use after free" error.
+func (s *internalPointBufferView) Free(slice PointBuffer) error {
+	var tVar Point
+	return s.state.free(slice.data, uintptr(slice.cap)*unsafe.Sizeof(tVar))
+}
+
 func (s *internalPointBufferView) growIfNecessary(
 	slice PointBuffer,
 	requiredLen int,
@@ -395,30 +439,19 @@ func (s *internalPointBufferView) grow(
 	slice PointBuffer,
 	requiredLen int,
 ) (PointBuffer, error) {
-	var tVar Point
-	tSize := unsafe.Sizeof(tVar)
-	requiredSizeInBytes := requiredLen * int(tSize)
-	emptyPtr := arena.Ptr{}
-	if s.state.lastAllocatedPtr != emptyPtr && slice.data == s.state.lastAllocatedPtr {
-		nextPtr, probeAllocErr := s.state.alloc.Alloc(0, 1)
-		if probeAllocErr != nil {
-			return PointBuffer{}, probeAllocErr
-		}
-		// current allocation offset is the same as previous
-		// we can try to just enhance current buffer
-		sliceDataAddr := uintptr(s.state.alloc.ToRef(slice.data))
-		nextPtrAddr := uintptr(s.state.alloc.ToRef(nextPtr))
-		nextAllocationIsRightAfterTargetSlice := nextPtrAddr == sliceDataAddr+(uintptr(slice.cap)*tSize)
-		if nextAllocationIsRightAfterTargetSlice && s.state.alloc.Metrics().AvailableBytes >= requiredSizeInBytes {
-			_, enhancingErr := s.state.alloc.Alloc(uintptr(requiredSizeInBytes), 1)
-			if enhancingErr != nil {
-				return PointBuffer{}, enhancingErr
-			}
-			slice.cap += requiredLen
-			return slice, nil
-		}
+	minLen := slice.cap + requiredLen
+	newLen := maxPointLen(minLen, 2*slice.cap)
+	newPtr, newCap, ok, reallocErr := s.state.realloc(slice.data, slice.cap, minLen, newLen)
+	if reallocErr != nil {
+		return PointBuffer{}, reallocErr
+	}
+	if ok {
+		slice.data = newPtr
+		slice.cap = newCap
+		return slice, nil
 	}
-	newDstSlice, allocErr := s.state.makeSlice(2 * (int(slice.cap) + requiredLen))
+	// allocators without Realloc can't extend the buffer in place
+	newDstSlice, allocErr := s.state.makeSlice(newLen)
 	if allocErr != nil {
 		return PointBuffer{}, allocErr
 	}
@@ -427,6 +460,10 @@ func (s *internalPointBufferView) grow(
 		prev := s.ToRef(slice)
 		copy(dst, prev)
 	}
+	if slice.data != (arena.Ptr{}) {
+		var tVar Point
+		_ = s.state.free(slice.data, uintptr(slice.cap)*unsafe.Sizeof(tVar))
+	}
 	return newDstSlice, nil
 }
 
@@ -452,6 +489,73 @@ func (s *internalPointState) makeSlice(len int) (PointBuffer, error) {
 	return sliceHdr, nil
 }
 
+// makeUninitializedSlice allocates the slice without zeroing, if the allocator supports it,
+// so it can be used only if the whole slice is overwritten right away.
+func (s *internalPointState) makeUninitializedSlice(len int) (PointBuffer, error) {
+	alloc, ok := s.alloc.(internalPointUninitializedAllocator)
+	if !ok {
+		return s.makeSlice(len)
+	}
+	var tVar Point
+	tSize := unsafe.Sizeof(tVar)
+	tAlignment := unsafe.Alignof(tVar)
+	slicePtr, allocErr := alloc.AllocNoZero(uintptr(len)*tSize, tAlignment)
+	if allocErr != nil {
+		return PointBuffer{}, allocErr
+	}
+	s.lastAllocatedPtr = slicePtr
+	sliceHdr := PointBuffer{
+		data: slicePtr,
+		len:  len,
+		cap:  len,
+	}
+	return sliceHdr, nil
+}
+
+func (s *internalPointState) free(ptr arena.Ptr, size uintptr) error {
+	switch alloc := s.alloc.(type) {
+	case internalPointFreeingAllocator:
+		alloc.Free(ptr)
+		return nil
+	case internalPointSizedFreeingAllocator:
+		alloc.Free(ptr, size)
+		return nil
+	case internalPointCheckedFreeingAllocator:
+		return alloc.Free(ptr, size)
+	default:
+		return arena.UnsupportedOperationError
+	}
+}
+
+// realloc extends the slice in place or moves it, if the allocator supports it,
+// it tries newLen first and falls back to minLen if there is not enough memory for newLen.
+func (s *internalPointState) realloc(ptr arena.Ptr, oldLen int, minLen int, newLen int) (arena.Ptr, int, bool, error) {
+	alloc, ok := s.alloc.(internalPointReallocator)
+	if !ok {
+		return arena.Ptr{}, 0, false, nil
+	}
+	var tVar Point
+	tSize := unsafe.Sizeof(tVar)
+	tAlignment := unsafe.Alignof(tVar)
+	newPtr, reallocErr := alloc.Realloc(ptr, uintptr(oldLen)*tSize, uintptr(newLen)*tSize, tAlignment)
+	if reallocErr == arena.AllocationLimitError && newLen > minLen {
+		newLen = minLen
+		newPtr, reallocErr = alloc.Realloc(ptr, uintptr(oldLen)*tSize, uintptr(newLen)*tSize, tAlignment)
+	}
+	if reallocErr != nil {
+		return arena.Ptr{}, 0, true, reallocErr
+	}
+	s.lastAllocatedPtr = newPtr
+	return newPtr, newLen, true, nil
+}
+
+func maxPointLen(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 type internalPointSliceHeader struct {
 	Data uintptr
 	Len  int
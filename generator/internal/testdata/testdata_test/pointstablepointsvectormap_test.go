@@ -0,0 +1,91 @@
+package etalon_test_test
+
+import (
+	"testing"
+
+	"github.com/storozhukBM/allocator/generator/internal/testdata/etalon"
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestGeneratedMapOnUninitializedAlloc(t *testing.T) {
+	t.Parallel()
+	s := &arenaGenMapCheckingStand{}
+	s.check(t, nil)
+}
+
+func TestGeneratedMapOnSimpleArena(t *testing.T) {
+	t.Parallel()
+	s := &arenaGenMapCheckingStand{}
+	s.check(t, &arena.GenericAllocator{})
+}
+
+func TestGeneratedMapOnDynamicArena(t *testing.T) {
+	t.Parallel()
+	s := &arenaGenMapCheckingStand{}
+	s.check(t, arena.NewDynamicAllocator())
+}
+
+func TestGeneratedMapWithAllocLimit(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 4 * 1024})
+	m, allocErr := etalon.NewPointStablePointsVectorMap(a)
+	failOnError(t, allocErr)
+	for i := int32(0); ; i++ {
+		putErr := m.Put(etalon.Point{X: i, Y: -i}, etalon.StablePointsVector{})
+		if putErr != nil {
+			eq(t, arena.AllocationLimitError, putErr, "allocation limit should be triggered")
+			eq(t, int(i), m.Len(), "map should stay consistent")
+			break
+		}
+	}
+}
+
+type arenaGenMapCheckingStand struct{}
+
+func (s *arenaGenMapCheckingStand) check(t *testing.T, target testAllocator) {
+	var alloc *etalon.PointStablePointsVectorMap
+	var allocErr error
+	if target == nil {
+		alloc, allocErr = etalon.NewPointStablePointsVectorMap(nil)
+	} else {
+		alloc, allocErr = etalon.NewPointStablePointsVectorMap(target)
+	}
+	failOnError(t, allocErr)
+
+	const count = 1000
+	expected := make(map[etalon.Point]etalon.StablePointsVector, count)
+	for i := int32(0); i < count; i++ {
+		key := etalon.Point{X: i, Y: i * 2}
+		value := etalon.StablePointsVector{Points: [3]etalon.Point{{X: i}, {Y: i}, {X: i, Y: i}}}
+		failOnError(t, alloc.Put(key, value))
+		expected[key] = value
+	}
+	for i := int32(0); i < count; i += 2 {
+		key := etalon.Point{X: i, Y: i * 2}
+		eq(t, true, alloc.Delete(key), "key should be deleted")
+		eq(t, false, alloc.Delete(key), "key should be already deleted")
+		delete(expected, key)
+	}
+	for i := int32(1); i < count; i += 4 {
+		key := etalon.Point{X: i, Y: i * 2}
+		value := etalon.StablePointsVector{Points: [3]etalon.Point{{X: -i}, {Y: -i}, {X: -i, Y: -i}}}
+		failOnError(t, alloc.Put(key, value))
+		expected[key] = value
+	}
+
+	eq(t, len(expected), alloc.Len(), "unexpected map len")
+	for key, value := range expected {
+		actual, ok := alloc.Get(key)
+		eq(t, true, ok, "key should be present: %+v", key)
+		eq(t, value, actual, "unexpected value for key: %+v", key)
+	}
+	_, ok := alloc.Get(etalon.Point{X: -1, Y: -1})
+	eq(t, false, ok, "absent key shouldn't be present")
+
+	actual := make(map[etalon.Point]etalon.StablePointsVector, len(expected))
+	alloc.Range(func(key etalon.Point, value etalon.StablePointsVector) bool {
+		actual[key] = value
+		return true
+	})
+	eq(t, expected, actual, "range should visit all entries")
+}
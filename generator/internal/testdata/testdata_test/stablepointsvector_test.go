@@ -1,6 +1,7 @@
 package etalon_test_test
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"runtime/debug"
@@ -80,6 +81,186 @@ func TestSimpleArenaWithInitialCapacityAndAllocLimit(t *testing.T) {
 	t.Logf("alloc metrics: %+v", a.Metrics())
 }
 
+func TestSlabArenaFree(t *testing.T) {
+	t.Parallel()
+
+	a := arena.NewSlabAllocator(
+		unsafe.Sizeof(etalon.StablePointsVector{}), unsafe.Alignof(etalon.StablePointsVector{}),
+		arena.SlabOptions{DetectDoubleFree: true},
+	)
+	alloc := etalon.NewStablePointsVectorView(a)
+	first, allocErr := alloc.Ptr.Embed(etalon.StablePointsVector{Points: [3]etalon.Point{{X: 12}}})
+	failOnError(t, allocErr)
+	failOnError(t, alloc.Ptr.Free(first))
+	second, allocErr := alloc.Ptr.New()
+	failOnError(t, allocErr)
+	eq(t, first, second, "freed slot should be reused")
+	eq(t, etalon.StablePointsVector{}, alloc.Ptr.DeRef(second), "reused slot should be clear")
+
+	_, allocErr = alloc.Slice.Make(2)
+	expectErr(t, allocErr)
+	unsupportedErr := etalon.NewStablePointsVectorView(arena.NewDynamicAllocator()).Ptr.Free(second)
+	eq(t, arena.UnsupportedOperationError, unsupportedErr, "dynamic allocator can't free values")
+}
+
+func TestSubArenaFreeOverSlabArena(t *testing.T) {
+	t.Parallel()
+
+	target := arena.NewSlabAllocator(
+		unsafe.Sizeof(etalon.StablePointsVector{}), unsafe.Alignof(etalon.StablePointsVector{}),
+		arena.SlabOptions{DetectDoubleFree: true},
+	)
+	a := arena.NewSubAllocator(target, arena.Options{})
+	alloc := etalon.NewStablePointsVectorView(a)
+	for i := 0; i < 10; i++ {
+		first, allocErr := alloc.Ptr.Embed(etalon.StablePointsVector{Points: [3]etalon.Point{{X: 12}}})
+		failOnError(t, allocErr)
+		second, allocErr := alloc.Ptr.New()
+		failOnError(t, allocErr)
+		failOnError(t, alloc.Ptr.Free(first))
+		eq(t, unsafe.Sizeof(etalon.StablePointsVector{}), uintptr(a.Stats().UsedBytes), "freed slot shouldn't be accounted")
+
+		reused, allocErr := alloc.Ptr.New()
+		failOnError(t, allocErr)
+		eq(t, first, reused, "freed slot should be reused")
+		eq(t, etalon.StablePointsVector{}, alloc.Ptr.DeRef(reused), "reused slot should be clear")
+		failOnError(t, alloc.Ptr.Free(reused))
+		failOnError(t, alloc.Ptr.Free(second))
+		eq(t, 0, a.Stats().UsedBytes, "all slots should be freed")
+	}
+
+	bump := etalon.NewStablePointsVectorView(arena.NewGenericAllocator(arena.Options{}))
+	bumpPtr, allocErr := bump.Ptr.New()
+	failOnError(t, allocErr)
+	eq(t, arena.UnsupportedOperationError, bump.Ptr.Free(bumpPtr), "dynamic allocator can't free values")
+}
+
+func TestSizeClassArena(t *testing.T) {
+	t.Parallel()
+
+	a := arena.NewSizeClassAllocator()
+	s := &arenaGenAllocationCheckingStand{}
+	s.check(t, a)
+
+	alloc := etalon.NewStablePointsVectorView(a)
+	buffer, allocErr := alloc.Buffer.Make(100)
+	failOnError(t, allocErr)
+	ptr, allocErr := alloc.Ptr.New()
+	failOnError(t, allocErr)
+	freeListBytes := a.EnhancedMetrics().FreeListBytes
+	failOnError(t, alloc.Buffer.Free(buffer))
+	failOnError(t, alloc.Ptr.Free(ptr))
+	eq(t, true, a.EnhancedMetrics().FreeListBytes > freeListBytes, "freed buffer should be kept in free-lists")
+
+	reusedBuffer, allocErr := alloc.Buffer.Make(100)
+	failOnError(t, allocErr)
+	eq(t, buffer, reusedBuffer, "freed buffer should be reused")
+	reusedPtr, allocErr := alloc.Ptr.New()
+	failOnError(t, allocErr)
+	eq(t, ptr, reusedPtr, "freed value should be reused")
+	unsupportedErr := etalon.NewStablePointsVectorView(arena.NewDynamicAllocator()).Buffer.Free(buffer)
+	eq(t, arena.UnsupportedOperationError, unsupportedErr, "dynamic allocator can't free values")
+}
+
+func TestBuddyArena(t *testing.T) {
+	t.Parallel()
+
+	a, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{MinBlockSize: 64, Capacity: 16 * 1024 * 1024})
+	failOnError(t, createErr)
+	defer a.Close()
+	s := &arenaGenAllocationCheckingStand{}
+	s.check(t, a)
+
+	a.Clear()
+	alloc := etalon.NewStablePointsVectorView(a)
+	buffer, allocErr := alloc.Buffer.Make(100)
+	failOnError(t, allocErr)
+	ptr, allocErr := alloc.Ptr.New()
+	failOnError(t, allocErr)
+	failOnError(t, alloc.Buffer.Free(buffer))
+	failOnError(t, alloc.Ptr.Free(ptr))
+	eq(t, 0, a.Stats().UsedBytes, "all blocks should be freed")
+	eq(t, a.Metrics().MaxCapacity, a.EnhancedMetrics().FreeListBytes, "freed blocks should be merged")
+}
+
+func TestDynamicArenaDump(t *testing.T) {
+	t.Parallel()
+
+	a := arena.NewDynamicAllocator()
+	alloc := etalon.NewStablePointsVectorView(a)
+	ptr, allocErr := alloc.Ptr.Embed(etalon.StablePointsVector{Points: [3]etalon.Point{{X: 1, Y: 2}}})
+	failOnError(t, allocErr)
+	buffer, allocErr := alloc.Buffer.Make(0)
+	failOnError(t, allocErr)
+	for i := 0; i < 1000; i++ {
+		buffer, allocErr = alloc.Buffer.Append(buffer, etalon.StablePointsVector{Points: [3]etalon.Point{{X: int32(i)}}})
+		failOnError(t, allocErr)
+	}
+
+	dump := &bytes.Buffer{}
+	_, writeErr := a.WriteTo(dump)
+	failOnError(t, writeErr)
+	a.Clear()
+
+	restored := arena.NewDynamicAllocator()
+	_, readErr := restored.ReadFrom(dump)
+	failOnError(t, readErr)
+	restoredAlloc := etalon.NewStablePointsVectorView(restored)
+	eq(t, etalon.StablePointsVector{Points: [3]etalon.Point{{X: 1, Y: 2}}}, restoredAlloc.Ptr.DeRef(ptr), "restored value")
+	for i, v := range restoredAlloc.Buffer.ToRef(buffer) {
+		eq(t, int32(i), v.Points[0].X, "restored buffer")
+	}
+}
+
+func TestDynamicArenaCompact(t *testing.T) {
+	t.Parallel()
+
+	a := arena.NewDynamicAllocator()
+	alloc := etalon.NewStablePointsVectorView(a)
+	ptr, allocErr := alloc.Ptr.Embed(etalon.StablePointsVector{Points: [3]etalon.Point{{X: 1, Y: 2}}})
+	failOnError(t, allocErr)
+	buffer, allocErr := alloc.Buffer.Make(0)
+	failOnError(t, allocErr)
+	for i := 0; i < 1000; i++ {
+		buffer, allocErr = alloc.Buffer.Append(buffer, etalon.StablePointsVector{Points: [3]etalon.Point{{X: int32(i)}}})
+		failOnError(t, allocErr)
+	}
+
+	translate, compactErr := a.Compact()
+	failOnError(t, compactErr)
+	ptr, buffer = ptr.Translate(translate), buffer.Translate(translate)
+	eq(t, etalon.StablePointsVector{Points: [3]etalon.Point{{X: 1, Y: 2}}}, alloc.Ptr.DeRef(ptr), "moved value")
+	for i, v := range alloc.Buffer.ToRef(buffer) {
+		eq(t, int32(i), v.Points[0].X, "moved buffer")
+	}
+	eq(t, int32(10), alloc.Ptr.DeRef(buffer.Get(10)).Points[0].X, "moved buffer element")
+}
+
+func TestDynamicArenaZeroOnAlloc(t *testing.T) {
+	t.Parallel()
+
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true})
+	alloc := etalon.NewStablePointsVectorView(a)
+	value := etalon.StablePointsVector{Points: [3]etalon.Point{{X: 1, Y: 2}, {X: 3, Y: 4}, {X: 5, Y: 6}}}
+	for i := 0; i < 1000; i++ {
+		_, allocErr := alloc.Ptr.Embed(value)
+		failOnError(t, allocErr)
+	}
+	a.Clear()
+
+	ptr, allocErr := alloc.Ptr.New()
+	failOnError(t, allocErr)
+	eq(t, etalon.StablePointsVector{}, alloc.Ptr.DeRef(ptr), "new value after Clear")
+	buffer, allocErr := alloc.Buffer.Make(100)
+	failOnError(t, allocErr)
+	for _, v := range alloc.Buffer.ToRef(buffer) {
+		eq(t, etalon.StablePointsVector{}, v, "buffer after Clear")
+	}
+	ptr, allocErr = alloc.Ptr.Embed(value)
+	failOnError(t, allocErr)
+	eq(t, value, alloc.Ptr.DeRef(ptr), "embedded value after Clear")
+}
+
 type testAllocator interface {
 	Alloc(size, alignment uintptr) (arena.Ptr, error)
 	ToRef(ptr arena.Ptr) unsafe.Pointer
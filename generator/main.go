@@ -12,6 +12,9 @@ import (
 
 func main() {
 	typeNames := flag.String("type", "", "comma-separated list of type names; must be set")
+	mapKeyTypeName := flag.String(
+		"map-key", "", "type name of map key without floats and padding; if set, generates arena maps for every type",
+	)
 	var dirName string
 	flag.StringVar(&dirName, "dir", ".", "working directory; must be set")
 
@@ -24,6 +27,14 @@ func main() {
 	}
 	types := strings.Split(*typeNames, ",")
 	g := generator.NewGenerator()
+	if len(*mapKeyTypeName) > 0 {
+		generationErr := g.RunMapGeneratorForTypes(dirName, *mapKeyTypeName, types)
+		if generationErr != nil {
+			fmt.Printf("can't generate maps: %v", generationErr)
+			os.Exit(1)
+		}
+		return
+	}
 	generationErr := g.RunGeneratorForTypes(dirName, types)
 	if generationErr != nil {
 		fmt.Printf("can't generate allocators: %v", generationErr)
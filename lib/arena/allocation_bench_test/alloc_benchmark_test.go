@@ -139,6 +139,15 @@ func BenchmarkManagedDynamicAllocatorWithPreAlloc(b *testing.B) {
 	runBenchmark(b, a, liveSet-64*KB)
 }
 
+func BenchmarkManagedSyncAllocator(b *testing.B) {
+	b.ReportAllocs()
+	b.StopTimer()
+	a := newManagedArenaAlloc(func() allocator {
+		return arena.NewSyncAllocator()
+	})
+	runBenchmark(b, a, liveSet-64*KB)
+}
+
 func BenchmarkManagedGenericAllocatorWithPreAllocWithSubClean(b *testing.B) {
 	b.ReportAllocs()
 	b.StopTimer()
@@ -160,6 +169,15 @@ func BenchmarkRawAllocator(b *testing.B) {
 	runBenchmark(b, a, liveSet-64*KB)
 }
 
+func BenchmarkSyncAllocator(b *testing.B) {
+	b.ReportAllocs()
+	b.StopTimer()
+	a := newDirectArenaAlloc(func() allocator {
+		return arena.NewSyncAllocator()
+	})
+	runBenchmark(b, a, liveSet-64*KB)
+}
+
 func BenchmarkGenericAllocatorWithSubClean(b *testing.B) {
 	b.ReportAllocs()
 	b.StopTimer()
@@ -0,0 +1,52 @@
+package allocation_bench_test
+
+import (
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+const toRefBenchPtrCount = 1024
+
+// BenchmarkToRef measures the cost of ToRef checks of arena.Ptr.
+// To compare the default mask check with the checked mode, run it with and without `arenachecked` tag:
+//
+//	go test -run none -bench ToRef -count 10 ./allocation_bench_test > mask.txt
+//	go test -tags arenachecked -run none -bench ToRef -count 10 ./allocation_bench_test > checked.txt
+//	benchstat mask.txt checked.txt
+func BenchmarkToRef(b *testing.B) {
+	buddy, buddyErr := arena.NewBuddyAllocator(arena.BuddyOptions{MinBlockSize: 64, MaxBlockSize: 64 * KB})
+	if buddyErr != nil {
+		b.Fatal(buddyErr)
+	}
+	targets := []struct {
+		name  string
+		alloc allocator
+	}{
+		{name: "Dynamic", alloc: arena.NewDynamicAllocator()},
+		{name: "Generic", alloc: arena.NewGenericAllocator(arena.Options{})},
+		{name: "Sync", alloc: arena.NewSyncAllocator()},
+		{name: "Buddy", alloc: buddy},
+	}
+	for _, target := range targets {
+		ptrs := make([]arena.Ptr, toRefBenchPtrCount)
+		for i := range ptrs {
+			ptr, allocErr := target.alloc.Alloc(8, 8)
+			if allocErr != nil {
+				b.Fatal(allocErr)
+			}
+			ptrs[i] = ptr
+		}
+		alloc := target.alloc
+		b.Run(target.name, func(b *testing.B) {
+			b.ReportAllocs()
+			sum := 0
+			for i := 0; i < b.N; i++ {
+				sum += int(*(*int64)(alloc.ToRef(ptrs[i%toRefBenchPtrCount])))
+			}
+			if sum != 0 {
+				b.Fatal("allocated values should be clear")
+			}
+		})
+	}
+}
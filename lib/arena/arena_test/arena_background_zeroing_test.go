@@ -0,0 +1,129 @@
+package arena_test
+
+import (
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaBackgroundZeroingStand struct{}
+
+// dirty fills the specified count of bytes with non-zero values and clears the allocator.
+func (s *arenaBackgroundZeroingStand) dirty(t *testing.T, target allocator, bytes int) {
+	view := arena.NewBytesView(target)
+	for i := 0; i < bytes/1024; i++ {
+		b, allocErr := view.MakeBytes(1024)
+		failOnError(t, allocErr)
+		for j := range view.BytesToRef(b) {
+			view.BytesToRef(b)[j] = 0xff
+		}
+	}
+	target.Clear()
+}
+
+// checkClean allocates the specified count of bytes and checks that all of them are zeroed.
+func (s *arenaBackgroundZeroingStand) checkClean(t *testing.T, target allocator, bytes int) {
+	view := arena.NewBytesView(target)
+	for i := 0; i < bytes/1024; i++ {
+		b, allocErr := view.MakeBytes(1024)
+		failOnError(t, allocErr)
+		for j, v := range view.BytesToRef(b) {
+			assert(v == 0, "reused memory should be clean. idx: %v; value: %v", j, v)
+		}
+	}
+}
+
+func TestDynamicArenaBackgroundZeroing(t *testing.T) {
+	t.Parallel()
+	stand := &arenaBackgroundZeroingStand{}
+	zeroer := arena.NewBackgroundZeroer(0)
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{BackgroundZeroer: zeroer})
+	for i := 0; i < 10; i++ {
+		stand.dirty(t, a, 4*1024*1024)
+		metrics := a.Metrics()
+		assert(metrics.PendingDirtyBytes <= metrics.AllocatedBytes, "unexpected metrics: %v", metrics)
+		assert(metrics.RetainedBytes+metrics.PendingDirtyBytes <= metrics.AllocatedBytes, "unexpected metrics: %v", metrics)
+		stand.checkClean(t, a, 4*1024*1024)
+		a.Clear()
+	}
+
+	zeroer.Close()
+	zeroer.Close()
+	assert(zeroer.PendingBytes() == 0, "all buffers should be zeroed on close: %v", zeroer.PendingBytes())
+	a.Clear()
+	assert(a.Metrics().PendingDirtyBytes == 0, "unexpected metrics: %v", a.Metrics())
+	assert(a.Metrics().RetainedBytes == a.Metrics().AllocatedBytes, "zeroed buffers should be reused: %v", a.Metrics())
+	stand.dirty(t, a, 4*1024*1024)
+	assert(a.Metrics().PendingDirtyBytes == 0, "closed zeroer shouldn't accept buffers: %v", a.Metrics())
+	stand.checkClean(t, a, 4*1024*1024)
+}
+
+func TestDynamicArenaBackgroundZeroingBackpressure(t *testing.T) {
+	t.Parallel()
+	stand := &arenaBackgroundZeroingStand{}
+	const maxPendingBytes = 64 * 1024
+	zeroer := arena.NewBackgroundZeroer(maxPendingBytes)
+	defer zeroer.Close()
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		BackgroundZeroer: zeroer,
+		GrowthStrategy:   arena.FixedGrowth(32 * 1024),
+	})
+	for i := 0; i < 10; i++ {
+		stand.dirty(t, a, 1024*1024)
+		assert(zeroer.PendingBytes() <= maxPendingBytes, "pending bytes should be limited: %v", zeroer.PendingBytes())
+		assert(a.Metrics().PendingDirtyBytes <= maxPendingBytes, "unexpected metrics: %v", a.Metrics())
+		stand.checkClean(t, a, 1024*1024)
+		a.Clear()
+	}
+}
+
+func TestGenericArenaBackgroundZeroing(t *testing.T) {
+	t.Parallel()
+	stand := &arenaBackgroundZeroingStand{}
+	zeroer := arena.NewBackgroundZeroer(0)
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	targets := []allocator{
+		arena.NewGenericAllocator(arena.Options{BackgroundZeroer: zeroer}),
+		arena.NewGenericAllocator(arena.Options{BackgroundZeroer: zeroer, DelegateClearToUnderlyingAllocator: true}),
+		registry.NewAllocator("zeroed", arena.Options{BackgroundZeroer: zeroer}),
+	}
+	observedPending := make([]bool, len(targets))
+	for i := 0; i < 5; i++ {
+		for j, target := range targets {
+			stand.dirty(t, target, 4*1024*1024)
+			// zeroing of 4MB takes much longer than this check, so buffers are observed while they are pending
+			observedPending[j] = observedPending[j] || target.Metrics().PendingDirtyBytes > 0
+			stand.checkClean(t, target, 4*1024*1024)
+			target.Clear()
+		}
+	}
+	zeroer.Close()
+	for j, target := range targets {
+		assert(observedPending[j] || protectMemoryOnClear, "buffers should be zeroed in the background: %v", target.Metrics())
+		target.Clear()
+		metrics := target.Metrics()
+		assert(metrics.PendingDirtyBytes == 0, "unexpected metrics: %v", metrics)
+		assert(metrics.RetainedBytes > 0 && metrics.RetainedBytes == metrics.AllocatedBytes, "zeroed buffers should be reused: %v", metrics)
+	}
+}
+
+func TestDynamicArenaCloseReturnsPendingBuffersToPool(t *testing.T) {
+	t.Parallel()
+	stand := &arenaBackgroundZeroingStand{}
+	zeroer := arena.NewBackgroundZeroer(0)
+	pool := arena.NewRawAllocatorPool(0)
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{BackgroundZeroer: zeroer, Pool: pool})
+	stand.dirty(t, a, 4*1024*1024)
+	stand.checkClean(t, a, 4*1024*1024)
+	stand.dirty(t, a, 4*1024*1024)
+	// too small arenas released from the free-list are already in the pool
+	expectedPooledBytes := pool.PooledBytes() + a.Metrics().AllocatedBytes
+	a.Close()
+
+	// Close of the zeroer waits until all pending buffers are zeroed
+	zeroer.Close()
+	assert(pool.PooledBytes() == expectedPooledBytes, "pool should retain all buffers: %v; expected: %v", pool.PooledBytes(), expectedPooledBytes)
+	reused := arena.NewDynamicAllocatorWithPool(pool)
+	stand.checkClean(t, reused, 4*1024*1024)
+	assert(pool.PooledBytes() < expectedPooledBytes, "buffers should be taken from pool: %v", pool.PooledBytes())
+}
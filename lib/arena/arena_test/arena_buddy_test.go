@@ -0,0 +1,250 @@
+package arena_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaBuddyCheckingStand struct{}
+
+func (s *arenaBuddyCheckingStand) check(t *testing.T, a *arena.BuddyAllocator, minBlockSize int, maxBlockSize int) {
+	const count = 2000
+	view := arena.NewBytesView(a)
+	random := rand.New(rand.NewSource(42))
+	capacity := a.Metrics().MaxCapacity
+	assert(capacity%maxBlockSize == 0, "capacity should be rounded to max block: %v", a.Metrics())
+
+	live := make([]arena.Bytes, 0, count)
+	for i := 0; i < count; i++ {
+		size := minBlockSize/2 + random.Intn(maxBlockSize/8)
+		bytes, allocErr := view.MakeBytes(size)
+		if allocErr == arena.AllocationLimitError {
+			assert(a.Metrics().AvailableBytes < capacity, "region should be used: %v", a.Metrics())
+		} else {
+			failOnError(t, allocErr)
+			rawBytes := view.BytesToRef(bytes)
+			for j := range rawBytes {
+				if rawBytes[j] != 0 {
+					t.Fatalf("allocated memory should be clear. size: %v; idx: %v", size, j)
+				}
+				rawBytes[j] = byte(i%255 + 1)
+			}
+			live = append(live, bytes)
+		}
+
+		if random.Intn(2) == 0 && len(live) > 0 {
+			victimIdx := random.Intn(len(live))
+			failOnError(t, view.Free(live[victimIdx]))
+			live[victimIdx] = live[len(live)-1]
+			live = live[:len(live)-1]
+		}
+	}
+
+	dataBytes := 0
+	for _, bytes := range live {
+		rawBytes := view.BytesToRef(bytes)
+		dataBytes += len(rawBytes)
+		for j := 1; j < len(rawBytes); j++ {
+			if rawBytes[j] != rawBytes[0] {
+				t.Fatalf("allocations overlap: %v", bytes)
+			}
+		}
+	}
+	metrics := a.EnhancedMetrics()
+	assert(metrics.DataBytes == dataBytes, "unexpected metrics: %v; expected data bytes: %v", metrics, dataBytes)
+	assert(metrics.CountOfAllocations > len(live), "unexpected metrics: %v", metrics)
+	assert(metrics.FragmentationBytes > 0, "blocks should be rounded to power of 2: %v", metrics)
+	assert(metrics.UsedBytes == metrics.DataBytes+metrics.FragmentationBytes, "unexpected metrics: %v", metrics)
+	assert(metrics.UsedBytes+metrics.FreeListBytes == capacity, "unexpected metrics: %v", metrics)
+
+	// freed in arbitrary order, blocks should coalesce back into max blocks
+	random.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	for _, bytes := range live {
+		failOnError(t, view.Free(bytes))
+	}
+	metrics = a.EnhancedMetrics()
+	assert(metrics.UsedBytes == 0 && metrics.DataBytes == 0, "unexpected metrics: %v", metrics)
+	assert(metrics.FreeListBytes == capacity, "unexpected metrics: %v", metrics)
+	for i := 0; i < capacity/maxBlockSize; i++ {
+		bytes, allocErr := view.MakeBytes(maxBlockSize)
+		failOnError(t, allocErr)
+		rawBytes := view.BytesToRef(bytes)
+		for j := range rawBytes {
+			if rawBytes[j] != 0 {
+				t.Fatalf("reused memory should be clear. idx: %v", j)
+			}
+		}
+	}
+	_, allocErr := a.AllocUnaligned(1)
+	assert(allocErr == arena.AllocationLimitError, "region should be exhausted: %v", allocErr)
+	_, allocErr = a.AllocUnaligned(uintptr(maxBlockSize + 1))
+	assert(allocErr == arena.AllocationLimitError, "max block size should be respected: %v", allocErr)
+
+	a.Clear()
+	metrics = a.EnhancedMetrics()
+	assert(metrics.UsedBytes == 0 && metrics.FreeListBytes == capacity, "unexpected metrics after Clear: %v", metrics)
+	ptr, allocErr := a.Alloc(uintptr(maxBlockSize), uintptr(minBlockSize))
+	failOnError(t, allocErr)
+	assert(a.ToRef(ptr) != nil, "allocation after Clear should succeed")
+}
+
+func TestBuddyArena(t *testing.T) {
+	t.Parallel()
+	stand := &arenaBuddyCheckingStand{}
+
+	a, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{Capacity: 4 * 1024 * 1024})
+	failOnError(t, createErr)
+	stand.check(t, a, 4*1024, 1024*1024)
+	assert(a.Stats().CountOfOnHeapAllocations == 1, "unexpected stats: %v", a.Stats())
+	a.Close()
+
+	small, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{MinBlockSize: 64, MaxBlockSize: 16 * 1024, Capacity: 40000})
+	failOnError(t, createErr)
+	assert(small.Metrics().MaxCapacity == 48*1024, "unexpected metrics: %v", small.Metrics())
+	stand.check(t, small, 64, 16*1024)
+	small.Close()
+
+	for _, opts := range []arena.BuddyOptions{
+		{MinBlockSize: 3000},
+		{MaxBlockSize: 3 * 1024 * 1024},
+		{MinBlockSize: 64 * 1024, MaxBlockSize: 4 * 1024},
+		{MinBlockSize: 1, MaxBlockSize: 1 << 31, Capacity: 1 << 31},
+	} {
+		_, createErr = arena.NewBuddyAllocator(opts)
+		assert(createErr == arena.AllocationInvalidArgumentError, "unexpected error: %v; opts: %+v", createErr, opts)
+	}
+}
+
+func TestBuddyArenaReallocOfTheLastBlock(t *testing.T) {
+	t.Parallel()
+	a, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{})
+	failOnError(t, createErr)
+	var last arena.Ptr
+	for i := 0; i < 256; i++ {
+		var allocErr error
+		last, allocErr = a.Alloc(4096, 8)
+		failOnError(t, allocErr)
+	}
+	*(*int)(a.ToRef(last)) = 42
+	// the last block is at the top of the region, so it has no right buddy to merge with
+	_, reallocErr := a.Realloc(last, 4096, 8192, 8)
+	assert(reallocErr == arena.AllocationLimitError, "unexpected error: %v", reallocErr)
+	assert(*(*int)(a.ToRef(last)) == 42, "value should stay untouched")
+}
+
+func TestBuddyArenaDetectsInvalidFree(t *testing.T) {
+	t.Parallel()
+	a, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{})
+	failOnError(t, createErr)
+	ptr, allocErr := a.AllocUnaligned(100)
+	failOnError(t, allocErr)
+	assert(a.EnhancedMetrics().FragmentationBytes == 4*1024-100, "unexpected metrics: %v", a.EnhancedMetrics())
+	bytes, allocErr := arena.NewBytesView(a).MakeBytes(100)
+	failOnError(t, allocErr)
+	a.Free(ptr)
+
+	checkPanics := func(msg string, f func()) {
+		defer func() {
+			p := recover()
+			assert(p != nil, msg)
+		}()
+		f()
+	}
+	checkPanics("double free should be detected", func() { a.Free(ptr) })
+	subSlice := bytes.SubSlice(1, 2)
+	checkPanics("free of interior pointer should be detected", func() { _ = arena.NewBytesView(a).Free(subSlice) })
+	foreignPtr, allocErr := arena.NewDynamicAllocator().Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkPanics("free of foreign pointer should be detected", func() { a.Free(foreignPtr) })
+	_, allocErr = a.Alloc(8, 1<<40)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "alignment bigger than region isn't supported: %v", allocErr)
+
+	a.Clear()
+	checkPanics("use after Clear should be detected", func() { a.ToRef(ptr) })
+	a.Close()
+	checkPanics("closed allocator can't be used", func() { _, _ = a.AllocUnaligned(1) })
+	a.Clear()
+	a.Close()
+}
+
+func TestSubArenaOverBuddyArena(t *testing.T) {
+	t.Parallel()
+	const blockSize = 4 * 1024
+	target, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{})
+	failOnError(t, createErr)
+	a := arena.NewSubAllocator(target, arena.Options{
+		AllocationLimitInBytes:             3 * blockSize,
+		DelegateClearToUnderlyingAllocator: true,
+	})
+	other := arena.NewSubAllocator(target, arena.Options{})
+
+	for i := 0; i < 3; i++ {
+		ptr, allocErr := a.AllocUnaligned(1)
+		failOnError(t, allocErr)
+		assert(a.ToRef(ptr) != nil, "allocation should succeed")
+	}
+	assert(a.Stats().UsedBytes == 3*blockSize, "whole blocks should be accounted: %v", a.Stats())
+	_, allocErr := a.AllocUnaligned(1)
+	assert(allocErr == arena.AllocationLimitError, "limit should be respected: %v", allocErr)
+
+	otherPtr, allocErr := other.AllocUnaligned(blockSize + 1)
+	failOnError(t, allocErr)
+	assert(other.ToRef(otherPtr) != nil, "allocation should succeed")
+	assert(target.Stats().UsedBytes == 5*blockSize, "unexpected stats: %v", target.Stats())
+
+	a.Clear()
+	assert(target.Stats().UsedBytes == 0, "delegated Clear should free all blocks: %v", target.Stats())
+	ptr, allocErr := a.AllocUnaligned(blockSize)
+	failOnError(t, allocErr)
+	assert(a.ToRef(ptr) != nil, "allocation after Clear should succeed")
+}
+
+func TestSubArenaFreeOverBuddyArena(t *testing.T) {
+	t.Parallel()
+	const blockSize = 4 * 1024
+	target, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{})
+	failOnError(t, createErr)
+	a := arena.NewSubAllocator(target, arena.Options{AllocationLimitInBytes: 2 * blockSize})
+	other := arena.NewSubAllocator(target, arena.Options{})
+
+	for i := 0; i < 10; i++ {
+		first, allocErr := a.Alloc(blockSize, 8)
+		failOnError(t, allocErr)
+		second, allocErr := a.Alloc(blockSize, 8)
+		failOnError(t, allocErr)
+		_, allocErr = a.Alloc(1, 1)
+		assert(allocErr == arena.AllocationLimitError, "limit should be respected: %v", allocErr)
+		*(*uint64)(a.ToRef(first)) = math.MaxUint64
+
+		failOnError(t, a.Free(first, blockSize))
+		assert(a.Stats().UsedBytes == blockSize, "freed block shouldn't be accounted: %v", a.Stats())
+		assert(a.EnhancedMetrics().DataBytes == blockSize, "unexpected metrics: %v", a.EnhancedMetrics())
+		reused, allocErr := a.Alloc(blockSize, 8)
+		failOnError(t, allocErr)
+		assert(reused == first, "freed block should be reused: %v; %v", reused, first)
+		assert(*(*uint64)(a.ToRef(reused)) == 0, "reused block should be clear")
+
+		failOnError(t, a.Free(reused, blockSize))
+		failOnError(t, a.Free(second, blockSize))
+		assert(a.Stats().UsedBytes == 0, "all blocks should be freed: %v", a.Stats())
+		assert(target.Stats().UsedBytes == 0, "all blocks should be returned to the target: %v", target.Stats())
+	}
+
+	otherPtr, allocErr := other.Alloc(8, 8)
+	failOnError(t, allocErr)
+	func() {
+		defer func() {
+			p := recover()
+			assert(p != nil, "free of foreign pointer should be detected")
+		}()
+		_ = a.Free(otherPtr, 8)
+	}()
+	bump := arena.NewSubAllocator(arena.NewDynamicAllocator(), arena.Options{})
+	bumpPtr, allocErr := bump.Alloc(8, 8)
+	failOnError(t, allocErr)
+	unsupportedErr := bump.Free(bumpPtr, 8)
+	assert(unsupportedErr == arena.UnsupportedOperationError, "dynamic allocator can't free values: %v", unsupportedErr)
+}
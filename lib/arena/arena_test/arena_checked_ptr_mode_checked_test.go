@@ -0,0 +1,8 @@
+//go:build arenachecked || arenadebug
+// +build arenachecked arenadebug
+
+package arena_test
+
+// checkedPtrMode mirrors the checked mode of the arena package,
+// where arena.Ptr values allocated after the checkpoint are rejected after ResetTo.
+const checkedPtrMode = true
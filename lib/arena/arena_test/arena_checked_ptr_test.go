@@ -0,0 +1,139 @@
+//go:build arenachecked
+// +build arenachecked
+
+package arena_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+// maskCycles is enough Clear calls to walk through all values of the 16-bit arena mask.
+const maskCycles = 1 << 16
+
+type arenaCheckedPtrStand struct{}
+
+func (s *arenaCheckedPtrStand) check(t *testing.T, target allocator, other allocator) {
+	stalePtr, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	foreignPtr, allocErr := other.Alloc(8, 8)
+	failOnError(t, allocErr)
+
+	for i := 0; i < maskCycles; i++ {
+		target.Clear()
+		// the same memory is allocated again, so the stale arena.Ptr passes bounds checks
+		_, allocErr = target.Alloc(8, 8)
+		failOnError(t, allocErr)
+		s.checkRejected(target, stalePtr, i)
+		s.checkRejected(target, foreignPtr, i)
+	}
+}
+
+func (s *arenaCheckedPtrStand) checkRejected(target allocator, p arena.Ptr, cycle int) {
+	defer func() {
+		err := recover()
+		assert(err == "pointer isn't part of this arena", "ptr should be rejected. cycle: %v; err: %v", cycle, err)
+	}()
+	target.ToRef(p)
+}
+
+func TestCheckedPtrDetectsStaleAndForeignPtr(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCheckedPtrStand{}
+
+	stand.check(t, arena.NewDynamicAllocator(), arena.NewDynamicAllocator())
+	stand.check(
+		t,
+		arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}),
+		arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}),
+	)
+	target := arena.NewDynamicAllocator()
+	stand.check(
+		t,
+		arena.NewSubAllocator(target, arena.Options{DelegateClearToUnderlyingAllocator: true}),
+		arena.NewSubAllocator(target, arena.Options{}),
+	)
+	stand.check(t, arena.NewSyncAllocator(), arena.NewSyncAllocator())
+
+	opts := arena.BuddyOptions{MinBlockSize: 64, MaxBlockSize: 4096}
+	buddy, buddyErr := arena.NewBuddyAllocator(opts)
+	failOnError(t, buddyErr)
+	otherBuddy, buddyErr := arena.NewBuddyAllocator(opts)
+	failOnError(t, buddyErr)
+	stand.check(t, buddy, otherBuddy)
+}
+
+func (s *arenaCheckedPtrStand) checkReset(t *testing.T, target resettableAllocator) {
+	before, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	outerCheckpoint := target.CurrentOffset()
+	afterOuter, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	innerCheckpoint := target.CurrentOffset()
+
+	for i := 0; i < 3; i++ {
+		afterInner, allocErr := target.Alloc(8, 8)
+		failOnError(t, allocErr)
+		failOnError(t, target.ResetTo(innerCheckpoint))
+		// the same memory is allocated again, so the stale arena.Ptr passes bounds checks
+		_, allocErr = target.Alloc(8, 8)
+		failOnError(t, allocErr)
+		s.checkRejected(target, afterInner, i)
+		target.ToRef(afterOuter)
+		failOnError(t, target.ResetTo(innerCheckpoint))
+	}
+
+	failOnError(t, target.ResetTo(outerCheckpoint))
+	_, allocErr = target.Alloc(16, 8)
+	failOnError(t, allocErr)
+	s.checkRejected(target, afterOuter, 0)
+	resetErr := target.ResetTo(innerCheckpoint)
+	assert(resetErr == arena.AllocationInvalidArgumentError, "checkpoint was dropped by ResetTo: %v", resetErr)
+	target.ToRef(before)
+	failOnError(t, target.ResetTo(outerCheckpoint))
+}
+
+func TestCheckedPtrDetectsPtrAllocatedAfterCheckpoint(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCheckedPtrStand{}
+
+	stand.checkReset(t, arena.NewDynamicAllocator())
+	stand.checkReset(t, arena.NewGenericAllocator(arena.Options{}))
+	target := arena.NewDynamicAllocator()
+	stand.checkReset(t, arena.NewSubAllocator(target, arena.Options{}))
+	stand.checkReset(t, arena.NewSubAllocator(nil, arena.Options{}))
+}
+
+func TestCheckedPtrGenerationsSurviveDumpAndCompact(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCheckedPtrStand{}
+	a := arena.NewDynamicAllocator()
+	before, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkpoint := a.CurrentOffset()
+	stale, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	failOnError(t, a.ResetTo(checkpoint))
+	after, allocErr := a.Alloc(uintptr(a.Metrics().AvailableBytes+1), 8)
+	failOnError(t, allocErr)
+
+	dump := &bytes.Buffer{}
+	_, writeErr := a.WriteTo(dump)
+	failOnError(t, writeErr)
+	restored := arena.NewDynamicAllocator()
+	_, readErr := restored.ReadFrom(dump)
+	failOnError(t, readErr)
+	restored.ToRef(before)
+	restored.ToRef(after)
+	stand.checkRejected(restored, stale, 0)
+	failOnError(t, restored.ResetTo(checkpoint))
+	stand.checkRejected(restored, after, 0)
+
+	translate, compactErr := a.Compact()
+	failOnError(t, compactErr)
+	a.ToRef(translate(before))
+	a.ToRef(translate(after))
+	stand.checkRejected(a, before, 0)
+}
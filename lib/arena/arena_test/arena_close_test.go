@@ -0,0 +1,169 @@
+package arena_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type closableAllocator interface {
+	allocator
+	Close()
+}
+
+type arenaCloseCheckingStand struct{}
+
+func (s *arenaCloseCheckingStand) check(t *testing.T, target closableAllocator) {
+	view := arena.NewBytesView(target)
+	bytes, allocErr := view.Embed([]byte("data before close"))
+	failOnError(t, allocErr)
+	ptr, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+
+	target.Close()
+	target.Close()
+	target.Clear()
+	assert(target.Stats().UsedBytes == 0, "closed arena should have no used bytes: %v", target.Stats())
+	assert(fmt.Sprintf("%v", target) != "", "closed arena should be printable")
+
+	s.checkPanicsWithClosedError(func() { _, _ = target.Alloc(8, 8) })
+	s.checkPanicsWithClosedError(func() { _, _ = target.AllocUnaligned(8) })
+	s.checkPanicsWithClosedError(func() { target.CurrentOffset() })
+	s.checkPanicsWithClosedError(func() { target.ToRef(ptr) })
+	s.checkPanicsWithClosedError(func() { view.BytesToRef(bytes) })
+	s.checkPanicsWithClosedError(func() { _, _ = view.MakeBytes(8) })
+}
+
+func (s *arenaCloseCheckingStand) checkPanicsWithClosedError(f func()) {
+	defer func() {
+		closedArenaPanic := recover()
+		assert(closedArenaPanic == arena.AllocatorClosedError, "unexpected panic: %v", closedArenaPanic)
+	}()
+	f()
+}
+
+func TestCloseOnDifferentAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCloseCheckingStand{}
+	stand.check(t, &arena.GenericAllocator{})
+	stand.check(t, arena.NewGenericAllocator(arena.Options{InitialCapacity: requiredBytesForBasicTest}))
+	stand.check(t, arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}))
+	stand.check(t, arena.NewDynamicAllocator())
+	stand.check(t, arena.NewDynamicAllocatorWithPool(arena.NewRawAllocatorPool(0)))
+	stand.check(t, arena.NewInstrumentedAllocator(arena.NewDynamicAllocator()))
+}
+
+func TestClosePropagationToUnderlyingAllocator(t *testing.T) {
+	t.Parallel()
+	{
+		target := arena.NewDynamicAllocator()
+		sub := arena.NewSubAllocator(target, arena.Options{DelegateClearToUnderlyingAllocator: true})
+		_, allocErr := sub.Alloc(8, 8)
+		failOnError(t, allocErr)
+		sub.Close()
+		stand := &arenaCloseCheckingStand{}
+		stand.checkPanicsWithClosedError(func() { _, _ = target.Alloc(8, 8) })
+	}
+	{
+		target := arena.NewDynamicAllocator()
+		sub := arena.NewSubAllocator(target, arena.Options{})
+		_, allocErr := sub.Alloc(8, 8)
+		failOnError(t, allocErr)
+		sub.Close()
+		_, allocErr = target.Alloc(8, 8)
+		failOnError(t, allocErr)
+	}
+	{
+		target := arena.NewRawAllocator(1024)
+		sub := arena.NewSubAllocator(target, arena.Options{DelegateClearToUnderlyingAllocator: true})
+		_, allocErr := sub.Alloc(512, 8)
+		failOnError(t, allocErr)
+		sub.Close()
+		assert(target.Stats().UsedBytes == 0, "target without Close support should be cleared: %v", target.Stats())
+	}
+}
+
+func TestCloseReturnsBuffersToPool(t *testing.T) {
+	t.Parallel()
+	pool := arena.NewRawAllocatorPool(0)
+	first := arena.NewDynamicAllocatorWithPool(pool)
+	for i := 0; i < 1000; i++ {
+		_, allocErr := first.Alloc(1024, 8)
+		failOnError(t, allocErr)
+	}
+	first.Clear()
+	_, allocErr := first.Alloc(1024, 8)
+	failOnError(t, allocErr)
+	allocatedBytes := first.Stats().AllocatedBytes
+	first.Close()
+	assert(first.Stats().AllocatedBytes == 0, "closed arena shouldn't retain buffers: %v", first.Stats())
+	assert(pool.PooledBytes() == allocatedBytes, "pool should retain all buffers: %v; expected: %v", pool.PooledBytes(), allocatedBytes)
+	countOfArenas := pool.CountOfArenas()
+	assert(countOfArenas > 1, "pool should retain buffers and free-list: %v", countOfArenas)
+
+	second := arena.NewDynamicAllocatorWithPool(pool)
+	for i := 0; i < 1000; i++ {
+		ptr, allocErr := second.Alloc(1024, 8)
+		failOnError(t, allocErr)
+		buf := (*[1024]byte)(second.ToRef(ptr))
+		for j := range buf {
+			assert(buf[j] == 0, "buffers from pool should be cleared")
+			buf[j] = 0xff
+		}
+	}
+	assert(second.Stats().CountOfOnHeapAllocations == 0, "buffers should be reused: %v", second.Stats())
+	assert(pool.CountOfArenas() < countOfArenas, "buffers should be taken from pool: %v", pool.CountOfArenas())
+	second.Close()
+
+	third := arena.NewDynamicAllocatorWithPool(pool)
+	for i := 0; i < 1000; i++ {
+		ptr, allocErr := third.Alloc(1024, 8)
+		failOnError(t, allocErr)
+		buf := (*[1024]byte)(third.ToRef(ptr))
+		for j := range buf {
+			assert(buf[j] == 0, "buffers from pool should be cleared")
+		}
+	}
+}
+
+func TestRawAllocatorPoolLimit(t *testing.T) {
+	t.Parallel()
+	pool := arena.NewRawAllocatorPool(128 * 1024)
+	a := arena.NewDynamicAllocatorWithPool(pool)
+	for i := 0; i < 1000; i++ {
+		_, allocErr := a.Alloc(1024, 8)
+		failOnError(t, allocErr)
+	}
+	a.Close()
+	assert(pool.PooledBytes() <= 128*1024, "pool should respect its limit: %v", pool.PooledBytes())
+	assert(pool.CountOfArenas() > 0, "pool should retain some buffers: %v", pool.CountOfArenas())
+}
+
+func TestRawAllocatorPoolConcurrentUsage(t *testing.T) {
+	t.Parallel()
+	pool := arena.NewRawAllocatorPool(0)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sub := arena.NewSubAllocator(arena.NewDynamicAllocatorWithPool(pool), arena.Options{
+					DelegateClearToUnderlyingAllocator: true,
+				})
+				view := arena.NewBytesView(sub)
+				for k := 0; k < 100; k++ {
+					_, allocErr := view.Embed(make([]byte, 1024))
+					if allocErr != nil {
+						panic(allocErr)
+					}
+				}
+				sub.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	assert(pool.CountOfArenas() > 0, "pool should retain buffers: %v", pool.CountOfArenas())
+}
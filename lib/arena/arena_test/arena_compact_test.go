@@ -0,0 +1,118 @@
+package arena_test
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type compactableAllocator interface {
+	allocator
+	Compact() (arena.PtrTranslator, error)
+}
+
+type arenaCompactCheckingStand struct{}
+
+func (s *arenaCompactCheckingStand) check(t *testing.T, target compactableAllocator) {
+	const count = 10000
+	const alignment = 64
+	view := arena.NewBytesView(target)
+	head := arena.Ptr{}
+	alignedPtrs := make([]arena.Ptr, 0, count/100)
+	for i := 0; i < count; i++ {
+		nodePtr, allocErr := target.Alloc(unsafe.Sizeof(dumpedNode{}), unsafe.Alignof(dumpedNode{}))
+		failOnError(t, allocErr)
+		name, allocErr := view.Embed([]byte(fmt.Sprintf("node-%v", i)))
+		failOnError(t, allocErr)
+		node := (*dumpedNode)(target.ToRef(nodePtr))
+		node.value = i
+		node.name = name
+		node.next = head
+		head = nodePtr
+		if i%100 == 0 {
+			alignedPtr, allocErr := target.Alloc(8, alignment)
+			failOnError(t, allocErr)
+			*(*int)(target.ToRef(alignedPtr)) = i
+			alignedPtrs = append(alignedPtrs, alignedPtr)
+		}
+	}
+	before := target.Metrics()
+	assert(before.CountOfOnHeapAllocations > 1, "allocator should have several arenas: %v", before)
+
+	translate, compactErr := target.Compact()
+	failOnError(t, compactErr)
+	after := target.Metrics()
+	assert(after.CountOfOnHeapAllocations == before.CountOfOnHeapAllocations+1, "unexpected metrics: %v", after)
+	// moved arenas can be padded to keep values aligned
+	maxUsedBytes := before.UsedBytes + before.CountOfOnHeapAllocations*alignment
+	assert(after.UsedBytes < maxUsedBytes, "unexpected metrics: %v; before: %v", after, before)
+	assert(after.AvailableBytes < before.AvailableBytes, "wasted tails shouldn't be moved: %v; before: %v", after, before)
+	s.checkPanics(func() { target.ToRef(head) })
+
+	// pointers stored inside of the allocator are migrated during the first traversal
+	for round := 0; round < 2; round++ {
+		ptr := translate(head)
+		for i := count - 1; i >= 0; i-- {
+			node := (*dumpedNode)(target.ToRef(ptr))
+			if round == 0 {
+				node.next = translate(node.next)
+				node.name = translate.Bytes(node.name)
+			}
+			assert(node.value == i, "unexpected value: %v; expected: %v", node.value, i)
+			name := view.BytesToStringRef(node.name)
+			assert(name == fmt.Sprintf("node-%v", i), "unexpected name: %v; idx: %v", name, i)
+			ptr = node.next
+		}
+		assert(ptr == arena.Ptr{}, "list should end with empty ptr: %v", ptr)
+	}
+	for i, alignedPtr := range alignedPtrs {
+		ref := target.ToRef(translate(alignedPtr))
+		assert(uintptr(ref)%alignment == 0, "value should stay aligned: %v", ref)
+		assert(*(*int)(ref) == i*100, "unexpected value: %v; expected: %v", *(*int)(ref), i*100)
+	}
+
+	// compacted allocator can continue allocations without overwriting moved values
+	extra, allocErr := view.MakeBytes(64 * 1024)
+	failOnError(t, allocErr)
+	for i, b := range view.BytesToRef(extra) {
+		assert(b == 0, "new allocation should be clear. idx: %v", i)
+	}
+	assert((*dumpedNode)(target.ToRef(translate(head))).value == count-1, "moved value shouldn't be overwritten")
+	fresh, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	s.checkPanics(func() { translate(fresh) })
+}
+
+func (s *arenaCompactCheckingStand) checkPanics(f func()) {
+	defer func() {
+		assert(recover() != nil, "ptr should be rejected after Compact")
+	}()
+	f()
+}
+
+func TestDynamicArenaCompact(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCompactCheckingStand{}
+	stand.check(t, arena.NewDynamicAllocator())
+
+	a := arena.NewDynamicAllocator()
+	p, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	translate, compactErr := a.Compact()
+	failOnError(t, compactErr)
+	assert(translate(p) == p, "single arena shouldn't be compacted: %v", translate(p))
+	assert(a.Metrics().CountOfOnHeapAllocations == 1, "unexpected metrics: %v", a.Metrics())
+}
+
+func TestGenericArenaCompact(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCompactCheckingStand{}
+	stand.check(t, arena.NewGenericAllocator(arena.Options{}))
+	stand.check(t, arena.NewSubAllocator(nil, arena.Options{}))
+
+	sub := arena.NewSubAllocator(arena.NewDynamicAllocator(), arena.Options{})
+	_, compactErr := sub.Compact()
+	assert(compactErr == arena.UnsupportedOperationError, "shared target shouldn't be compacted: %v", compactErr)
+}
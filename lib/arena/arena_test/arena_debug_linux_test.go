@@ -0,0 +1,77 @@
+//go:build arenadebug && linux
+// +build arenadebug,linux
+
+package arena_test
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaProtectedMemoryCheckingStand struct{}
+
+func (s *arenaProtectedMemoryCheckingStand) check(t *testing.T, target allocator) {
+	view := arena.NewBytesView(target)
+	bytes, allocErr := view.Embed([]byte("data before Clear"))
+	failOnError(t, allocErr)
+	bytesRef := view.BytesToRef(bytes)
+	strRef := view.BytesToStringRef(bytes)
+	ptr, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	intRef := (*int64)(target.ToRef(ptr))
+	*intRef = 42
+
+	target.Clear()
+
+	s.checkFaults(func() { assert(bytesRef[0] == 'd', "unexpected content: %v", bytesRef[0]) })
+	s.checkFaults(func() { bytesRef[1] = 'a' })
+	s.checkFaults(func() { assert(strings.ToUpper(strRef) != "", "unexpected content") })
+	s.checkFaults(func() { *intRef++ })
+
+	newBytes, allocErr := view.MakeBytes(512)
+	failOnError(t, allocErr)
+	for _, b := range view.BytesToRef(newBytes) {
+		assert(b == 0, "new allocations should be zeroed")
+	}
+}
+
+func (s *arenaProtectedMemoryCheckingStand) checkFaults(f func()) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		faultPanic := recover()
+		runtimeErr, ok := faultPanic.(runtime.Error)
+		assert(ok, "access to protected memory should fault: %v", faultPanic)
+		assert(
+			strings.Contains(runtimeErr.Error(), "invalid memory address"),
+			"unexpected fault: %v", runtimeErr,
+		)
+	}()
+	f()
+}
+
+func TestProtectedMemoryAfterClear(t *testing.T) {
+	t.Parallel()
+	stand := &arenaProtectedMemoryCheckingStand{}
+	stand.check(t, arena.NewRawAllocator(1024))
+	stand.check(t, arena.NewDynamicAllocator())
+	stand.check(t, &arena.GenericAllocator{})
+	stand.check(t, arena.NewGenericAllocator(arena.Options{InitialCapacity: 1024}))
+	stand.check(t, arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}))
+	stand.check(t, arena.NewSubAllocator(nil, arena.Options{}))
+}
+
+func TestProtectedMemoryAfterClose(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{})
+	ptr, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	ref := (*int64)(a.ToRef(ptr))
+	a.Close()
+
+	stand := &arenaProtectedMemoryCheckingStand{}
+	stand.checkFaults(func() { *ref = 42 })
+}
@@ -0,0 +1,229 @@
+package arena_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type dumpedNode struct {
+	value int
+	name  arena.Bytes
+	next  arena.Ptr
+}
+
+type dumpableAllocator interface {
+	allocator
+	io.WriterTo
+	io.ReaderFrom
+}
+
+// dump header consists of magic, version, kind, size of arena.Ptr, arena mask, allocator ID and generation
+const dynamicDumpHeaderSize = 4 + 2 + 2 + 2 + 2 + 4 + 8
+
+// generic dump header is followed by its metrics and the dump of the dynamic target
+const genericDumpHeaderSize = dynamicDumpHeaderSize + 8 + 8 + dynamicDumpHeaderSize
+
+type arenaDumpCheckingStand struct{}
+
+func (s *arenaDumpCheckingStand) check(t *testing.T, target dumpableAllocator, restored dumpableAllocator) {
+	const count = 10000
+	view := arena.NewBytesView(target)
+	head := arena.Ptr{}
+	for i := 0; i < count; i++ {
+		nodePtr, allocErr := target.Alloc(unsafe.Sizeof(dumpedNode{}), unsafe.Alignof(dumpedNode{}))
+		failOnError(t, allocErr)
+		name, allocErr := view.Embed([]byte(fmt.Sprintf("node-%v", i)))
+		failOnError(t, allocErr)
+		node := (*dumpedNode)(target.ToRef(nodePtr))
+		node.value = i
+		node.name = name
+		node.next = head
+		head = nodePtr
+	}
+	assert(target.Metrics().CountOfOnHeapAllocations > 1, "dump should contain several arenas: %v", target.Metrics())
+
+	dump := &bytes.Buffer{}
+	written, writeErr := target.WriteTo(dump)
+	failOnError(t, writeErr)
+	assert(int(written) == dump.Len(), "unexpected written bytes: %v; dump: %v", written, dump.Len())
+	assert(dump.Len() < target.Metrics().UsedBytes+1024, "unused capacity shouldn't be dumped: %v", dump.Len())
+
+	read, readErr := restored.ReadFrom(bytes.NewReader(dump.Bytes()))
+	failOnError(t, readErr)
+	assert(read == written, "unexpected read bytes: %v; written: %v", read, written)
+	// padding of allocations that caused growth is counted in the dumped arena, but not in the restored one
+	restoredMetrics, expectedMetrics := restored.Metrics(), target.Metrics()
+	assert(
+		restoredMetrics.UsedBytes <= expectedMetrics.UsedBytes && restoredMetrics.UsedBytes > expectedMetrics.UsedBytes-1024,
+		"unexpected metrics: %v; expected: %v", restoredMetrics, expectedMetrics,
+	)
+	// restored arenas fit only used regions of the dumped ones
+	assert(
+		restoredMetrics.AllocatedBytes <= expectedMetrics.AllocatedBytes,
+		"unexpected metrics: %v; expected: %v", restoredMetrics, expectedMetrics,
+	)
+
+	// pointers issued by the dumped allocator and stored inside of it are valid for the restored one
+	target.Clear()
+	restoredView := arena.NewBytesView(restored)
+	ptr := head
+	for i := count - 1; i >= 0; i-- {
+		node := (*dumpedNode)(restored.ToRef(ptr))
+		assert(node.value == i, "unexpected value: %v; expected: %v", node.value, i)
+		name := restoredView.BytesToStringRef(node.name)
+		assert(name == fmt.Sprintf("node-%v", i), "unexpected name: %v; idx: %v", name, i)
+		ptr = node.next
+	}
+	assert(ptr == arena.Ptr{}, "list should end with empty ptr: %v", ptr)
+
+	// restored allocator can continue allocations without overwriting restored values
+	extra, allocErr := restoredView.MakeBytes(64 * 1024)
+	failOnError(t, allocErr)
+	for i, b := range restoredView.BytesToRef(extra) {
+		assert(b == 0, "new allocation should be clear. idx: %v", i)
+	}
+	assert((*dumpedNode)(restored.ToRef(head)).value == count-1, "restored value shouldn't be overwritten")
+
+	restored.Clear()
+	s.checkPanics(func() { restored.ToRef(head) })
+}
+
+func (s *arenaDumpCheckingStand) checkInvalidDumps(t *testing.T, target dumpableAllocator) {
+	_, allocErr := target.Alloc(1024, 8)
+	failOnError(t, allocErr)
+	dump := &bytes.Buffer{}
+	_, writeErr := target.WriteTo(dump)
+	failOnError(t, writeErr)
+
+	_, readErr := target.ReadFrom(bytes.NewReader(dump.Bytes()[:dump.Len()-1]))
+	assert(readErr == io.ErrUnexpectedEOF, "truncated dump should be detected: %v", readErr)
+	assert(target.Metrics().UsedBytes == 0, "allocator should be cleared: %v", target.Metrics())
+
+	corrupted := append([]byte{}, dump.Bytes()...)
+	corrupted[0]++
+	_, readErr = target.ReadFrom(bytes.NewReader(corrupted))
+	assert(readErr == arena.InvalidDumpError, "corrupted dump should be detected: %v", readErr)
+
+	_, readErr = target.ReadFrom(bytes.NewReader(nil))
+	assert(readErr == io.EOF, "empty dump should be detected: %v", readErr)
+}
+
+// checkCompactAfterLoad checks that values stay aligned when restored arenas are compacted.
+func (s *arenaDumpCheckingStand) checkCompactAfterLoad(t *testing.T, target dumpableAllocator, restored dumpableAllocator) {
+	const count = 200000
+	ptrs := make([]arena.Ptr, 0, count)
+	for i := 0; i < count; i++ {
+		// unaligned allocations between values make padding of the next ones
+		_, allocErr := target.AllocUnaligned(1)
+		failOnError(t, allocErr)
+		p, allocErr := target.Alloc(8, 8)
+		failOnError(t, allocErr)
+		ptrs = append(ptrs, p)
+	}
+	assert(target.Metrics().CountOfOnHeapAllocations > 1, "dump should contain several arenas: %v", target.Metrics())
+
+	dump := &bytes.Buffer{}
+	_, writeErr := target.WriteTo(dump)
+	failOnError(t, writeErr)
+	_, readErr := restored.ReadFrom(dump)
+	failOnError(t, readErr)
+	translate, compactErr := restored.(compactableAllocator).Compact()
+	failOnError(t, compactErr)
+	for i, p := range ptrs {
+		ref := uintptr(restored.ToRef(translate(p)))
+		assert(ref%8 == 0, "value should stay aligned after Compact: %#x; idx: %v", ref, i)
+	}
+	target.Clear()
+	restored.Clear()
+}
+
+// checkHostileDump checks that sizes declared by a dump are not trusted until its content is read.
+func (s *arenaDumpCheckingStand) checkHostileDump(t *testing.T, target dumpableAllocator, headerSize int) {
+	_, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	dump := &bytes.Buffer{}
+	_, writeErr := target.WriteTo(dump)
+	failOnError(t, writeErr)
+
+	// 256 arenas of almost 4GB each, but without any content
+	hostile := append([]byte{}, dump.Bytes()[:headerSize]...)
+	hostile = append(hostile, 8, 0, 0, 0, 0, 0, 0, 0, 0, 1)
+	for i := 0; i < 256; i++ {
+		hostile = append(hostile, 0, 0, 0, 0xf0)
+	}
+	_, readErr := target.ReadFrom(bytes.NewReader(hostile))
+	assert(readErr == io.EOF, "truncated dump should be detected: %v", readErr)
+	assert(target.Metrics().AllocatedBytes < 1024*1024, "unexpected allocations: %v", target.Metrics())
+	target.Clear()
+}
+
+func (s *arenaDumpCheckingStand) checkPanics(f func()) {
+	defer func() {
+		assert(recover() != nil, "ptr should be rejected after Clear")
+	}()
+	f()
+}
+
+func TestDynamicArenaDump(t *testing.T) {
+	t.Parallel()
+	stand := &arenaDumpCheckingStand{}
+	stand.check(t, arena.NewDynamicAllocator(), arena.NewDynamicAllocator())
+	stand.checkInvalidDumps(t, arena.NewDynamicAllocator())
+	stand.checkCompactAfterLoad(t, arena.NewDynamicAllocator(), arena.NewDynamicAllocator())
+	stand.checkHostileDump(t, arena.NewDynamicAllocator(), dynamicDumpHeaderSize)
+
+	limited := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{CapacityLimitInBytes: 1024 * 1024})
+	unlimited := arena.NewDynamicAllocator()
+	_, allocErr := unlimited.Alloc(2*1024*1024, 8)
+	failOnError(t, allocErr)
+	dump := &bytes.Buffer{}
+	_, writeErr := unlimited.WriteTo(dump)
+	failOnError(t, writeErr)
+	_, readErr := limited.ReadFrom(dump)
+	assert(readErr == arena.AllocationLimitError, "capacity limit should be checked: %v", readErr)
+	assert(limited.Metrics().AllocatedBytes == 0, "nothing should be allocated: %v", limited.Metrics())
+}
+
+func TestGenericArenaDump(t *testing.T) {
+	t.Parallel()
+	stand := &arenaDumpCheckingStand{}
+	stand.check(t, arena.NewGenericAllocator(arena.Options{}), arena.NewGenericAllocator(arena.Options{}))
+	stand.check(t, arena.NewSubAllocator(nil, arena.Options{}), arena.NewSubAllocator(nil, arena.Options{}))
+	stand.checkInvalidDumps(t, arena.NewGenericAllocator(arena.Options{}))
+	stand.checkCompactAfterLoad(t, arena.NewGenericAllocator(arena.Options{}), arena.NewGenericAllocator(arena.Options{}))
+	stand.checkHostileDump(t, arena.NewGenericAllocator(arena.Options{}), genericDumpHeaderSize)
+
+	target := arena.NewGenericAllocator(arena.Options{})
+	_, allocErr := target.Alloc(1024, 8)
+	failOnError(t, allocErr)
+	dump := &bytes.Buffer{}
+	_, writeErr := target.WriteTo(dump)
+	failOnError(t, writeErr)
+	expectedMetrics := target.EnhancedMetrics()
+
+	restored := arena.NewGenericAllocator(arena.Options{})
+	_, readErr := restored.ReadFrom(bytes.NewReader(dump.Bytes()))
+	failOnError(t, readErr)
+	metrics := restored.EnhancedMetrics()
+	assert(metrics.DataBytes == expectedMetrics.DataBytes, "unexpected metrics: %v; expected: %v", metrics, expectedMetrics)
+	assert(metrics.CountOfAllocations == 1, "unexpected metrics: %v", metrics)
+
+	limited := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 512})
+	_, readErr = limited.ReadFrom(bytes.NewReader(dump.Bytes()))
+	assert(readErr == arena.AllocationLimitError, "limit should be checked: %v", readErr)
+	assert(limited.Metrics().UsedBytes == 0, "allocator should be cleared: %v", limited.Metrics())
+
+	_, readErr = arena.NewDynamicAllocator().ReadFrom(bytes.NewReader(dump.Bytes()))
+	assert(readErr == arena.InvalidDumpError, "dump of another allocator should be rejected: %v", readErr)
+
+	sub := arena.NewSubAllocator(target, arena.Options{})
+	_, writeErr = sub.WriteTo(&bytes.Buffer{})
+	assert(writeErr == arena.UnsupportedOperationError, "shared target shouldn't be dumped: %v", writeErr)
+	_, readErr = sub.ReadFrom(bytes.NewReader(dump.Bytes()))
+	assert(readErr == arena.UnsupportedOperationError, "shared target shouldn't be restored: %v", readErr)
+}
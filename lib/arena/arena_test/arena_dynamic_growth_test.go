@@ -113,3 +113,100 @@ func genRandomAlignment() uintptr {
 	i := rand.Intn(3)
 	return alignments[i]
 }
+
+type arenaGrowthStrategyStand struct{}
+
+// arenaSizes allocates chunks until the allocator grows the specified count of times
+// and returns sizes of arenas allocated on each growth.
+func (s *arenaGrowthStrategyStand) arenaSizes(t *testing.T, target allocator, chunkSize uintptr, growths int) []int {
+	result := make([]int, 0, growths)
+	allocatedBytes := target.Metrics().AllocatedBytes
+	for len(result) < growths {
+		_, allocErr := target.Alloc(chunkSize, 1)
+		failOnError(t, allocErr)
+		if target.Metrics().AllocatedBytes != allocatedBytes {
+			result = append(result, target.Metrics().AllocatedBytes-allocatedBytes)
+			allocatedBytes = target.Metrics().AllocatedBytes
+		}
+	}
+	return result
+}
+
+func TestDynamicArenaGrowthStrategies(t *testing.T) {
+	t.Parallel()
+	stand := &arenaGrowthStrategyStand{}
+	growthStand := &arenaDynamicGrowthStand{}
+	strategies := []arena.GrowthStrategy{
+		arena.ExponentialGrowth(16 * 1024 * 1024),
+		arena.LinearGrowth(1024 * 1024),
+		arena.FixedGrowth(4 * 1024 * 1024),
+		func(currentSize int, requiredSize int) int { return currentSize + requiredSize },
+	}
+	for _, strategy := range strategies {
+		growthStand.check(t, arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{GrowthStrategy: strategy}))
+		growthStand.check(t, arena.NewGenericAllocator(arena.Options{GrowthStrategy: strategy}))
+	}
+
+	sizes := stand.arenaSizes(t, arena.NewDynamicAllocator(), 1024, 5)
+	for i := 1; i < len(sizes); i++ {
+		assert(sizes[i] == sizes[i-1]*2, "arenas should be doubled by default: %v", sizes)
+	}
+	capped := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{GrowthStrategy: arena.ExponentialGrowth(1024 * 1024)})
+	sizes = stand.arenaSizes(t, capped, 1024, 10)
+	assert(sizes[len(sizes)-1] == 1024*1024, "arenas should be capped: %v", sizes)
+	linear := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{GrowthStrategy: arena.LinearGrowth(128 * 1024)})
+	sizes = stand.arenaSizes(t, linear, 1024, 5)
+	for i := 1; i < len(sizes); i++ {
+		assert(sizes[i] == sizes[i-1]+128*1024, "arenas should grow linearly: %v", sizes)
+	}
+	fixed := arena.NewGenericAllocator(arena.Options{GrowthStrategy: arena.FixedGrowth(256 * 1024)})
+	sizes = stand.arenaSizes(t, fixed, 1024, 5)
+	for _, size := range sizes {
+		assert(size == 256*1024, "arenas should be of the fixed size: %v", sizes)
+	}
+	sizes = stand.arenaSizes(t, fixed, 512*1024, 1)
+	assert(sizes[0] > 512*1024, "arena should fit the required size: %v", sizes)
+}
+
+func TestDynamicArenaCapacityLimit(t *testing.T) {
+	t.Parallel()
+	const limit = 1024 * 1024
+	targets := []allocator{
+		arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{CapacityLimitInBytes: limit}),
+		arena.NewGenericAllocator(arena.Options{CapacityLimitInBytes: limit, GrowthStrategy: arena.LinearGrowth(64 * 1024)}),
+		arena.NewRegistry(arena.RegistryOptions{}).NewAllocator("limited", arena.Options{CapacityLimitInBytes: limit}),
+	}
+	for _, target := range targets {
+		assert(target.Metrics().MaxCapacity == limit, "unexpected metrics: %v", target.Metrics())
+		var allocErr error
+		for allocErr == nil {
+			_, allocErr = target.Alloc(16*1024, 8)
+		}
+		assert(allocErr == arena.AllocationLimitError, "unexpected error: %v", allocErr)
+		assert(target.Metrics().AllocatedBytes <= limit, "unexpected metrics: %v", target.Metrics())
+		assert(target.Metrics().AllocatedBytes > limit/2, "unexpected metrics: %v", target.Metrics())
+		target.Clear()
+		_, allocErr = target.Alloc(16*1024, 8)
+		failOnError(t, allocErr)
+	}
+}
+
+func TestDynamicArenaBucketsLimit(t *testing.T) {
+	t.Parallel()
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{GrowthStrategy: arena.FixedGrowth(64 * 1024)})
+	var allocErr error
+	var ptrs []arena.Ptr
+	for allocErr == nil {
+		var p arena.Ptr
+		p, allocErr = a.Alloc(60*1024, 8)
+		ptrs = append(ptrs, p)
+	}
+	assert(allocErr == arena.AllocationLimitError, "unexpected error: %v", allocErr)
+	assert(len(ptrs) == 257, "arena.Ptr can address only 256 arenas: %v", len(ptrs))
+	for i, p := range ptrs[:len(ptrs)-1] {
+		*(*int)(a.ToRef(p)) = i
+	}
+	for i, p := range ptrs[:len(ptrs)-1] {
+		assert(*(*int)(a.ToRef(p)) == i, "values shouldn't be overwritten: %v", i)
+	}
+}
@@ -0,0 +1,184 @@
+package arena_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestInstrumentedArena(t *testing.T) {
+	t.Parallel()
+	a := arena.NewInstrumentedAllocator(arena.NewDynamicAllocator())
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+
+	maskStand := &arenaMaskCheckingStand{}
+	maskStand.check(t, a)
+	growthStand := &arenaDynamicGrowthStand{}
+	growthStand.check(t, a)
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, a)
+	bytesBufferAllocationStand := &arenaByteBufferWithErrorAllocationCheckingStand{}
+	bytesBufferAllocationStand.check(t, a)
+	assert(len(a.AllocationSites()) > 0, "allocation sites should be recorded")
+}
+
+func TestSubArenaOverInstrumentedArena(t *testing.T) {
+	t.Parallel()
+	target := arena.NewInstrumentedAllocator(nil)
+	a := arena.NewSubAllocator(target, arena.Options{AllocationLimitInBytes: 2 * requiredBytesForBasicTest})
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	bytesAllocationLimitsStand := &arenaByteAllocationLimitsCheckingStand{}
+	bytesAllocationLimitsStand.check(t, a)
+	assert(len(target.AllocationSites()) > 0, "allocation sites should be recorded")
+}
+
+func TestInstrumentedArenaAllocationSites(t *testing.T) {
+	t.Parallel()
+	a := arena.NewInstrumentedAllocator(arena.NewRawAllocator(1024))
+	for i := 0; i < 3; i++ {
+		allocateFromFirstSite(t, a)
+	}
+	allocateFromSecondSite(t, a)
+	_, allocErr := a.Alloc(2048, 1)
+	assert(allocErr == arena.AllocationLimitError, "allocation limit should be triggered")
+
+	sites := a.AllocationSites()
+	assert(len(sites) == 2, "expected two allocation sites: %v", sites)
+	assert(sites[0].CountOfAllocations == 3, "unexpected first site: %v", sites[0])
+	assert(sites[0].DataBytes == 3*64, "unexpected first site: %v", sites[0])
+	assert(sites[1].CountOfAllocations == 1, "unexpected second site: %v", sites[1])
+	assert(sites[1].DataBytes == 8, "unexpected second site: %v", sites[1])
+	assert(sites[1].PaddingOverhead <= 7, "unexpected second site: %v", sites[1])
+	assert(strings.Contains(sites[0].String(), "allocateFromFirstSite"), "unexpected caller: %v", sites[0])
+	assert(strings.Contains(sites[1].String(), "allocateFromSecondSite"), "unexpected caller: %v", sites[1])
+
+	a.Clear()
+	assert(len(a.AllocationSites()) == 2, "allocation sites should survive Clear")
+	a.ResetProfile()
+	assert(len(a.AllocationSites()) == 0, "allocation sites should be reset")
+}
+
+func TestInstrumentedArenaProfile(t *testing.T) {
+	t.Parallel()
+	a := arena.NewInstrumentedAllocator(nil)
+	for i := 0; i < 3; i++ {
+		allocateFromFirstSite(t, a)
+	}
+	allocateFromSecondSite(t, a)
+
+	profile := readProfileWithPprof(t, a)
+	assert(
+		profile.sampleTypes == "alloc_objects/count alloc_space/bytes[dflt] padding_space/bytes",
+		"unexpected sample types: %v", profile.sampleTypes,
+	)
+	assert(len(profile.samples) == 2, "expected two samples: %+v", profile.samples)
+	for _, sample := range profile.samples {
+		assert(len(sample.values) == 3, "unexpected sample: %+v", sample)
+		assert(len(sample.functions) > 0, "sample should have locations: %+v", sample)
+		switch leaf := sample.functions[0]; {
+		case strings.HasSuffix(leaf, ".allocateFromFirstSite"):
+			assert(sample.values[0] == 3 && sample.values[1] == 3*64, "unexpected first site: %+v", sample)
+			assert(sample.values[2] == 0, "unaligned allocations have no padding: %+v", sample)
+		case strings.HasSuffix(leaf, ".allocateFromSecondSite"):
+			assert(sample.values[0] == 1 && sample.values[1] == 8, "unexpected second site: %+v", sample)
+			assert(sample.values[2] <= 7, "unexpected padding: %+v", sample)
+		default:
+			t.Fatalf("unexpected leaf location: %+v", sample)
+		}
+		assert(
+			strings.HasSuffix(sample.functions[1], ".TestInstrumentedArenaProfile"),
+			"unexpected caller location: %+v", sample,
+		)
+	}
+}
+
+type pprofSample struct {
+	values    []int64
+	functions []string // from the leaf to the root
+}
+
+type pprofProfile struct {
+	sampleTypes string
+	samples     []pprofSample
+}
+
+// readProfileWithPprof writes the profile to a file and parses `go tool pprof -raw` output,
+// so the profile is decoded by the same tool that is used to analyze it.
+func readProfileWithPprof(t *testing.T, a *arena.InstrumentedAllocator) pprofProfile {
+	goExecutable := filepath.Join(runtime.GOROOT(), "bin", "go")
+	if _, statErr := os.Stat(goExecutable); statErr != nil {
+		t.Skipf("go tool isn't available: %v", statErr)
+	}
+	profileFile, createErr := ioutil.TempFile("", "arena_profile")
+	failOnError(t, createErr)
+	defer func() { _ = os.Remove(profileFile.Name()) }()
+	failOnError(t, a.WriteProfile(profileFile))
+	failOnError(t, profileFile.Close())
+
+	output, pprofErr := exec.Command(goExecutable, "tool", "pprof", "-raw", profileFile.Name()).CombinedOutput()
+	if pprofErr != nil {
+		t.Fatalf("can't read profile with pprof: %v\n%s", pprofErr, output)
+	}
+
+	var result pprofProfile
+	var sampleLocations [][]string
+	locations := make(map[string]string)
+	section := ""
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case line == "Samples:" || line == "Locations" || line == "Mappings":
+			section = line
+		case strings.TrimSpace(line) == "":
+		case section == "Samples:" && result.sampleTypes == "":
+			result.sampleTypes = strings.TrimSpace(line)
+		case section == "Samples:":
+			parts := strings.SplitN(line, ":", 2)
+			assert(len(parts) == 2, "unexpected sample line: %v", line)
+			var sample pprofSample
+			for _, value := range strings.Fields(parts[0]) {
+				parsed, parseErr := strconv.ParseInt(value, 10, 64)
+				failOnError(t, parseErr)
+				sample.values = append(sample.values, parsed)
+			}
+			result.samples = append(result.samples, sample)
+			sampleLocations = append(sampleLocations, strings.Fields(parts[1]))
+		case section == "Locations":
+			// `id: address M=mapping function file:line:column s=start`
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && strings.HasSuffix(fields[0], ":") {
+				locations[strings.TrimSuffix(fields[0], ":")] = fields[3]
+			}
+		}
+	}
+	for i, locationIDs := range sampleLocations {
+		for _, id := range locationIDs {
+			function, ok := locations[id]
+			assert(ok, "unknown location %v in pprof output:\n%s", id, output)
+			result.samples[i].functions = append(result.samples[i].functions, function)
+		}
+	}
+	return result
+}
+
+//go:noinline
+func allocateFromFirstSite(t *testing.T, a allocator) {
+	_, allocErr := a.AllocUnaligned(64)
+	failOnError(t, allocErr)
+	runtime.KeepAlive(a)
+}
+
+//go:noinline
+func allocateFromSecondSite(t *testing.T, a allocator) {
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	runtime.KeepAlive(a)
+}
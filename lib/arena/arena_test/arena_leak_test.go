@@ -0,0 +1,119 @@
+package arena_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestLeakDetectorReportsCollectedAllocators(t *testing.T) {
+	t.Parallel()
+	detector := arena.NewGenericLeakDetector(arena.GenericLeakDetectorOptions{})
+	createLeakedAllocator(t, detector)
+	createClearedAllocator(t, detector)
+	createClosedAllocator(t, detector)
+
+	leaks := detector.CollectLeaks()
+	assert(len(leaks) == 1, "expected one leak: %v", leaks)
+	assert(leaks[0].Kind == arena.LeakCollectedWithoutRelease, "unexpected leak kind: %v", leaks[0])
+	assert(strings.Contains(leaks[0].String(), "createLeakedAllocator"), "unexpected creation stack: %v", leaks[0])
+	assert(detector.CountOfTrackedAllocators() == 0, "all allocators should be collected")
+	assert(len(detector.CollectLeaks()) == 0, "leaks should be reported only once")
+}
+
+func TestLeakDetectorReportsLongLivedAllocators(t *testing.T) {
+	t.Parallel()
+	// lifetime is big enough to not be exceeded by slow GC cycles of CollectLeaks under the race detector
+	const maxLifetime = 200 * time.Millisecond
+	detector := arena.NewGenericLeakDetector(arena.GenericLeakDetectorOptions{MaxLifetime: maxLifetime})
+	longLived := arena.NewGenericAllocator(arena.Options{LeakDetector: detector})
+	shortLived := arena.NewSubAllocator(longLived, arena.Options{LeakDetector: detector})
+	assert(detector.CountOfTrackedAllocators() == 2, "unexpected count: %v", detector.CountOfTrackedAllocators())
+	shortLived.Close()
+	detector.CheckLifetimes()
+	assert(len(detector.Leaks()) == 0, "allocators are too young to be reported")
+
+	time.Sleep(2 * maxLifetime)
+	leaks := detector.CollectLeaks()
+	assert(len(leaks) == 1, "expected one leak: %v", leaks)
+	assert(leaks[0].Kind == arena.LeakLifetimeExceeded, "unexpected leak kind: %v", leaks[0])
+	assert(leaks[0].Lifetime > maxLifetime, "unexpected lifetime: %v", leaks[0])
+	assert(len(detector.CollectLeaks()) == 0, "leaks should be reported only once")
+
+	longLived.Clear()
+	detector.CheckLifetimes()
+	assert(len(detector.Leaks()) == 0, "Clear should reset lifetime")
+	time.Sleep(2 * maxLifetime)
+	assert(len(detector.CollectLeaks()) == 1, "allocator should be reported again after Clear")
+
+	longLived.Close()
+	time.Sleep(2 * maxLifetime)
+	assert(len(detector.CollectLeaks()) == 0, "closed allocator shouldn't be reported")
+	assert(detector.CountOfTrackedAllocators() == 0, "closed allocators shouldn't be tracked")
+}
+
+func TestLeakDetectorCallback(t *testing.T) {
+	t.Parallel()
+	reportedLeaks := make(chan arena.Leak, 1)
+	detector := arena.NewGenericLeakDetector(arena.GenericLeakDetectorOptions{
+		OnLeak: func(leak arena.Leak) {
+			reportedLeaks <- leak
+		},
+	})
+	createLeakedAllocator(t, detector)
+	assert(len(detector.CollectLeaks()) == 0, "leaks shouldn't be accumulated if callback is specified")
+	leak := <-reportedLeaks
+	assert(leak.Kind == arena.LeakCollectedWithoutRelease, "unexpected leak kind: %v", leak)
+	assert(strings.Contains(leak.String(), "createLeakedAllocator"), "unexpected creation stack: %v", leak)
+}
+
+func TestLeakDetectorTracksOnlySubAllocatorItself(t *testing.T) {
+	t.Parallel()
+	detector := arena.NewGenericLeakDetector(arena.GenericLeakDetectorOptions{})
+	a := arena.NewSubAllocator(nil, arena.Options{LeakDetector: detector})
+	assert(detector.CountOfTrackedAllocators() == 1, "unexpected count: %v", detector.CountOfTrackedAllocators())
+	a.Close()
+	assert(len(detector.CollectLeaks()) == 0, "closed allocator shouldn't be reported")
+}
+
+func TestLeakDetectorTracksWrappedAllocators(t *testing.T) {
+	t.Parallel()
+	detector := arena.NewGenericLeakDetector(arena.GenericLeakDetectorOptions{})
+	createLeakedWrappedAllocator(t, detector)
+
+	leaks := detector.CollectLeaks()
+	assert(len(leaks) == 1, "expected one leak: %v", leaks)
+	assert(strings.Contains(leaks[0].String(), "createLeakedWrappedAllocator"), "unexpected creation stack: %v", leaks[0])
+}
+
+//go:noinline
+func createLeakedWrappedAllocator(t *testing.T, detector *arena.GenericLeakDetector) {
+	a := arena.NewSubAllocator(arena.NewDynamicAllocator(), arena.Options{LeakDetector: detector})
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+}
+
+//go:noinline
+func createLeakedAllocator(t *testing.T, detector *arena.GenericLeakDetector) {
+	a := arena.NewGenericAllocator(arena.Options{LeakDetector: detector})
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+}
+
+//go:noinline
+func createClearedAllocator(t *testing.T, detector *arena.GenericLeakDetector) {
+	a := arena.NewGenericAllocator(arena.Options{LeakDetector: detector})
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	a.Clear()
+}
+
+//go:noinline
+func createClosedAllocator(t *testing.T, detector *arena.GenericLeakDetector) {
+	a := arena.NewGenericAllocator(arena.Options{LeakDetector: detector})
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	a.Close()
+}
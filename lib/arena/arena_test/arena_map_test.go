@@ -0,0 +1,149 @@
+package arena_test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaMapCheckingStand struct{}
+
+func (s *arenaMapCheckingStand) check(t *testing.T, target allocator) {
+	m, allocErr := arena.NewMap(target)
+	failOnError(t, allocErr)
+	assert(m.Len() == 0, "new map should be empty: %v", m)
+
+	const count = 10000
+	expected := make(map[string]string, count)
+	for i := 0; i < count; i++ {
+		key := "key:" + strconv.Itoa(i)
+		value := "value:" + strconv.Itoa(i*i)
+		failOnError(t, m.Put([]byte(key), []byte(value)))
+		expected[key] = value
+	}
+	s.checkContent(t, m, expected)
+
+	for i := 0; i < count; i += 3 {
+		key := "key:" + strconv.Itoa(i)
+		assert(m.Delete([]byte(key)), "key should be deleted: %v", key)
+		assert(!m.Delete([]byte(key)), "key should be already deleted: %v", key)
+		delete(expected, key)
+	}
+	s.checkContent(t, m, expected)
+
+	for i := 0; i < count; i += 5 {
+		key := "key:" + strconv.Itoa(i)
+		value := strconv.Itoa(i)
+		if i%2 == 0 {
+			value = "very long replacement value:" + strconv.Itoa(i)
+		}
+		failOnError(t, m.Put([]byte(key), []byte(value)))
+		expected[key] = value
+	}
+	s.checkContent(t, m, expected)
+
+	{
+		failOnError(t, m.Put(nil, []byte("empty key")))
+		value, ok := m.Get([]byte{})
+		assert(ok, "empty key should be present")
+		assert(string(value) == "empty key", "unexpected value: %v", string(value))
+		assert(m.Delete(nil), "empty key should be deleted")
+	}
+
+	iterations := 0
+	m.Range(func(key []byte, value []byte) bool {
+		iterations++
+		return iterations < 10
+	})
+	assert(iterations == 10, "range should be stopped: %v", iterations)
+	t.Logf("map state: %v; allocator: %v", m, target.Metrics())
+}
+
+func (s *arenaMapCheckingStand) checkContent(t *testing.T, m *arena.Map, expected map[string]string) {
+	assert(m.Len() == len(expected), "unexpected map len: %v; expected: %v", m.Len(), len(expected))
+	for key, value := range expected {
+		actual, ok := m.Get([]byte(key))
+		assert(ok, "key should be present: %v", key)
+		assert(bytes.Equal(actual, []byte(value)), "unexpected value: %v; expected %v", string(actual), value)
+	}
+	_, ok := m.Get([]byte("absent key"))
+	assert(!ok, "absent key shouldn't be present")
+
+	seen := make(map[string]struct{}, len(expected))
+	m.Range(func(key []byte, value []byte) bool {
+		expectedValue, ok := expected[string(key)]
+		assert(ok, "unexpected key: %v", string(key))
+		assert(expectedValue == string(value), "unexpected value: %v; expected %v", string(value), expectedValue)
+		seen[string(key)] = struct{}{}
+		return true
+	})
+	assert(len(seen) == len(expected), "range should visit all keys: %v; expected: %v", len(seen), len(expected))
+}
+
+func TestMapOnDifferentAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaMapCheckingStand{}
+	stand.check(t, &arena.GenericAllocator{})
+	stand.check(t, arena.NewGenericAllocator(arena.Options{InitialCapacity: requiredBytesForBasicTest}))
+	stand.check(t, arena.NewDynamicAllocator())
+	stand.check(t, arena.NewRawAllocator(4*1024*1024))
+	stand.check(t, arena.NewSubAllocator(arena.NewDynamicAllocator(), arena.Options{}))
+}
+
+func TestMapOnUninitializedAllocator(t *testing.T) {
+	t.Parallel()
+	m, allocErr := arena.NewMap(nil)
+	failOnError(t, allocErr)
+	failOnError(t, m.Put([]byte("key"), []byte("value")))
+	value, ok := m.Get([]byte("key"))
+	assert(ok && string(value) == "value", "unexpected value: %v", string(value))
+}
+
+func TestMapAllocationLimit(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 16 * 1024})
+	m, allocErr := arena.NewMap(a)
+	failOnError(t, allocErr)
+
+	inserted := 0
+	for {
+		putErr := m.Put([]byte("key:"+strconv.Itoa(inserted)), []byte("value"))
+		if putErr != nil {
+			assert(putErr == arena.AllocationLimitError, "unexpected error: %v", putErr)
+			break
+		}
+		inserted++
+	}
+	assert(m.Len() == inserted, "map should stay consistent: %v; inserted: %v", m.Len(), inserted)
+	for i := 0; i < inserted; i++ {
+		_, ok := m.Get([]byte("key:" + strconv.Itoa(i)))
+		assert(ok, "key should be present: %v", i)
+	}
+
+	_, allocErr = arena.NewMap(arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 8}))
+	assert(allocErr == arena.AllocationLimitError, "allocation limit should be triggered")
+}
+
+func TestMapIsInvalidAfterClear(t *testing.T) {
+	t.Parallel()
+	targets := []allocator{
+		&arena.GenericAllocator{},
+		arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}),
+		arena.NewDynamicAllocator(),
+	}
+	for _, target := range targets {
+		m, allocErr := arena.NewMap(target)
+		failOnError(t, allocErr)
+		failOnError(t, m.Put([]byte("key"), []byte("value")))
+		target.Clear()
+		func() {
+			defer func() {
+				clearedArenaPanic := recover()
+				assert(clearedArenaPanic != nil, "map usage after Clear should trigger panic")
+			}()
+			m.Get([]byte("key"))
+		}()
+	}
+}
@@ -0,0 +1,108 @@
+package arena_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+	"github.com/storozhukBM/allocator/lib/arena/arenametrics"
+)
+
+func TestMetricsExporterPrometheusFormat(t *testing.T) {
+	t.Parallel()
+	generic := arena.NewGenericAllocator(arena.Options{})
+	_, allocErr := generic.Alloc(3, 1)
+	failOnError(t, allocErr)
+	_, allocErr = generic.Alloc(8, 8)
+	failOnError(t, allocErr)
+	dynamic := arena.NewDynamicAllocator()
+	_, allocErr = dynamic.Alloc(16, 8)
+	failOnError(t, allocErr)
+
+	exporter := arenametrics.NewExporter()
+	failOnError(t, exporter.Register("generic", generic))
+	failOnError(t, exporter.Register(`dyn"amic`, dynamic))
+	registerErr := exporter.Register("generic", dynamic)
+	assert(registerErr == arenametrics.AlreadyRegisteredError, "unexpected error: %v", registerErr)
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	contentType := recorder.Header().Get("Content-Type")
+	assert(strings.HasPrefix(contentType, "text/plain; version=0.0.4"), "unexpected content type: %v", contentType)
+	samples := parsePrometheusSamples(t, recorder.Body.String())
+
+	genericMetrics := generic.EnhancedMetrics()
+	expectedSamples := map[string]int{
+		`arena_used_bytes{allocator="generic"}`:             genericMetrics.UsedBytes,
+		`arena_allocated_bytes{allocator="generic"}`:        genericMetrics.AllocatedBytes,
+		`arena_on_heap_allocations{allocator="generic"}`:    genericMetrics.CountOfOnHeapAllocations,
+		`arena_available_bytes{allocator="generic"}`:        genericMetrics.AvailableBytes,
+		`arena_retained_bytes{allocator="generic"}`:         genericMetrics.RetainedBytes,
+		`arena_pending_dirty_bytes{allocator="generic"}`:    genericMetrics.PendingDirtyBytes,
+		`arena_padding_overhead_bytes{allocator="generic"}`: genericMetrics.PaddingOverhead,
+		`arena_data_bytes{allocator="generic"}`:             genericMetrics.DataBytes,
+		`arena_free_list_bytes{allocator="generic"}`:        genericMetrics.FreeListBytes,
+		`arena_fragmentation_bytes{allocator="generic"}`:    genericMetrics.FragmentationBytes,
+		`arena_allocations{allocator="generic"}`:            genericMetrics.CountOfAllocations,
+		`arena_used_bytes{allocator="dyn\"amic"}`:           dynamic.Stats().UsedBytes,
+		`arena_allocated_bytes{allocator="dyn\"amic"}`:      dynamic.Stats().AllocatedBytes,
+		`arena_on_heap_allocations{allocator="dyn\"amic"}`:  dynamic.Stats().CountOfOnHeapAllocations,
+		`arena_available_bytes{allocator="dyn\"amic"}`:      dynamic.Metrics().AvailableBytes,
+		`arena_retained_bytes{allocator="dyn\"amic"}`:       dynamic.Metrics().RetainedBytes,
+		`arena_pending_dirty_bytes{allocator="dyn\"amic"}`:  dynamic.Metrics().PendingDirtyBytes,
+	}
+	assert(len(samples) == len(expectedSamples), "unexpected samples: %v", samples)
+	for sample, expectedValue := range expectedSamples {
+		value, ok := samples[sample]
+		assert(ok, "sample %v is missing: %v", sample, samples)
+		assert(value == expectedValue, "unexpected sample %v value: %v; expected: %v", sample, value, expectedValue)
+	}
+	assert(genericMetrics.PaddingOverhead == 5, "unexpected metrics: %v", genericMetrics)
+
+	exporter.Unregister("generic")
+	recorder = httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	samples = parsePrometheusSamples(t, recorder.Body.String())
+	assert(len(samples) == 6, "unexpected samples: %v", samples)
+}
+
+func TestMetricsExporterExpvar(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	a := registry.NewAllocator("expvar", arena.Options{})
+	_, allocErr := a.Alloc(1024, 8)
+	failOnError(t, allocErr)
+
+	lock := &sync.Mutex{}
+	exporter := arenametrics.NewExporter()
+	failOnError(t, exporter.Register("registry", registry))
+	failOnError(t, exporter.Register("locked", arenametrics.WithLock(a, lock)))
+
+	snapshot := map[string]map[string]int{}
+	failOnError(t, json.Unmarshal([]byte(exporter.Expvar().String()), &snapshot))
+	assert(snapshot["registry"]["UsedBytes"] == 1024, "unexpected snapshot: %v", snapshot)
+	assert(snapshot["registry"]["AllocatedBytes"] == a.Stats().AllocatedBytes, "unexpected snapshot: %v", snapshot)
+	_, hasEnhancedMetrics := snapshot["registry"]["DataBytes"]
+	assert(!hasEnhancedMetrics, "registry has no enhanced metrics: %v", snapshot)
+	assert(snapshot["locked"]["DataBytes"] == 1024, "unexpected snapshot: %v", snapshot)
+	assert(snapshot["locked"]["CountOfAllocations"] == 1, "unexpected snapshot: %v", snapshot)
+}
+
+func parsePrometheusSamples(t *testing.T, body string) map[string]int {
+	result := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		separatorIdx := strings.LastIndex(line, " ")
+		assert(separatorIdx > 0, "unexpected line: %v", line)
+		value, parseErr := strconv.Atoi(line[separatorIdx+1:])
+		failOnError(t, parseErr)
+		result[line[:separatorIdx]] = value
+	}
+	return result
+}
@@ -0,0 +1,95 @@
+//go:build linux
+// +build linux
+
+package arena_test
+
+import (
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestMmapRawArena(t *testing.T) {
+	t.Parallel()
+
+	a, mmapErr := arena.NewMmapRawAllocator(requiredBytesForBasicTest+8, arena.MmapOptions{})
+	failOnError(t, mmapErr)
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	failOnError(t, a.Release())
+
+	other, mmapErr := arena.NewMmapRawAllocator(requiredBytesForBytesAllocationTest, arena.MmapOptions{HugePages: true})
+	failOnError(t, mmapErr)
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, other)
+	failOnError(t, other.Release())
+
+	_, mmapErr = arena.NewMmapRawAllocator(0, arena.MmapOptions{})
+	assert(mmapErr == arena.AllocationInvalidArgumentError, "unexpected error: %v", mmapErr)
+}
+
+func TestMmapRawArenaClearReleasesPages(t *testing.T) {
+	t.Parallel()
+	const size = 4 * 1024 * 1024
+
+	a, mmapErr := arena.NewMmapRawAllocator(size, arena.MmapOptions{})
+	failOnError(t, mmapErr)
+	defer func() { failOnError(t, a.Release()) }()
+
+	for _, usedBytes := range []int{1024, size / 2, size - 1} {
+		bytesView := arena.NewBytesView(a)
+		buf, allocErr := bytesView.MakeBytes(usedBytes)
+		failOnError(t, allocErr)
+		bytes := bytesView.BytesToRef(buf)
+		for i := range bytes {
+			bytes[i] = byte(i%255 + 1)
+		}
+		a.Clear()
+		assert(a.Stats().UsedBytes == 0, "unexpected stats: %v", a.Stats())
+
+		buf, allocErr = bytesView.MakeBytes(usedBytes)
+		failOnError(t, allocErr)
+		bytes = bytesView.BytesToRef(buf)
+		for i := range bytes {
+			if bytes[i] != 0 {
+				t.Fatalf("memory should be clear after Clear. idx: %v; used: %v", i, usedBytes)
+			}
+		}
+		a.Clear()
+	}
+}
+
+func TestMmapRawArenaRelease(t *testing.T) {
+	t.Parallel()
+
+	a, mmapErr := arena.NewMmapRawAllocator(1024, arena.MmapOptions{})
+	failOnError(t, mmapErr)
+	_, allocErr := a.Alloc(512, 8)
+	failOnError(t, allocErr)
+	assert(a.Stats().AllocatedBytes == 1024, "unexpected stats: %v", a.Stats())
+
+	failOnError(t, a.Release())
+	failOnError(t, a.Release())
+	assert(a.Stats() == arena.Stats{}, "released allocator has no memory: %v", a.Stats())
+	assert(a.Metrics() == arena.Metrics{}, "released allocator has no memory: %v", a.Metrics())
+	for _, size := range []uintptr{0, 1, 512} {
+		_, allocErr = a.Alloc(size, 1)
+		assert(allocErr == arena.AllocationLimitError, "released allocator can't allocate: %v", allocErr)
+		_, allocErr = a.AllocUnaligned(size)
+		assert(allocErr == arena.AllocationLimitError, "released allocator can't allocate: %v", allocErr)
+	}
+	a.Clear()
+	_, allocErr = a.Alloc(0, 1)
+	assert(allocErr == arena.AllocationLimitError, "released allocator can't allocate after Clear: %v", allocErr)
+}
+
+func TestMmapBuddyArena(t *testing.T) {
+	t.Parallel()
+	a, createErr := arena.NewBuddyAllocator(arena.BuddyOptions{Capacity: 4 * 1024 * 1024, Mmap: &arena.MmapOptions{}})
+	failOnError(t, createErr)
+	stand := &arenaBuddyCheckingStand{}
+	stand.check(t, a, 4*1024, 1024*1024)
+	assert(a.Stats().CountOfOnHeapAllocations == 0, "mmapped region isn't on heap: %v", a.Stats())
+	a.Close()
+	assert(a.String() == "buddyarena{closed}", "unexpected string: %v", a.String())
+}
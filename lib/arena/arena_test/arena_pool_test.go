@@ -0,0 +1,151 @@
+package arena_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type pooledPoint struct {
+	x int
+	y int
+}
+
+func TestArenaPoolReusesAllocators(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: 256 * 1024 * 1024})
+	pool := registry.PoolFor(pooledPoint{})
+	assert(pool == registry.PoolFor(pooledPoint{}), "pool should be the same for the same type")
+	assert(pool != registry.Pool("other"), "pools with different names should be different")
+
+	a := pool.Get()
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	pool.Put(a)
+
+	for i := 0; i < 10; i++ {
+		a := pool.Get()
+		onHeapAllocationsBefore := a.Stats().CountOfOnHeapAllocations
+		bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+		bytesAllocationStand.check(t, a)
+		assert(
+			a.Stats().CountOfOnHeapAllocations == onHeapAllocationsBefore,
+			"pooled allocator shouldn't allocate on heap: %v", a.Stats(),
+		)
+		pool.Put(a)
+	}
+
+	stats := pool.Stats()
+	assert(stats.Hits == 10, "unexpected pool stats: %v", stats)
+	assert(stats.Misses == 1, "unexpected pool stats: %v", stats)
+	assert(stats.Discarded == 0, "unexpected pool stats: %v", stats)
+	assert(stats.IdleAllocators == 1, "unexpected pool stats: %v", stats)
+	assert(stats.PeakUsedBytes > 0, "unexpected pool stats: %v", stats)
+
+	poolsStats := registry.PoolsStats()
+	assert(len(poolsStats) == 2, "unexpected pools stats: %v", poolsStats)
+	assert(poolsStats[0] == stats, "unexpected pools stats: %v; expected: %v", poolsStats, stats)
+	assert(registry.Metrics().AllocatedBytes > 0, "idle allocators should keep the budget: %v", registry.Metrics())
+}
+
+func TestArenaPoolPreWarmsAllocatorsFromPeakUsage(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	pool := registry.Pool("prewarm")
+	const peakUsage = 512 * 1024
+
+	first := pool.Get()
+	assert(first.Stats().AllocatedBytes == 0, "first allocator can't be pre-warmed: %v", first.Stats())
+	_, allocErr := first.Alloc(peakUsage, 1)
+	failOnError(t, allocErr)
+	second := pool.Get()
+	pool.Put(first)
+
+	third := pool.Get()
+	assert(third == first, "idle allocator should be reused")
+	fourth := pool.Get()
+	assert(fourth.Stats().AllocatedBytes >= peakUsage, "allocator should be pre-warmed: %v", fourth.Stats())
+	assert(fourth.Stats().CountOfOnHeapAllocations == 1, "unexpected stats: %v", fourth.Stats())
+	_, allocErr = fourth.Alloc(peakUsage/2, 8)
+	failOnError(t, allocErr)
+	assert(fourth.Stats().CountOfOnHeapAllocations == 1, "pre-warmed buffer should be used: %v", fourth.Stats())
+
+	stats := pool.Stats()
+	assert(stats.Hits == 1, "unexpected pool stats: %v", stats)
+	assert(stats.Misses == 3, "unexpected pool stats: %v", stats)
+	assert(stats.PeakUsedBytes == peakUsage, "unexpected pool stats: %v", stats)
+	pool.Put(second)
+	pool.Put(third)
+	pool.Put(fourth)
+	assert(pool.Stats().IdleAllocators == 3, "unexpected pool stats: %v", pool.Stats())
+}
+
+func TestArenaPoolDiscardsOversizedAllocators(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	pool := registry.Pool("spike")
+
+	spiked := pool.Get()
+	regular := pool.Get()
+	for i := 0; i < 1024; i++ {
+		_, allocErr := spiked.Alloc(8*1024, 8)
+		failOnError(t, allocErr)
+	}
+	pool.Put(spiked)
+	spikedAllocatedBytes := registry.Metrics().AllocatedBytes
+	assert(spikedAllocatedBytes >= 8*1024*1024, "unexpected registry metrics: %v", registry.Metrics())
+
+	for i := 0; i < 256; i++ {
+		_, allocErr := regular.Alloc(1024, 8)
+		failOnError(t, allocErr)
+		pool.Put(regular)
+		assert(pool.Get() == regular, "the last returned allocator should be reused")
+	}
+	pool.Put(regular)
+
+	stats := pool.Stats()
+	assert(stats.Discarded == 1, "unexpected pool stats: %v", stats)
+	assert(stats.IdleAllocators == 1, "unexpected pool stats: %v", stats)
+	assert(stats.PeakUsedBytes < 64*1024, "spike should be forgotten: %v", stats)
+	assert(
+		registry.Metrics().AllocatedBytes < spikedAllocatedBytes/8,
+		"budget of the discarded allocator should be returned: %v", registry.Metrics(),
+	)
+	assert(len(registry.AllocatorsMetrics()) == 1, "discarded allocator should be deregistered")
+}
+
+func TestArenaPoolConcurrentUsage(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: 256 * 1024 * 1024})
+	pool := registry.Pool("concurrent")
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				a := pool.Get()
+				_, allocErr := a.Alloc(16*1024, 8)
+				failOnError(t, allocErr)
+				pool.Put(a)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	assert(stats.Hits+stats.Misses == 800, "unexpected pool stats: %v", stats)
+	assert(stats.Misses <= 8, "unexpected pool stats: %v", stats)
+	assert(stats.IdleAllocators == stats.Misses-stats.Discarded, "unexpected pool stats: %v", stats)
+}
+
+func TestArenaPoolRejectsForeignAllocators(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	a := registry.Pool("first").Get()
+	defer func() {
+		assert(recover() != nil, "foreign allocator should be rejected")
+	}()
+	registry.Pool("second").Put(a)
+}
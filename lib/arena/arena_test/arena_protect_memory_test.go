@@ -0,0 +1,8 @@
+//go:build !arenadebug || !linux
+// +build !arenadebug !linux
+
+package arena_test
+
+// protectMemoryOnClear mirrors the `arenadebug` mode of the arena package,
+// where buffers are always cleared synchronously by Clear.
+const protectMemoryOnClear = false
@@ -0,0 +1,192 @@
+package arena_test
+
+import (
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type rangeAllocator interface {
+	allocator
+	AllocRange(minSize, preferredSize, alignment uintptr) (arena.Ptr, uintptr, error)
+}
+
+type arenaRangeAllocationCheckingStand struct{}
+
+func (s *arenaRangeAllocationCheckingStand) check(t *testing.T, target rangeAllocator) {
+	ptr, size, allocErr := target.AllocRange(16, 64, 8)
+	failOnError(t, allocErr)
+	assert(size >= 16 && size <= 64, "unexpected granted size: %v", size)
+	assert(uintptr(target.ToRef(ptr))%8 == 0, "ptr should be aligned: %v", ptr)
+	buf := (*[64]byte)(target.ToRef(ptr))[:size]
+	for i := range buf {
+		assert(buf[i] == 0, "allocated memory should be zeroed")
+		buf[i] = byte(i)
+	}
+
+	_, _, allocErr = target.AllocRange(64, 16, 8)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "min > preferred should be rejected: %v", allocErr)
+
+	for i := 0; i < 1000; i++ {
+		_, size, allocErr = target.AllocRange(uintptr(i), uintptr(2*i), uintptr(1)<<(i%4))
+		failOnError(t, allocErr)
+		assert(size >= uintptr(i) && size <= uintptr(2*i), "unexpected granted size: %v for %v", size, i)
+	}
+	for i := range buf {
+		assert(buf[i] == byte(i), "previously allocated memory should stay untouched")
+	}
+	t.Logf("allocator after range allocations: %v", target.Metrics())
+}
+
+func TestRangeAllocationOnDifferentAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaRangeAllocationCheckingStand{}
+	stand.check(t, &arena.GenericAllocator{})
+	stand.check(t, arena.NewDynamicAllocator())
+	stand.check(t, arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true}))
+	stand.check(t, arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 1024 * 1024}))
+	stand.check(t, arena.NewSubAllocator(arena.NewInstrumentedAllocator(nil), arena.Options{}))
+	stand.check(t, arena.NewSubAllocator(&allocatorWithoutRangeSupport{target: arena.NewDynamicAllocator()}, arena.Options{}))
+}
+
+func TestRangeAllocationOnRawAllocator(t *testing.T) {
+	t.Parallel()
+	a := arena.NewRawAllocator(1024)
+	_, size, allocErr := a.AllocRange(100, 200, 1)
+	failOnError(t, allocErr)
+	assert(size == 200, "preferred size should be granted: %v", size)
+
+	available := uintptr(a.Metrics().AvailableBytes)
+	_, size, allocErr = a.AllocRange(100, 2000, 1)
+	failOnError(t, allocErr)
+	assert(size == available, "the rest of the buffer should be granted: %v; available: %v", size, available)
+	assert(a.Metrics().AvailableBytes == 0, "buffer should be exhausted: %v", a.Metrics())
+
+	_, _, allocErr = a.AllocRange(1, 2, 1)
+	assert(allocErr == arena.AllocationLimitError, "allocation limit should be triggered: %v", allocErr)
+}
+
+func TestRangeAllocationDoesNotGrowDynamicAllocator(t *testing.T) {
+	t.Parallel()
+	a := arena.NewDynamicAllocator()
+	_, allocErr := a.Alloc(1, 1)
+	failOnError(t, allocErr)
+	allocatedBytes := a.Stats().AllocatedBytes
+	available := uintptr(a.Metrics().AvailableBytes)
+
+	_, size, allocErr := a.AllocRange(available/2, 2*available, 1)
+	failOnError(t, allocErr)
+	assert(size == available, "the rest of the current arena should be granted: %v; available: %v", size, available)
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "arena shouldn't grow: %v", a.Stats())
+
+	_, size, allocErr = a.AllocRange(available, 2*available, 1)
+	failOnError(t, allocErr)
+	assert(size == 2*available, "preferred size should be granted after growth: %v", size)
+	assert(a.Stats().AllocatedBytes > allocatedBytes, "arena should grow: %v", a.Stats())
+}
+
+func TestRangeAllocationWithinLimits(t *testing.T) {
+	t.Parallel()
+	const limit = 4 * 1024
+	targets := []rangeAllocator{
+		arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: limit}),
+		arena.NewSubAllocator(&allocatorWithoutRangeSupport{target: arena.NewDynamicAllocator()}, arena.Options{
+			AllocationLimitInBytes: limit,
+		}),
+	}
+	for _, target := range targets {
+		countOfRecords := 0
+		for {
+			_, size, allocErr := target.AllocRange(100, 1000, 8)
+			if allocErr != nil {
+				assert(allocErr == arena.AllocationLimitError, "unexpected error: %v", allocErr)
+				break
+			}
+			assert(size >= 100 && size <= 1000, "unexpected granted size: %v", size)
+			countOfRecords++
+		}
+		assert(countOfRecords == 4, "unexpected count of records: %v", countOfRecords)
+		assert(target.Stats().UsedBytes > limit-100, "limit should be almost exhausted: %v", target.Stats())
+		assert(target.Stats().UsedBytes <= limit, "limit should be respected: %v", target.Stats())
+	}
+}
+
+func TestBytesAllocationInRange(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 1024})
+	view := arena.NewBytesView(a)
+
+	bytes, allocErr := view.MakeBytesInRange(100, 1000)
+	failOnError(t, allocErr)
+	assert(bytes.Len() == 1000 && bytes.Cap() == 1000, "preferred len should be granted: %v", bytes)
+
+	bytes, allocErr = view.MakeBytesInRange(10, 1000)
+	failOnError(t, allocErr)
+	assert(bytes.Len() == 24 && bytes.Cap() == 24, "the rest of the limit should be granted: %v", bytes)
+
+	_, allocErr = view.MakeBytesInRange(1, 1000)
+	assert(allocErr == arena.AllocationLimitError, "allocation limit should be triggered: %v", allocErr)
+	_, allocErr = view.MakeBytesInRange(100, 10)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "min > preferred should be rejected: %v", allocErr)
+	_, allocErr = view.MakeBytesInRange(-1, 10)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "negative len should be rejected: %v", allocErr)
+
+	rawView := arena.NewBytesView(arena.NewRawAllocator(1024))
+	bytes, allocErr = rawView.MakeBytesInRange(10, 1000)
+	failOnError(t, allocErr)
+	assert(bytes.Len() == 1000, "preferred len should be granted: %v", bytes)
+	bytes, allocErr = rawView.MakeBytesInRange(10, 1000)
+	failOnError(t, allocErr)
+	assert(bytes.Len() == 23, "the rest of the buffer should be granted: %v", bytes)
+}
+
+func TestBufferGrowthNearAllocationLimit(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 4 * 1024})
+	buf := arena.NewBufferWithError(a)
+	_, writeErr := buf.WriteString(strings.Repeat("a", 1000))
+	failOnError(t, writeErr)
+	// interleaving allocation prevents in-place growth of the buffer
+	_, allocErr := a.Alloc(100, 1)
+	failOnError(t, allocErr)
+
+	_, writeErr = buf.WriteString(strings.Repeat("b", 1500))
+	failOnError(t, writeErr)
+	assert(buf.Len() == 2500, "unexpected buffer len: %v", buf.Len())
+	assert(buf.String() == strings.Repeat("a", 1000)+strings.Repeat("b", 1500), "unexpected buffer content")
+	assert(a.Stats().UsedBytes <= 4*1024, "limit should be respected: %v", a.Stats())
+}
+
+type allocatorWithoutRangeSupport struct {
+	target allocator
+}
+
+func (a *allocatorWithoutRangeSupport) Alloc(size, alignment uintptr) (arena.Ptr, error) {
+	return a.target.Alloc(size, alignment)
+}
+
+func (a *allocatorWithoutRangeSupport) AllocUnaligned(size uintptr) (arena.Ptr, error) {
+	return a.target.AllocUnaligned(size)
+}
+
+func (a *allocatorWithoutRangeSupport) ToRef(ptr arena.Ptr) unsafe.Pointer {
+	return a.target.ToRef(ptr)
+}
+
+func (a *allocatorWithoutRangeSupport) CurrentOffset() arena.Offset {
+	return a.target.CurrentOffset()
+}
+
+func (a *allocatorWithoutRangeSupport) Stats() arena.Stats {
+	return a.target.Stats()
+}
+
+func (a *allocatorWithoutRangeSupport) Metrics() arena.Metrics {
+	return a.target.Metrics()
+}
+
+func (a *allocatorWithoutRangeSupport) Clear() {
+	a.target.Clear()
+}
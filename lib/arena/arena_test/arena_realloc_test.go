@@ -0,0 +1,155 @@
+package arena_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type reallocTarget interface {
+	Alloc(size, alignment uintptr) (arena.Ptr, error)
+	ToRef(p arena.Ptr) unsafe.Pointer
+	Realloc(p arena.Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (arena.Ptr, error)
+}
+
+type arenaReallocCheckingStand struct{}
+
+func (s *arenaReallocCheckingStand) check(t *testing.T, target reallocTarget, extendsInPlace bool, freesMoved bool) {
+	p, allocErr := target.Alloc(16, 8)
+	failOnError(t, allocErr)
+	s.fill(target, p, 16)
+
+	same, reallocErr := target.Realloc(p, 16, 8, 8)
+	failOnError(t, reallocErr)
+	assert(same == p, "shrinking should return the same ptr: %v; %v", same, p)
+
+	extended, reallocErr := target.Realloc(p, 16, 64, 8)
+	failOnError(t, reallocErr)
+	if extendsInPlace {
+		assert(extended == p, "last allocation should be extended in place: %v; %v", extended, p)
+	}
+	s.verify(target, extended, 16)
+	s.fill(target, extended, 64)
+
+	// the next allocation prevents extension in place for bump allocators
+	_, allocErr = target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	moved, reallocErr := target.Realloc(extended, 64, 256, 8)
+	failOnError(t, reallocErr)
+	s.verify(target, moved, 64)
+	if !freesMoved {
+		// the previous value is left untouched by allocators that can't free it
+		s.verify(target, extended, 64)
+	}
+
+	empty, reallocErr := target.Realloc(arena.Ptr{}, 0, 32, 8)
+	failOnError(t, reallocErr)
+	assert(uintptr(target.ToRef(empty))%8 == 0, "new value should be aligned: %v", empty)
+}
+
+func (s *arenaReallocCheckingStand) fill(target reallocTarget, p arena.Ptr, size int) {
+	ref := target.ToRef(p)
+	for i := 0; i < size; i++ {
+		*(*byte)(unsafe.Pointer(uintptr(ref) + uintptr(i))) = byte(i + 1)
+	}
+}
+
+func (s *arenaReallocCheckingStand) verify(target reallocTarget, p arena.Ptr, size int) {
+	ref := target.ToRef(p)
+	for i := 0; i < size; i++ {
+		value := *(*byte)(unsafe.Pointer(uintptr(ref) + uintptr(i)))
+		assert(value == byte(i+1), "content should be preserved. idx: %v; value: %v", i, value)
+	}
+}
+
+func TestReallocOnAllAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaReallocCheckingStand{}
+
+	stand.check(t, arena.NewRawAllocator(1024), true, false)
+	stand.check(t, arena.NewDynamicAllocator(), true, false)
+	stand.check(t, arena.NewGenericAllocator(arena.Options{}), true, false)
+	stand.check(t, arena.NewSubAllocator(arena.NewDynamicAllocator(), arena.Options{}), true, false)
+	stand.check(t, arena.NewInstrumentedAllocator(arena.NewDynamicAllocator()), true, false)
+	stand.check(t, arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true}), true, false)
+	stand.check(t, arena.NewSyncAllocator(), true, false)
+	stand.check(t, arena.NewSizeClassAllocator(), false, true)
+
+	buddy, buddyErr := arena.NewBuddyAllocator(arena.BuddyOptions{MinBlockSize: 64, MaxBlockSize: 4096})
+	failOnError(t, buddyErr)
+	stand.check(t, buddy, true, true)
+}
+
+func TestRawArenaReallocLimit(t *testing.T) {
+	t.Parallel()
+	a := arena.NewRawAllocator(64)
+	p, allocErr := a.Alloc(32, 1)
+	failOnError(t, allocErr)
+	maxSize := uintptr(32 + a.Metrics().AvailableBytes)
+	extended, reallocErr := a.Realloc(p, 32, maxSize, 1)
+	failOnError(t, reallocErr)
+	assert(extended == p, "last allocation should be extended in place: %v; %v", extended, p)
+	_, reallocErr = a.Realloc(p, maxSize, maxSize+1, 1)
+	assert(reallocErr == arena.AllocationLimitError, "unexpected error: %v", reallocErr)
+}
+
+func TestGenericArenaReallocMetrics(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{AllocationLimitInBytes: 128})
+	p, allocErr := a.Alloc(64, 8)
+	failOnError(t, allocErr)
+	extended, reallocErr := a.Realloc(p, 64, 128, 8)
+	failOnError(t, reallocErr)
+	assert(extended == p, "last allocation should be extended in place: %v; %v", extended, p)
+	assert(a.Metrics().UsedBytes == 128, "unexpected metrics: %v", a.Metrics())
+	assert(a.Metrics().AvailableBytes == 0, "unexpected metrics: %v", a.Metrics())
+	enhanced := a.EnhancedMetrics()
+	assert(enhanced.CountOfAllocations == 1, "extension shouldn't be a new allocation: %v", enhanced)
+	assert(enhanced.DataBytes == 128, "unexpected metrics: %v", enhanced)
+
+	_, reallocErr = a.Realloc(p, 128, 129, 8)
+	assert(reallocErr == arena.AllocationLimitError, "unexpected error: %v", reallocErr)
+}
+
+func TestBuddyArenaReallocOfShortenedValue(t *testing.T) {
+	t.Parallel()
+	a, buddyErr := arena.NewBuddyAllocator(arena.BuddyOptions{MinBlockSize: 64, MaxBlockSize: 4096})
+	failOnError(t, buddyErr)
+	p, allocErr := a.Alloc(32, 8)
+	failOnError(t, allocErr)
+	// the rest of the value can be referenced by the original slice, so it can't be overwritten in place
+	moved, reallocErr := a.Realloc(p, 16, 48, 8)
+	failOnError(t, reallocErr)
+	assert(moved != p, "shortened value should be moved: %v; %v", moved, p)
+}
+
+func TestSlabArenaRealloc(t *testing.T) {
+	t.Parallel()
+	a := arena.NewSlabAllocator(64, 8, arena.SlabOptions{})
+	p, allocErr := a.Alloc(16, 8)
+	failOnError(t, allocErr)
+	moved, reallocErr := a.Realloc(p, 16, 64, 8)
+	failOnError(t, reallocErr)
+	assert(moved != p, "slab value should be moved: %v; %v", moved, p)
+	_, reallocErr = a.Realloc(moved, 64, 65, 8)
+	assert(reallocErr == arena.AllocationInvalidArgumentError, "unexpected error: %v", reallocErr)
+}
+
+func TestBytesAppendExtendsInPlace(t *testing.T) {
+	t.Parallel()
+	a := arena.NewDynamicAllocator()
+	view := arena.NewBytesView(a)
+	bytes, allocErr := view.MakeBytesWithCapacity(0, 4)
+	failOnError(t, allocErr)
+	bytes, allocErr = view.AppendString(bytes, "abcd")
+	failOnError(t, allocErr)
+	before := &view.BytesToRef(bytes)[0]
+
+	bytes, allocErr = view.AppendString(bytes, "efgh")
+	failOnError(t, allocErr)
+	after := &view.BytesToRef(bytes)[0]
+	assert(before == after, "last allocated bytes should be extended in place")
+	assert(string(view.BytesToRef(bytes)) == "abcdefgh", "unexpected content: %v", string(view.BytesToRef(bytes)))
+	assert(a.Stats().UsedBytes == 8, "previous buffer shouldn't be wasted: %v", a.Stats())
+}
@@ -0,0 +1,140 @@
+package arena_test
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestRegistryAllocator(t *testing.T) {
+	t.Parallel()
+	// 16MB allocated in chunks below, with doubling growth it takes at most 32MB of arenas
+	const limit = 64 * 1024 * 1024
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: limit})
+	a := registry.NewAllocator("basic", arena.Options{})
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	maskStand := &arenaMaskCheckingStand{}
+	maskStand.check(t, a)
+	for i := 0; i < 1024; i++ {
+		_, allocErr := a.Alloc(16*1024, 8)
+		failOnError(t, allocErr)
+	}
+	assert(a.Metrics().CountOfOnHeapAllocations > 1, "allocator should grow: %v", a.Metrics())
+	assert(registry.Metrics().AllocatedBytes <= limit/2, "unexpected total metrics: %v", registry.Metrics())
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, a)
+
+	sub := registry.NewAllocator("sub", arena.Options{InitialCapacity: 1024})
+	bytesBufferAllocationStand := &arenaByteBufferWithErrorAllocationCheckingStand{}
+	bytesBufferAllocationStand.check(t, arena.NewSubAllocator(sub, arena.Options{}))
+
+	allocatorsMetrics := registry.AllocatorsMetrics()
+	assert(len(allocatorsMetrics) == 2, "unexpected allocators: %v", allocatorsMetrics)
+	total := registry.Metrics()
+	assert(
+		total.AllocatedBytes == allocatorsMetrics[0].AllocatedBytes+allocatorsMetrics[1].AllocatedBytes,
+		"unexpected total metrics: %v; allocators: %v", total, allocatorsMetrics,
+	)
+	assert(
+		total.UsedBytes == allocatorsMetrics[0].UsedBytes+allocatorsMetrics[1].UsedBytes,
+		"unexpected total metrics: %v; allocators: %v", total, allocatorsMetrics,
+	)
+	assert(total.MaxCapacity == limit, "unexpected total metrics: %v", total)
+	for _, allocatorMetrics := range allocatorsMetrics {
+		if allocatorMetrics.Name == "sub" {
+			assert(allocatorMetrics.UsedBytes == sub.Stats().UsedBytes, "unexpected metrics: %v", allocatorMetrics)
+			assert(allocatorMetrics.AllocatedBytes == sub.Stats().AllocatedBytes, "unexpected metrics: %v", allocatorMetrics)
+		}
+	}
+
+	a.Close()
+	sub.Close()
+	assert(len(registry.AllocatorsMetrics()) == 0, "closed allocators should be deregistered")
+	assert(registry.Metrics().AllocatedBytes == 0, "budget should be returned: %v", registry.Metrics())
+}
+
+func TestRegistryGlobalAllocationLimit(t *testing.T) {
+	t.Parallel()
+	const limit = 4 * 1024 * 1024
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: limit})
+	allocators := make([]*arena.GenericAllocator, 16)
+	for i := range allocators {
+		allocators[i] = registry.NewAllocator("allocator-"+strconv.Itoa(i), arena.Options{})
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, a := range allocators {
+		wg.Add(1)
+		go func(a *arena.GenericAllocator) {
+			defer wg.Done()
+			for {
+				_, allocErr := a.Alloc(1024, 8)
+				if allocErr != nil {
+					assert(allocErr == arena.AllocationLimitError, "unexpected error: %v", allocErr)
+					return
+				}
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	total := registry.Metrics()
+	assert(total.AllocatedBytes <= limit, "registry limit should be respected: %v", total)
+	assert(total.AllocatedBytes > limit/2, "registry budget should be used: %v", total)
+	usedBytes := 0
+	for _, a := range allocators {
+		usedBytes += a.Stats().UsedBytes
+	}
+	assert(total.UsedBytes == usedBytes, "unexpected used bytes: %v; expected: %v", total, usedBytes)
+
+	largestAllocatorIdx := 0
+	for i, a := range allocators {
+		if a.Stats().AllocatedBytes > allocators[largestAllocatorIdx].Stats().AllocatedBytes {
+			largestAllocatorIdx = i
+		}
+	}
+	allocators[largestAllocatorIdx].Close()
+	_, allocErr := allocators[(largestAllocatorIdx+1)%len(allocators)].Alloc(1024, 8)
+	failOnError(t, allocErr)
+	for _, a := range allocators {
+		a.Close()
+	}
+	assert(registry.Metrics().AllocatedBytes == 0, "budget should be returned: %v", registry.Metrics())
+}
+
+func TestRegistryAllocationRangeWithinLimit(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: 1024 * 1024})
+	a := registry.NewAllocator("range", arena.Options{})
+	_, size, allocErr := a.AllocRange(256*1024, 2*1024*1024, 8)
+	failOnError(t, allocErr)
+	assert(size >= 256*1024, "unexpected granted size: %v", size)
+	assert(registry.Metrics().AllocatedBytes <= 1024*1024, "registry limit should be respected: %v", registry.Metrics())
+	_, _, allocErr = a.AllocRange(2*1024*1024, 2*1024*1024, 8)
+	assert(allocErr == arena.AllocationLimitError, "allocation limit should be triggered: %v", allocErr)
+}
+
+func TestRegistryBudgetIsReturnedOnGC(t *testing.T) {
+	t.Parallel()
+	registry := arena.NewRegistry(arena.RegistryOptions{AllocationLimitInBytes: 1024 * 1024})
+	allocateAndForget(t, registry)
+	assert(registry.Metrics().AllocatedBytes > 0, "budget should be used")
+	for i := 0; i < 100 && registry.Metrics().AllocatedBytes > 0; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	assert(registry.Metrics().AllocatedBytes == 0, "budget should be returned: %v", registry.Metrics())
+	assert(len(registry.AllocatorsMetrics()) == 0, "collected allocators should be deregistered")
+}
+
+//go:noinline
+func allocateAndForget(t *testing.T, registry *arena.Registry) {
+	a := registry.NewAllocator("forgotten", arena.Options{})
+	_, allocErr := a.Alloc(1024, 8)
+	failOnError(t, allocErr)
+}
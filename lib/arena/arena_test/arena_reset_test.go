@@ -0,0 +1,293 @@
+package arena_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type resettableAllocator interface {
+	allocator
+	ResetTo(o arena.Offset) error
+}
+
+type arenaResetCheckingStand struct {
+	speculativeAllocationSize int
+}
+
+func (s *arenaResetCheckingStand) check(t *testing.T, target resettableAllocator) {
+	target.Clear()
+	view := arena.NewBytesView(target)
+	emptyCheckpoint := target.CurrentOffset()
+
+	base, allocErr := view.Embed([]byte("data before checkpoint"))
+	failOnError(t, allocErr)
+	outerCheckpoint := target.CurrentOffset()
+	outerStats := target.Stats()
+
+	outer, allocErr := view.Embed([]byte("data after outer checkpoint"))
+	failOnError(t, allocErr)
+	innerCheckpoint := target.CurrentOffset()
+	innerStats := target.Stats()
+
+	speculative := make([]arena.Bytes, 0, 4)
+	for i := 0; i < cap(speculative); i++ {
+		bytes, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+		failOnError(t, allocErr)
+		for j, rawBytes := 0, view.BytesToRef(bytes); j < len(rawBytes); j++ {
+			rawBytes[j] = 0xFF
+		}
+		speculative = append(speculative, bytes)
+	}
+	failOnError(t, target.ResetTo(innerCheckpoint))
+	assert(target.Stats().UsedBytes == innerStats.UsedBytes, "unexpected stats: %v; expected: %v", target.Stats(), innerStats)
+	assert(target.Stats().AllocatedBytes >= innerStats.AllocatedBytes, "unexpected stats: %v", target.Stats())
+	assert(target.CurrentOffset() == innerCheckpoint, "unexpected offset: %v; expected: %v", target.CurrentOffset(), innerCheckpoint)
+	assert(string(view.BytesToRef(base)) == "data before checkpoint", "base data should stay untouched")
+	assert(string(view.BytesToRef(outer)) == "data after outer checkpoint", "outer data should stay untouched")
+
+	// the same memory is allocated again and it should be clear
+	for range speculative {
+		bytes, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+		failOnError(t, allocErr)
+		for j, b := range view.BytesToRef(bytes) {
+			if b != 0 {
+				t.Fatalf("memory should be clear after ResetTo. idx: %v", j)
+			}
+		}
+	}
+
+	failOnError(t, target.ResetTo(outerCheckpoint))
+	assert(target.Stats().UsedBytes == outerStats.UsedBytes, "unexpected stats: %v; expected: %v", target.Stats(), outerStats)
+	assert(string(view.BytesToRef(base)) == "data before checkpoint", "base data should stay untouched")
+	resetErr := target.ResetTo(innerCheckpoint)
+	assert(resetErr == arena.AllocationInvalidArgumentError, "checkpoint is out of the allocated region: %v", resetErr)
+
+	failOnError(t, target.ResetTo(emptyCheckpoint))
+	assert(target.Stats().UsedBytes == 0, "unexpected stats: %v", target.Stats())
+	failOnError(t, target.ResetTo(target.CurrentOffset()))
+
+	target.Clear()
+	_, allocErr = target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	resetErr = target.ResetTo(outerCheckpoint)
+	assert(resetErr == arena.AllocationInvalidArgumentError, "checkpoint was taken before Clear: %v", resetErr)
+	target.Clear()
+}
+
+func (s *arenaResetCheckingStand) checkToRefPanicsAfterReset(t *testing.T, target resettableAllocator) {
+	target.Clear()
+	_, allocErr := target.Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkpoint := target.CurrentOffset()
+	_, allocErr = target.AllocUnaligned(1)
+	failOnError(t, allocErr)
+	ptr, allocErr := target.Alloc(uintptr(s.speculativeAllocationSize), 8)
+	failOnError(t, allocErr)
+	failOnError(t, target.ResetTo(checkpoint))
+
+	defer func() {
+		p := recover()
+		assert(p != nil, "ToRef should panic for arena.Ptr allocated after the checkpoint")
+		target.Clear()
+	}()
+	target.ToRef(ptr)
+}
+
+func (s *arenaResetCheckingStand) checkScope(t *testing.T, target resettableAllocator) {
+	target.Clear()
+	view := arena.NewBytesView(target)
+	base, allocErr := view.Embed([]byte("base"))
+	failOnError(t, allocErr)
+	usedBytes := target.Stats().UsedBytes
+
+	scopeErr := arena.Scope(target, func() error {
+		_, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+		failOnError(t, allocErr)
+		return nil
+	})
+	failOnError(t, scopeErr)
+	assert(target.Stats().UsedBytes > usedBytes, "successful scope allocations should be kept: %v", target.Stats())
+	usedBytes = target.Stats().UsedBytes
+
+	expectedErr := errors.New("expected error")
+	scopeErr = arena.Scope(target, func() error {
+		_, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+		failOnError(t, allocErr)
+		innerScopeErr := arena.Scope(target, func() error {
+			_, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+			failOnError(t, allocErr)
+			return expectedErr
+		})
+		assert(innerScopeErr == expectedErr, "unexpected error: %v", innerScopeErr)
+		return nil
+	})
+	failOnError(t, scopeErr)
+	assert(
+		target.Stats().UsedBytes > usedBytes && target.Stats().UsedBytes <= usedBytes+2*s.speculativeAllocationSize,
+		"only inner scope should be rolled back: %v", target.Stats(),
+	)
+	usedBytes = target.Stats().UsedBytes
+
+	scopeErr = arena.Scope(target, func() error {
+		_, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+		failOnError(t, allocErr)
+		return expectedErr
+	})
+	assert(scopeErr == expectedErr, "unexpected error: %v", scopeErr)
+	assert(target.Stats().UsedBytes == usedBytes, "failed scope should be rolled back: %v", target.Stats())
+
+	func() {
+		defer func() {
+			p := recover()
+			assert(p == "expected panic", "unexpected panic: %v", p)
+		}()
+		_ = arena.Scope(target, func() error {
+			_, allocErr := view.MakeBytes(s.speculativeAllocationSize)
+			failOnError(t, allocErr)
+			panic("expected panic")
+		})
+	}()
+	assert(target.Stats().UsedBytes == usedBytes, "panicked scope should be rolled back: %v", target.Stats())
+	assert(string(view.BytesToRef(base)) == "base", "base data should stay untouched")
+	target.Clear()
+}
+
+func TestResetOnDifferentAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaResetCheckingStand{speculativeAllocationSize: 1024}
+	stand.check(t, arena.NewRawAllocator(16*1024))
+	stand.checkScope(t, arena.NewRawAllocator(16*1024))
+
+	// big speculative allocations make dynamic allocator grow, so ResetTo should rewind across buckets
+	dynamicStand := &arenaResetCheckingStand{speculativeAllocationSize: 64 * 1024}
+	targets := []resettableAllocator{
+		arena.NewDynamicAllocator(),
+		&arena.DynamicAllocator{},
+		arena.NewGenericAllocator(arena.Options{}),
+		arena.NewGenericAllocator(arena.Options{InitialCapacity: 1024, DelegateClearToUnderlyingAllocator: true}),
+		arena.NewSubAllocator(arena.NewRawAllocator(1024*1024), arena.Options{}),
+		arena.NewInstrumentedAllocator(arena.NewDynamicAllocator()),
+		arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true}),
+		arena.NewGenericAllocator(arena.Options{ZeroOnAlloc: true, DelegateClearToUnderlyingAllocator: true}),
+	}
+	for _, target := range targets {
+		dynamicStand.check(t, target)
+		dynamicStand.checkScope(t, target)
+	}
+	for _, target := range targets[:4] {
+		dynamicStand.checkToRefPanicsAfterReset(t, target)
+	}
+}
+
+func TestResetRewindsDynamicBuckets(t *testing.T) {
+	t.Parallel()
+	a := arena.NewDynamicAllocator()
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkpoint := a.CurrentOffset()
+	for i := 0; i < 8; i++ {
+		_, allocErr := a.Alloc(uintptr(a.Metrics().AvailableBytes+1), 1)
+		failOnError(t, allocErr)
+	}
+	allocatedBytes := a.Stats().AllocatedBytes
+	failOnError(t, a.ResetTo(checkpoint))
+	assert(a.Stats().UsedBytes == 8, "unexpected stats: %v", a.Stats())
+	assert(a.CurrentOffset() == checkpoint, "unexpected offset: %v; expected: %v", a.CurrentOffset(), checkpoint)
+
+	// released buckets should be reused
+	for i := 0; i < 8; i++ {
+		_, allocErr := a.Alloc(uintptr(a.Metrics().AvailableBytes+1), 1)
+		failOnError(t, allocErr)
+	}
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "unexpected stats: %v; expected: %v", a.Stats(), allocatedBytes)
+
+	resetErr := a.ResetTo(arena.NewDynamicAllocator().CurrentOffset())
+	assert(resetErr == arena.AllocationInvalidArgumentError, "foreign checkpoint: %v", resetErr)
+}
+
+func TestResetGenericAllocatorMetrics(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{})
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkpoint := a.CurrentOffset()
+	before := a.EnhancedMetrics()
+	_, allocErr = a.Alloc(1, 1)
+	failOnError(t, allocErr)
+	_, allocErr = a.Alloc(64, 8)
+	failOnError(t, allocErr)
+	failOnError(t, a.ResetTo(checkpoint))
+	after := a.EnhancedMetrics()
+	assert(after.UsedBytes == before.UsedBytes, "unexpected metrics: %v; expected: %v", after, before)
+	assert(after.DataBytes <= before.DataBytes, "unexpected metrics: %v; expected: %v", after, before)
+	assert(after.PaddingOverhead == after.UsedBytes-after.DataBytes, "unexpected metrics: %v", after)
+	assert(after.CountOfAllocations == 3, "count of allocations is a lifetime counter: %v", after)
+
+	resetErr := arena.NewGenericAllocator(arena.Options{}).ResetTo(checkpoint)
+	assert(resetErr == arena.AllocationInvalidArgumentError, "foreign checkpoint: %v", resetErr)
+	resetErr = arena.NewSubAllocator(arena.NewSyncAllocator(), arena.Options{}).ResetTo(checkpoint)
+	assert(resetErr == arena.AllocationInvalidArgumentError, "foreign checkpoint: %v", resetErr)
+
+	sub := arena.NewSubAllocator(arena.NewSyncAllocator(), arena.Options{})
+	resetErr = sub.ResetTo(sub.CurrentOffset())
+	assert(resetErr == arena.UnsupportedOperationError, "sync allocator doesn't support ResetTo: %v", resetErr)
+}
+
+func TestResetGenericAllocatorReallocation(t *testing.T) {
+	t.Parallel()
+	a := arena.NewGenericAllocator(arena.Options{})
+	before, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	*(*int)(a.ToRef(before)) = 1
+	checkpoint := a.CurrentOffset()
+
+	stale, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	*(*int)(a.ToRef(stale)) = 2
+	failOnError(t, a.ResetTo(checkpoint))
+
+	// ResetTo keeps the arena mask, so once the region is allocated again,
+	// the stale arena.Ptr can be detected only in checked mode, by its generation
+	fresh, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	*(*int)(a.ToRef(fresh)) = 3
+	if checkedPtrMode {
+		func() {
+			defer func() {
+				err := recover()
+				assert(err == "pointer isn't part of this arena", "stale arena.Ptr should be rejected: %v", err)
+			}()
+			a.ToRef(stale)
+		}()
+	} else {
+		assert(fresh == stale, "the same region should be allocated again: %v; stale: %v", fresh, stale)
+		assert(*(*int)(a.ToRef(stale)) == 3, "stale arena.Ptr points to the new value")
+	}
+	assert(*(*int)(a.ToRef(fresh)) == 3, "values allocated after ResetTo should be valid")
+	assert(*(*int)(a.ToRef(before)) == 1, "values allocated before the checkpoint should stay valid")
+}
+
+func TestScopeKeepsPanicWhenRollbackFails(t *testing.T) {
+	t.Parallel()
+	a := arena.NewRawAllocator(1024)
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+
+	defer func() {
+		p := recover()
+		rollbackPanic, ok := p.(arena.ScopeRollbackPanic)
+		assert(ok, "unexpected panic: %v", p)
+		assert(rollbackPanic.Value == "expected panic", "original panic value should be kept: %v", rollbackPanic)
+		assert(
+			errors.Is(rollbackPanic, arena.AllocationInvalidArgumentError),
+			"rollback error should be attached: %v", rollbackPanic,
+		)
+	}()
+	_ = arena.Scope(a, func() error {
+		// checkpoint is out of the allocated region after Clear, so the rollback fails
+		a.Clear()
+		panic("expected panic")
+	})
+}
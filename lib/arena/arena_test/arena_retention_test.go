@@ -0,0 +1,121 @@
+package arena_test
+
+import (
+	"testing"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaRetentionCheckingStand struct{}
+
+// cycle allocates the specified count of bytes in small chunks and clears the allocator.
+func (s *arenaRetentionCheckingStand) cycle(t *testing.T, target allocator, bytes int) {
+	for i := 0; i < bytes/1024; i++ {
+		_, allocErr := target.Alloc(1024, 8)
+		failOnError(t, allocErr)
+	}
+	target.Clear()
+	metrics := target.Metrics()
+	assert(metrics.RetainedBytes <= metrics.AllocatedBytes, "unexpected metrics: %v", metrics)
+}
+
+func TestDynamicArenaRetainsAllArenasByDefault(t *testing.T) {
+	t.Parallel()
+	stand := &arenaRetentionCheckingStand{}
+	a := arena.NewDynamicAllocator()
+	stand.cycle(t, a, 8*1024*1024)
+	assert(a.Metrics().RetainedBytes == a.Metrics().AllocatedBytes, "unexpected metrics: %v", a.Metrics())
+	for i := 0; i < 10; i++ {
+		stand.cycle(t, a, 64*1024)
+	}
+	assert(a.Metrics().RetainedBytes > 8*1024*1024, "unexpected metrics: %v", a.Metrics())
+
+	releasedBytes := a.ReleaseUnused()
+	assert(releasedBytes > 8*1024*1024, "unexpected released bytes: %v", releasedBytes)
+	assert(a.Metrics().RetainedBytes == 0, "unexpected metrics: %v", a.Metrics())
+	assert(a.Metrics().AllocatedBytes == 0, "unexpected metrics: %v", a.Metrics())
+	stand.cycle(t, a, 64*1024)
+}
+
+func TestDynamicArenaRetentionPolicy(t *testing.T) {
+	t.Parallel()
+	stand := &arenaRetentionCheckingStand{}
+	const spike = 8 * 1024 * 1024
+	const load = 64 * 1024
+
+	limited := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		RetentionPolicy: arena.RetentionPolicy{MaxRetainedBytes: 1024 * 1024},
+	})
+	stand.cycle(t, limited, spike)
+	assert(limited.Metrics().RetainedBytes <= 1024*1024, "unexpected metrics: %v", limited.Metrics())
+	assert(limited.Metrics().AllocatedBytes == limited.Metrics().RetainedBytes, "unexpected metrics: %v", limited.Metrics())
+
+	idle := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		RetentionPolicy: arena.RetentionPolicy{MaxIdleClears: 2},
+	})
+	stand.cycle(t, idle, spike)
+	stand.cycle(t, idle, load)
+	assert(idle.Metrics().RetainedBytes > spike, "idle arenas should be retained: %v", idle.Metrics())
+	stand.cycle(t, idle, load)
+	assert(idle.Metrics().RetainedBytes < spike, "idle arenas should be released: %v", idle.Metrics())
+
+	decayed := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		RetentionPolicy: arena.RetentionPolicy{PeakDecayFactor: 0.5},
+	})
+	stand.cycle(t, decayed, spike)
+	retainedAfterSpike := decayed.Metrics().RetainedBytes
+	assert(retainedAfterSpike > spike, "recently used arenas should be retained: %v", decayed.Metrics())
+	for i := 0; i < 20; i++ {
+		stand.cycle(t, decayed, load)
+	}
+	assert(decayed.Metrics().RetainedBytes < spike/8, "retained bytes should decay: %v", decayed.Metrics())
+	stand.cycle(t, decayed, spike)
+	assert(decayed.Metrics().RetainedBytes > spike, "recently used arenas should be retained: %v", decayed.Metrics())
+}
+
+func TestGenericArenaRetentionPolicy(t *testing.T) {
+	t.Parallel()
+	stand := &arenaRetentionCheckingStand{}
+	policy := arena.RetentionPolicy{MaxRetainedBytes: 1024 * 1024}
+
+	registry := arena.NewRegistry(arena.RegistryOptions{})
+	registryAllocator := registry.NewAllocator("retained", arena.Options{RetentionPolicy: policy})
+	stand.cycle(t, registryAllocator, 8*1024*1024)
+	assert(registryAllocator.Metrics().RetainedBytes <= 1024*1024, "unexpected metrics: %v", registryAllocator.Metrics())
+	assert(
+		registry.Metrics().AllocatedBytes == registryAllocator.Metrics().AllocatedBytes,
+		"released arenas should be returned to the registry budget: %v; %v", registry.Metrics(), registryAllocator.Metrics(),
+	)
+
+	generic := arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true})
+	stand.cycle(t, generic, 8*1024*1024)
+	assert(generic.Metrics().RetainedBytes == generic.Metrics().AllocatedBytes, "unexpected metrics: %v", generic.Metrics())
+	releasedBytes := generic.ReleaseUnused()
+	assert(releasedBytes > 8*1024*1024, "unexpected released bytes: %v", releasedBytes)
+	assert(generic.Metrics().AllocatedBytes == 0, "unexpected metrics: %v", generic.Metrics())
+	assert(arena.NewSubAllocator(arena.NewRawAllocator(1024), arena.Options{}).ReleaseUnused() == 0, "nothing to release")
+
+	// the owned target is reused after Clear if the retention policy is specified, even without delegation
+	for _, limited := range []*arena.GenericAllocator{
+		arena.NewGenericAllocator(arena.Options{RetentionPolicy: policy}),
+		arena.NewSubAllocator(nil, arena.Options{RetentionPolicy: policy}),
+	} {
+		stand.cycle(t, limited, 8*1024*1024)
+		metrics := limited.Metrics()
+		assert(metrics.RetainedBytes > 0 && metrics.RetainedBytes <= 1024*1024, "unexpected metrics: %v", metrics)
+		releasedBytes := limited.ReleaseUnused()
+		assert(releasedBytes == metrics.RetainedBytes, "unexpected released bytes: %v; %v", releasedBytes, metrics)
+		assert(limited.Metrics().RetainedBytes == 0, "unexpected metrics: %v", limited.Metrics())
+	}
+}
+
+func TestDynamicArenaReleasesUnusedArenasToPool(t *testing.T) {
+	t.Parallel()
+	stand := &arenaRetentionCheckingStand{}
+	pool := arena.NewRawAllocatorPool(0)
+	a := arena.NewDynamicAllocatorWithPool(pool)
+	stand.cycle(t, a, 1024*1024)
+	retainedBytes := a.Metrics().RetainedBytes
+	assert(a.ReleaseUnused() == retainedBytes, "unexpected metrics: %v", a.Metrics())
+	assert(pool.PooledBytes() == retainedBytes, "released arenas should be pooled: %v", pool.PooledBytes())
+}
@@ -0,0 +1,153 @@
+package arena_test
+
+import (
+	"math/rand"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaSizeClassCheckingStand struct{}
+
+func (s *arenaSizeClassCheckingStand) check(t *testing.T, a *arena.SizeClassAllocator) {
+	const count = 2000
+	view := arena.NewBytesView(a)
+	random := rand.New(rand.NewSource(42))
+	sizes := []int{0, 1, 15, 16, 17, 100, 128, 129, 1000, 4096, 32 * 1024, 32*1024 + 1, 100 * 1024}
+
+	live := make([]arena.Bytes, 0, count)
+	for i := 0; i < count; i++ {
+		size := sizes[random.Intn(len(sizes))]
+		bytes, allocErr := view.MakeBytes(size)
+		failOnError(t, allocErr)
+		rawBytes := view.BytesToRef(bytes)
+		for j := range rawBytes {
+			if rawBytes[j] != 0 {
+				t.Fatalf("allocated memory should be clear. size: %v; idx: %v", size, j)
+			}
+			rawBytes[j] = byte(i%255 + 1)
+		}
+		live = append(live, bytes)
+
+		if random.Intn(3) == 0 {
+			victimIdx := random.Intn(len(live))
+			failOnError(t, view.Free(live[victimIdx]))
+			live[victimIdx] = live[len(live)-1]
+			live = live[:len(live)-1]
+		}
+	}
+
+	// all live values should be untouched by reuse of freed blocks
+	dataBytes := 0
+	for _, bytes := range live {
+		rawBytes := view.BytesToRef(bytes)
+		dataBytes += len(rawBytes)
+		for j := 1; j < len(rawBytes); j++ {
+			if rawBytes[j] != rawBytes[0] {
+				t.Fatalf("allocations overlap: %v", bytes)
+			}
+		}
+	}
+	metrics := a.EnhancedMetrics()
+	assert(metrics.DataBytes == dataBytes, "unexpected metrics: %v; expected data bytes: %v", metrics, dataBytes)
+	assert(metrics.FreeListBytes > 0, "freed blocks should be kept in free-lists: %v", metrics)
+	assert(metrics.FragmentationBytes > 0, "unexpected metrics: %v", metrics)
+	assert(
+		metrics.UsedBytes == metrics.DataBytes+metrics.FragmentationBytes+metrics.PaddingOverhead,
+		"unexpected metrics: %v", metrics,
+	)
+	assert(metrics.AllocatedBytes >= metrics.UsedBytes+metrics.FreeListBytes, "unexpected metrics: %v", metrics)
+
+	for _, bytes := range live {
+		failOnError(t, view.Free(bytes))
+	}
+	metrics = a.EnhancedMetrics()
+	assert(metrics.DataBytes == 0 && metrics.FragmentationBytes == 0, "unexpected metrics: %v", metrics)
+	allocatedBytes := metrics.AllocatedBytes
+
+	// everything should fit into freed blocks
+	for _, size := range sizes {
+		_, allocErr := view.MakeBytes(size)
+		failOnError(t, allocErr)
+	}
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "freed blocks should be reused: %v", a.Stats())
+
+	a.Clear()
+	metrics = a.EnhancedMetrics()
+	assert(metrics.UsedBytes == 0 && metrics.FreeListBytes == 0, "unexpected metrics after Clear: %v", metrics)
+}
+
+func TestSizeClassArena(t *testing.T) {
+	t.Parallel()
+	stand := &arenaSizeClassCheckingStand{}
+	stand.check(t, arena.NewSizeClassAllocator())
+	stand.check(t, arena.NewSizeClassAllocatorWithInitialCapacity(1024*1024))
+
+	a := &arena.SizeClassAllocator{}
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, a)
+	bytesBufferAllocationStand := &arenaByteBufferWithErrorAllocationCheckingStand{}
+	bytesBufferAllocationStand.check(t, a)
+
+	_, allocErr := a.Alloc(8, 32)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "big alignment isn't supported: %v", allocErr)
+	unsupportedErr := arena.NewBytesView(arena.NewDynamicAllocator()).Free(arena.Bytes{})
+	assert(unsupportedErr == arena.UnsupportedOperationError, "dynamic allocator can't free values: %v", unsupportedErr)
+}
+
+func TestSizeClassArenaLargeBlocksAreSplit(t *testing.T) {
+	t.Parallel()
+	const largeSize = 1024 * 1024
+	a := arena.NewSizeClassAllocator()
+	ptr, allocErr := a.Alloc(largeSize, 8)
+	failOnError(t, allocErr)
+	a.Free(ptr, largeSize)
+	allocatedBytes := a.Stats().AllocatedBytes
+
+	first, allocErr := a.Alloc(largeSize/2, 8)
+	failOnError(t, allocErr)
+	assert(first == ptr, "the best fit block should be reused: %v", first)
+	second, allocErr := a.Alloc(largeSize/4, 8)
+	failOnError(t, allocErr)
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "remainders should be reused: %v", a.Stats())
+	// small values are never served by large blocks
+	third, allocErr := a.Alloc(unsafe.Sizeof(person{}), unsafe.Alignof(person{}))
+	failOnError(t, allocErr)
+	assert(
+		uintptr(a.ToRef(second)) == uintptr(a.ToRef(first))+largeSize/2,
+		"remainder should follow the first part of the block",
+	)
+	assert(a.ToRef(third) != nil, "third is not nil")
+	assert(a.EnhancedMetrics().FreeListBytes == largeSize/4, "unexpected metrics: %v", a.EnhancedMetrics())
+}
+
+func TestSizeClassArenaAppendFreesMovedBlocks(t *testing.T) {
+	t.Parallel()
+	const size = 64 * 1024
+	a := arena.NewSizeClassAllocator()
+	view := arena.NewBytesView(a)
+	allocatedBytes := 0
+	for round := 0; round < 20; round++ {
+		bytes := arena.Bytes{}
+		for i := 0; i < size; i++ {
+			var appendErr error
+			bytes, appendErr = view.AppendByte(bytes, byte(i%255+1))
+			failOnError(t, appendErr)
+		}
+		for i, b := range view.BytesToRef(bytes) {
+			assert(b == byte(i%255+1), "content should be preserved. idx: %v; value: %v", i, b)
+		}
+		metrics := a.EnhancedMetrics()
+		assert(metrics.UsedBytes <= 2*size, "moved blocks should be freed: %v", metrics)
+		failOnError(t, view.Free(bytes))
+
+		metrics = a.EnhancedMetrics()
+		assert(metrics.UsedBytes == 0, "all blocks should be freed: %v", metrics)
+		assert(metrics.FreeListBytes >= size, "freed blocks should be kept for reuse: %v", metrics)
+		if round == 0 {
+			allocatedBytes = metrics.AllocatedBytes
+		}
+		assert(metrics.AllocatedBytes == allocatedBytes, "freed blocks should be reused: %v", metrics)
+	}
+}
@@ -0,0 +1,107 @@
+package arena_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type arenaSlabCheckingStand struct{}
+
+func (s *arenaSlabCheckingStand) check(t *testing.T, a *arena.SlabAllocator) {
+	const count = 10000
+	sizeOfPerson := unsafe.Sizeof(person{})
+	assert(a.SlotSize() >= sizeOfPerson, "unexpected slot size: %v", a.SlotSize())
+
+	ptrs := make([]arena.Ptr, 0, count)
+	for i := 0; i < count; i++ {
+		ptr, allocErr := a.Alloc(sizeOfPerson, unsafe.Alignof(person{}))
+		failOnError(t, allocErr)
+		p := (*person)(a.ToRef(ptr))
+		assert(p.Age == 0 && p.Name == "", "allocated memory should be clear: %+v", *p)
+		p.Age = uint(i)
+		ptrs = append(ptrs, ptr)
+	}
+	usedBytes := a.Stats().UsedBytes
+	allocatedBytes := a.Stats().AllocatedBytes
+	assert(usedBytes >= count*int(sizeOfPerson), "unexpected stats: %v", a.Stats())
+
+	// free every even value
+	for i := 0; i < count; i += 2 {
+		a.Free(ptrs[i])
+	}
+	assert(a.Stats().UsedBytes == usedBytes-count/2*int(a.SlotSize()), "unexpected stats: %v", a.Stats())
+	for i := 1; i < count; i += 2 {
+		p := (*person)(a.ToRef(ptrs[i]))
+		assert(p.Age == uint(i), "values that weren't freed should stay untouched: %v; expected: %v", p.Age, i)
+	}
+
+	// freed slots should be reused before the growth
+	reused := make(map[arena.Ptr]bool, count/2)
+	for i := 0; i < count; i += 2 {
+		reused[ptrs[i]] = true
+	}
+	for i := 0; i < count; i += 2 {
+		ptr, allocErr := a.AllocUnaligned(sizeOfPerson)
+		failOnError(t, allocErr)
+		assert(reused[ptr], "freed slot should be reused: %v", ptr)
+		delete(reused, ptr)
+		p := (*person)(a.ToRef(ptr))
+		assert(p.Age == 0, "reused slot should be clear: %+v", *p)
+	}
+	assert(a.Stats().UsedBytes == usedBytes, "unexpected stats: %v; expected: %v", a.Stats(), usedBytes)
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "slab shouldn't grow: %v", a.Stats())
+
+	_, allocErr := a.Alloc(a.SlotSize()+1, 1)
+	assert(allocErr == arena.AllocationInvalidArgumentError, "slot size should be respected: %v", allocErr)
+	_, allocErr = a.Alloc(1, 2*a.SlotSize())
+	assert(allocErr == arena.AllocationInvalidArgumentError, "slot alignment should be respected: %v", allocErr)
+
+	a.Clear()
+	assert(a.Stats().UsedBytes == 0, "unexpected stats: %v", a.Stats())
+	assert(a.Metrics().AvailableBytes <= allocatedBytes, "unexpected metrics: %v", a.Metrics())
+	ptr, allocErr := a.Alloc(sizeOfPerson, unsafe.Alignof(person{}))
+	failOnError(t, allocErr)
+	assert(a.ToRef(ptr) != nil, "allocation after Clear should succeed")
+	a.Clear()
+}
+
+func TestSlabArena(t *testing.T) {
+	t.Parallel()
+	stand := &arenaSlabCheckingStand{}
+	stand.check(t, arena.NewSlabAllocator(unsafe.Sizeof(person{}), unsafe.Alignof(person{}), arena.SlabOptions{}))
+	stand.check(t, arena.NewSlabAllocator(
+		unsafe.Sizeof(person{}), unsafe.Alignof(person{}),
+		arena.SlabOptions{InitialCapacity: 1024 * 1024, DetectDoubleFree: true},
+	))
+
+	small := arena.NewSlabAllocator(1, 1, arena.SlabOptions{})
+	assert(small.SlotSize() == unsafe.Sizeof(arena.Ptr{}), "slot should fit free-list link: %v", small.SlotSize())
+}
+
+func TestSlabArenaDetectsDoubleFree(t *testing.T) {
+	t.Parallel()
+	a := arena.NewSlabAllocator(unsafe.Sizeof(person{}), unsafe.Alignof(person{}), arena.SlabOptions{DetectDoubleFree: true})
+	ptr, allocErr := a.Alloc(unsafe.Sizeof(person{}), unsafe.Alignof(person{}))
+	failOnError(t, allocErr)
+	a.Free(ptr)
+
+	checkPanics := func(msg string, f func()) {
+		defer func() {
+			p := recover()
+			assert(p != nil, msg)
+		}()
+		f()
+	}
+	checkPanics("double free should be detected", func() { a.Free(ptr) })
+	checkPanics("use after free should be detected", func() { a.ToRef(ptr) })
+	foreignPtr, allocErr := arena.NewDynamicAllocator().Alloc(8, 8)
+	failOnError(t, allocErr)
+	checkPanics("free of foreign pointer should be detected", func() { a.Free(foreignPtr) })
+
+	reusedPtr, allocErr := a.Alloc(unsafe.Sizeof(person{}), unsafe.Alignof(person{}))
+	failOnError(t, allocErr)
+	assert(reusedPtr == ptr, "freed slot should be reused: %v", reusedPtr)
+	assert(a.ToRef(reusedPtr) != nil, "reused slot can be used again")
+}
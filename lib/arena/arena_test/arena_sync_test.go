@@ -0,0 +1,132 @@
+package arena_test
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+func TestSyncArena(t *testing.T) {
+	t.Parallel()
+
+	maskCheckingStand := &arenaMaskCheckingStand{}
+	maskCheckingStand.check(t, &arena.SyncAllocator{})
+
+	a := arena.NewSyncAllocator()
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+
+	firstPtr, allocErr := a.Alloc(uintptr(a.Metrics().AvailableBytes+1), 1)
+	assert(allocErr == nil, "sync arena should grow")
+	assert(a.ToRef(firstPtr) != nil, "firstPtr is not nil")
+	secondPtr, allocErr := a.AllocUnaligned(uintptr(a.Metrics().AvailableBytes + 1))
+	assert(allocErr == nil, "sync arena should grow")
+	assert(a.ToRef(secondPtr) != nil, "secondPtr is not nil")
+	assert(a.ToRef(firstPtr) != nil, "firstPtr is still not nil")
+
+	maskStand := &arenaMaskCheckingStand{}
+	maskStand.check(t, a)
+
+	growthStand := &arenaDynamicGrowthStand{}
+	growthStand.check(t, a)
+
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, a)
+
+	bytesBufferAllocationStand := &arenaByteBufferWithErrorAllocationCheckingStand{}
+	bytesBufferAllocationStand.check(t, a)
+
+	bytesBufferWithPanicAllocationStand := &arenaByteBufferWithPanicAllocationCheckingStand{}
+	bytesBufferWithPanicAllocationStand.check(t, a)
+}
+
+func TestSubArenaOverSyncArena(t *testing.T) {
+	t.Parallel()
+	target := arena.NewSyncAllocator()
+	a := arena.NewSubAllocator(target, arena.Options{})
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	maskStand := &arenaMaskCheckingStand{}
+	maskStand.check(t, a)
+}
+
+func TestSyncArenaConcurrentAllocations(t *testing.T) {
+	t.Parallel()
+	const goroutines = 16
+	const allocationsPerGoroutine = 10000
+
+	a := arena.NewSyncAllocator()
+	for cycle := 0; cycle < 3; cycle++ {
+		results := make([][]arena.Ptr, goroutines)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func(goroutineIdx int) {
+				defer wg.Done()
+				ptrs := make([]arena.Ptr, 0, allocationsPerGoroutine)
+				for j := 0; j < allocationsPerGoroutine; j++ {
+					var ptr arena.Ptr
+					var allocErr error
+					if j%2 == 0 {
+						ptr, allocErr = a.Alloc(unsafe.Sizeof(person{}), unsafe.Alignof(person{}))
+					} else {
+						ptr, allocErr = a.AllocUnaligned(unsafe.Sizeof(person{}))
+					}
+					failOnError(t, allocErr)
+					p := (*person)(a.ToRef(ptr))
+					assert(p.Age == 0, "allocated memory should be clear: %+v", *p)
+					p.Age = uint(goroutineIdx*allocationsPerGoroutine + j)
+					ptrs = append(ptrs, ptr)
+				}
+				results[goroutineIdx] = ptrs
+			}(i)
+		}
+		wg.Wait()
+
+		for goroutineIdx, ptrs := range results {
+			for j, ptr := range ptrs {
+				p := (*person)(a.ToRef(ptr))
+				expectedAge := uint(goroutineIdx*allocationsPerGoroutine + j)
+				assert(p.Age == expectedAge, "allocations overlap: %v; expected: %v", p.Age, expectedAge)
+			}
+		}
+		stats := a.Stats()
+		assert(
+			stats.UsedBytes >= goroutines*allocationsPerGoroutine*int(unsafe.Sizeof(person{})),
+			"unexpected stats: %v", stats,
+		)
+		assert(stats.AllocatedBytes >= stats.UsedBytes, "unexpected stats: %v", stats)
+		a.Clear()
+		assert(a.Stats().UsedBytes == 0, "unexpected stats after clear: %v", a.Stats())
+	}
+}
+
+func TestSyncArenaSkipsUndersizedBucketsAfterClear(t *testing.T) {
+	t.Parallel()
+	a := arena.NewSyncAllocator()
+	_, allocErr := a.Alloc(8, 8)
+	failOnError(t, allocErr)
+	const bigSize = 1024 * 1024
+	_, allocErr = a.AllocUnaligned(bigSize)
+	failOnError(t, allocErr)
+	allocatedBytes := a.Stats().AllocatedBytes
+	a.Clear()
+
+	// the first bucket kept after Clear is too small, so the allocation should go to the next big one
+	big, allocErr := a.AllocUnaligned(bigSize)
+	failOnError(t, allocErr)
+	assert(a.ToRef(big) != nil, "big is not nil")
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "kept buckets should be reused: %v; expected: %v", a.Stats(), allocatedBytes)
+	assert(a.Stats().UsedBytes == bigSize, "unexpected stats: %v", a.Stats())
+
+	// failed allocations shouldn't move the offset of the current bucket
+	availableBytes := a.Metrics().AvailableBytes
+	_, allocErr = a.AllocUnaligned(^uintptr(0) - bigSize)
+	assert(allocErr == arena.AllocationLimitError, "too big allocation should fail: %v", allocErr)
+	_, allocErr = a.Alloc(^uintptr(0)-bigSize, 8)
+	assert(allocErr == arena.AllocationLimitError, "too big allocation should fail: %v", allocErr)
+	assert(a.Metrics().AvailableBytes == availableBytes, "unexpected metrics: %v; expected: %v", a.Metrics(), availableBytes)
+	assert(a.Stats().AllocatedBytes == allocatedBytes, "unexpected stats: %v; expected: %v", a.Stats(), allocatedBytes)
+}
@@ -0,0 +1,100 @@
+//go:build linux
+// +build linux
+
+package arena_test
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+const virtualArenaReservedBytes = 1024 * 1024 * 1024
+
+func TestVirtualArena(t *testing.T) {
+	t.Parallel()
+
+	a, reserveErr := arena.NewVirtualAllocator(virtualArenaReservedBytes)
+	failOnError(t, reserveErr)
+	defer a.Close()
+	assert(a.Stats().AllocatedBytes == 0, "reserved range shouldn't be committed: %v", a.Stats())
+	assert(a.Metrics().MaxCapacity == virtualArenaReservedBytes, "unexpected metrics: %v", a.Metrics())
+
+	stand := &basicArenaCheckingStand{}
+	stand.check(t, a)
+	maskStand := &arenaMaskCheckingStand{}
+	maskStand.check(t, a)
+	growthStand := &arenaDynamicGrowthStand{}
+	growthStand.check(t, a)
+	bytesAllocationStand := &arenaByteAllocationCheckingStand{}
+	bytesAllocationStand.check(t, a)
+	bytesBufferAllocationStand := &arenaByteBufferWithErrorAllocationCheckingStand{}
+	bytesBufferAllocationStand.check(t, a)
+	bytesBufferWithPanicAllocationStand := &arenaByteBufferWithPanicAllocationCheckingStand{}
+	bytesBufferWithPanicAllocationStand.check(t, a)
+
+	sub := arena.NewSubAllocator(a, arena.Options{})
+	subStand := &basicArenaCheckingStand{}
+	subStand.check(t, sub)
+
+	resetStand := &arenaResetCheckingStand{speculativeAllocationSize: 1024 * 1024}
+	resetStand.check(t, a)
+	resetStand.checkScope(t, a)
+	resetStand.checkToRefPanicsAfterReset(t, a)
+	reallocStand := &arenaReallocCheckingStand{}
+	reallocStand.check(t, a, true, false)
+}
+
+func TestVirtualArenaIsContiguous(t *testing.T) {
+	t.Parallel()
+	const chunkSize = 1024 * 1024
+
+	a, reserveErr := arena.NewVirtualAllocator(64 * chunkSize)
+	failOnError(t, reserveErr)
+	defer a.Close()
+
+	view := arena.NewBytesView(a)
+	first, allocErr := view.MakeBytes(chunkSize)
+	failOnError(t, allocErr)
+	previous := first
+	for i := 1; i < 64; i++ {
+		current, allocErr := view.MakeBytes(chunkSize)
+		failOnError(t, allocErr)
+		previousBytes := view.BytesToRef(previous)
+		currentBytes := view.BytesToRef(current)
+		assert(
+			uintptr(unsafe.Pointer(&currentBytes[0])) == uintptr(unsafe.Pointer(&previousBytes[0]))+chunkSize,
+			"allocations should be contiguous",
+		)
+		currentBytes[0] = byte(i)
+		previous = current
+	}
+	assert(a.Stats().UsedBytes == 64*chunkSize, "unexpected stats: %v", a.Stats())
+	assert(a.Stats().AllocatedBytes == 64*chunkSize, "unexpected stats: %v", a.Stats())
+	assert(a.Stats().CountOfOnHeapAllocations == 0, "unexpected stats: %v", a.Stats())
+
+	_, allocErr = a.Alloc(1, 1)
+	assert(allocErr == arena.AllocationLimitError, "reserved range should be exhausted: %v", allocErr)
+
+	a.Clear()
+	assert(a.Stats().AllocatedBytes == 64*chunkSize, "committed pages should be kept: %v", a.Stats())
+	bytes, allocErr := view.MakeBytes(64 * chunkSize)
+	failOnError(t, allocErr)
+	for i, b := range view.BytesToRef(bytes) {
+		if b != 0 {
+			t.Fatalf("memory should be clear after Clear. idx: %v", i)
+		}
+	}
+}
+
+func TestVirtualArenaClose(t *testing.T) {
+	t.Parallel()
+	stand := &arenaCloseCheckingStand{}
+	a, reserveErr := arena.NewVirtualAllocator(virtualArenaReservedBytes)
+	failOnError(t, reserveErr)
+	stand.check(t, a)
+
+	_, reserveErr = arena.NewVirtualAllocator(0)
+	assert(reserveErr == arena.AllocationInvalidArgumentError, "unexpected error: %v", reserveErr)
+}
@@ -0,0 +1,218 @@
+package arena_test
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+type zeroOnAllocAllocator interface {
+	allocator
+	AllocRange(minSize, preferredSize, alignment uintptr) (arena.Ptr, uintptr, error)
+	Realloc(p arena.Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (arena.Ptr, error)
+	AllocNoZero(size, alignment uintptr) (arena.Ptr, error)
+}
+
+type arenaZeroOnAllocCheckingStand struct{}
+
+func (s *arenaZeroOnAllocCheckingStand) check(t *testing.T, target zeroOnAllocAllocator) {
+	const size = 64 * 1024
+	for cycle := 0; cycle < 5; cycle++ {
+		s.dirty(t, target, 4*size)
+		target.Clear()
+
+		p, allocErr := target.Alloc(size, 8)
+		failOnError(t, allocErr)
+		s.verifyClean(target, p, 0, size)
+		p, allocErr = target.AllocUnaligned(size)
+		failOnError(t, allocErr)
+		s.verifyClean(target, p, 0, size)
+		p, granted, allocErr := target.AllocRange(size/2, size, 16)
+		failOnError(t, allocErr)
+		s.verifyClean(target, p, 0, int(granted))
+
+		p, allocErr = target.Alloc(16, 8)
+		failOnError(t, allocErr)
+		s.fill(target, p, 16)
+		extended, reallocErr := target.Realloc(p, 16, size, 8)
+		failOnError(t, reallocErr)
+		assert(extended == p, "last allocation should be extended in place: %v; %v", extended, p)
+		s.verifyClean(target, extended, 16, size)
+
+		view := arena.NewBytesView(target)
+		bytes, allocErr := view.MakeBytes(size)
+		failOnError(t, allocErr)
+		for j, b := range view.BytesToRef(bytes) {
+			assert(b == 0, "bytes should be zeroed. idx: %v; value: %v", j, b)
+		}
+		embedded, allocErr := view.EmbedAsString([]byte("embedded without zeroing"))
+		failOnError(t, allocErr)
+		assert(embedded == "embedded without zeroing", "unexpected embedded value: %v", embedded)
+	}
+	target.Clear()
+}
+
+// dirty allocates the specified count of bytes without zeroing and fills them with non-zero values.
+func (s *arenaZeroOnAllocCheckingStand) dirty(t *testing.T, target zeroOnAllocAllocator, bytes int) {
+	view := arena.NewBytesView(target)
+	for i := 0; i < bytes/1024; i++ {
+		b, allocErr := view.MakeBytesUninitialized(1024)
+		failOnError(t, allocErr)
+		for j := range view.BytesToRef(b) {
+			view.BytesToRef(b)[j] = 0xff
+		}
+	}
+}
+
+func (s *arenaZeroOnAllocCheckingStand) fill(target zeroOnAllocAllocator, p arena.Ptr, size int) {
+	ref := target.ToRef(p)
+	for i := 0; i < size; i++ {
+		*(*byte)(unsafe.Pointer(uintptr(ref) + uintptr(i))) = 0xff
+	}
+}
+
+func (s *arenaZeroOnAllocCheckingStand) verifyClean(target zeroOnAllocAllocator, p arena.Ptr, from int, to int) {
+	ref := target.ToRef(p)
+	for i := from; i < to; i++ {
+		value := *(*byte)(unsafe.Pointer(uintptr(ref) + uintptr(i)))
+		assert(value == 0, "allocated memory shouldn't contain stale data. idx: %v; value: %v", i, value)
+	}
+}
+
+func TestZeroOnAllocOnDifferentAllocators(t *testing.T) {
+	t.Parallel()
+	stand := &arenaZeroOnAllocCheckingStand{}
+	zeroer := arena.NewBackgroundZeroer(0)
+	defer zeroer.Close()
+	stand.check(t, arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true}))
+	stand.check(t, arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		ZeroOnAlloc:      true,
+		GrowthStrategy:   arena.FixedGrowth(128 * 1024),
+		BackgroundZeroer: zeroer,
+	}))
+	stand.check(t, arena.NewDynamicAllocator())
+	stand.check(t, arena.NewGenericAllocator(arena.Options{ZeroOnAlloc: true, DelegateClearToUnderlyingAllocator: true}))
+	stand.check(t, arena.NewGenericAllocator(arena.Options{ZeroOnAlloc: true}))
+	stand.check(t, arena.NewSubAllocator(
+		arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true}),
+		arena.Options{DelegateClearToUnderlyingAllocator: true},
+	))
+	stand.check(t, arena.NewRegistry(arena.RegistryOptions{}).NewAllocator(
+		"zero-on-alloc", arena.Options{ZeroOnAlloc: true, DelegateClearToUnderlyingAllocator: true},
+	))
+
+	// the owned target is reused after Clear even without delegation, so its dirty buffers are zeroed on allocation
+	generic := arena.NewGenericAllocator(arena.Options{ZeroOnAlloc: true})
+	stand.dirty(t, generic, 1024*1024)
+	generic.Clear()
+	onHeapAllocations := generic.Stats().CountOfOnHeapAllocations
+	stand.check(t, generic)
+	assert(generic.Stats().CountOfOnHeapAllocations == onHeapAllocations, "buffers should be reused: %v", generic.Stats())
+}
+
+func TestZeroOnAllocTracksDirtyRegionOfEachArena(t *testing.T) {
+	t.Parallel()
+	stand := &arenaZeroOnAllocCheckingStand{}
+	const arenaSize = 64 * 1024
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{
+		ZeroOnAlloc:    true,
+		GrowthStrategy: arena.FixedGrowth(arenaSize),
+	})
+	for cycle := 0; cycle < 3; cycle++ {
+		stand.dirty(t, a, 4*arenaSize)
+		a.Clear()
+
+		// the tail of the first arena is left unallocated, when the allocator switches to the next one
+		head, allocErr := a.Alloc(1024, 8)
+		failOnError(t, allocErr)
+		stand.verifyClean(a, head, 0, 1024)
+		checkpoint := a.CurrentOffset()
+		next, allocErr := a.Alloc(arenaSize, 8)
+		failOnError(t, allocErr)
+		stand.verifyClean(a, next, 0, arenaSize)
+
+		// after ResetTo, the tail of the first arena is reused and should be zeroed as well
+		failOnError(t, a.ResetTo(checkpoint))
+		for i := 0; i < 2*arenaSize/1024; i++ {
+			p, allocErr := a.Alloc(1024, 8)
+			failOnError(t, allocErr)
+			stand.verifyClean(a, p, 0, 1024)
+		}
+	}
+}
+
+func TestZeroOnAllocDumpHasNoStaleData(t *testing.T) {
+	t.Parallel()
+	stand := &arenaZeroOnAllocCheckingStand{}
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true})
+	stand.dirty(t, a, 1024)
+	a.Clear()
+
+	for _, value := range []struct {
+		size      uintptr
+		alignment uintptr
+	}{{1, 1}, {8, 8}, {1, 1}} {
+		p, allocErr := a.AllocNoZero(value.size, value.alignment)
+		failOnError(t, allocErr)
+		stand.fill(a, p, int(value.size))
+	}
+	_, _, allocErr := a.AllocRange(16, 16, 16)
+	failOnError(t, allocErr)
+	assert(a.Stats().UsedBytes == 48, "unexpected stats: %v", a.Stats())
+
+	// only the dump of the used region, including padding, is written after the header,
+	// max alignment, count of arenas and the used size of the only arena
+	dump := &bytes.Buffer{}
+	_, writeErr := a.WriteTo(dump)
+	failOnError(t, writeErr)
+	regionStart := dynamicDumpHeaderSize + 8 + 2 + 4
+	region := dump.Bytes()[regionStart : regionStart+48]
+	expected := make([]byte, 48)
+	expected[0], expected[16] = 0xff, 0xff
+	copy(expected[8:16], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert(bytes.Equal(region, expected), "padding shouldn't contain stale data: %v", region)
+}
+
+func TestAllocNoZeroSkipsZeroing(t *testing.T) {
+	t.Parallel()
+	a := arena.NewDynamicAllocatorWithOptions(arena.DynamicOptions{ZeroOnAlloc: true})
+	view := arena.NewBytesView(a)
+	stale, allocErr := view.EmbedAsString([]byte("stale data"))
+	failOnError(t, allocErr)
+	assert(stale == "stale data", "unexpected embedded value: %v", stale)
+	a.Clear()
+
+	// the same arena is reused after Clear, so its memory isn't zeroed yet,
+	// unless the buffer is replaced by Clear in `arenadebug` mode
+	uninitialized, allocErr := view.MakeBytesUninitialized(len("stale data"))
+	failOnError(t, allocErr)
+	content := string(view.BytesToRef(uninitialized))
+	assert(content == "stale data" || content == string(make([]byte, len("stale data"))), "unexpected content: %q", content)
+	a.Clear()
+	zeroed, allocErr := view.MakeBytes(len("stale data"))
+	failOnError(t, allocErr)
+	for j, b := range view.BytesToRef(zeroed) {
+		assert(b == 0, "bytes should be zeroed. idx: %v; value: %v", j, b)
+	}
+
+	// allocators that zero memory on Clear always return zeroed memory
+	targets := []allocator{
+		arena.NewDynamicAllocator(),
+		arena.NewGenericAllocator(arena.Options{DelegateClearToUnderlyingAllocator: true}),
+		arena.NewInstrumentedAllocator(arena.NewDynamicAllocator()),
+		arena.NewRawAllocator(1024),
+	}
+	for _, target := range targets {
+		targetView := arena.NewBytesView(target)
+		_, allocErr := targetView.Embed([]byte("stale data"))
+		failOnError(t, allocErr)
+		target.Clear()
+		bytes, allocErr := targetView.MakeBytesUninitialized(len("stale data"))
+		failOnError(t, allocErr)
+		for j, b := range targetView.BytesToRef(bytes) {
+			assert(b == 0, "bytes should be zeroed by Clear. idx: %v; value: %v", j, b)
+		}
+	}
+}
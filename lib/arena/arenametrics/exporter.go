@@ -0,0 +1,237 @@
+// Package arenametrics exports allocation statistics of arena allocators
+// through expvar and a Prometheus text-format HTTP handler.
+//
+// It has no dependencies besides the standard library,
+// so the core arena module stays free of the Prometheus client.
+package arenametrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+// AlreadyRegisteredError is returned by Exporter.Register if there is a source with the same name.
+const AlreadyRegisteredError = arena.Error("metrics source with this name is already registered")
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Source is anything that can provide arena.Metrics, like any allocator from the arena package or arena.Registry.
+// If the source also provides arena.EnhancedMetrics, like arena.GenericAllocator, they are exported as well.
+type Source interface {
+	Metrics() arena.Metrics
+}
+
+type enhancedSource interface {
+	EnhancedMetrics() arena.EnhancedMetrics
+}
+
+type metricFamily struct {
+	name  string
+	help  string
+	value func(arena.EnhancedMetrics) int
+}
+
+func metricFamilies() []metricFamily {
+	return []metricFamily{
+		{
+			name:  "arena_used_bytes",
+			help:  "Count of bytes actually allocated and used inside an arena.",
+			value: func(m arena.EnhancedMetrics) int { return m.UsedBytes },
+		},
+		{
+			name:  "arena_allocated_bytes",
+			help:  "Count of bytes that are allocated inside the general heap.",
+			value: func(m arena.EnhancedMetrics) int { return m.AllocatedBytes },
+		},
+		{
+			name:  "arena_on_heap_allocations",
+			help:  "Count of allocations performed inside the general heap.",
+			value: func(m arena.EnhancedMetrics) int { return m.CountOfOnHeapAllocations },
+		},
+		{
+			name:  "arena_available_bytes",
+			help:  "Count of bytes available for allocation without arena growth.",
+			value: func(m arena.EnhancedMetrics) int { return m.AvailableBytes },
+		},
+		{
+			name:  "arena_retained_bytes",
+			help:  "Count of allocated bytes retained in clear buffers for future allocations.",
+			value: func(m arena.EnhancedMetrics) int { return m.RetainedBytes },
+		},
+		{
+			name:  "arena_pending_dirty_bytes",
+			help:  "Count of allocated bytes waiting for zeroing in the background.",
+			value: func(m arena.EnhancedMetrics) int { return m.PendingDirtyBytes },
+		},
+	}
+}
+
+func enhancedMetricFamilies() []metricFamily {
+	return []metricFamily{
+		{
+			name:  "arena_padding_overhead_bytes",
+			help:  "Count of bytes used for alignment padding.",
+			value: func(m arena.EnhancedMetrics) int { return m.PaddingOverhead },
+		},
+		{
+			name:  "arena_data_bytes",
+			help:  "Count of bytes used specifically for useful data.",
+			value: func(m arena.EnhancedMetrics) int { return m.DataBytes },
+		},
+		{
+			name:  "arena_free_list_bytes",
+			help:  "Count of freed bytes that are kept for reuse.",
+			value: func(m arena.EnhancedMetrics) int { return m.FreeListBytes },
+		},
+		{
+			name:  "arena_fragmentation_bytes",
+			help:  "Count of bytes lost due to rounding of allocations to size classes.",
+			value: func(m arena.EnhancedMetrics) int { return m.FragmentationBytes },
+		},
+		{
+			name:  "arena_allocations",
+			help:  "Count of Alloc calls.",
+			value: func(m arena.EnhancedMetrics) int { return m.CountOfAllocations },
+		},
+	}
+}
+
+// Exporter is a thread-safe set of named metric sources that can be exposed
+// through expvar by Exporter.PublishExpvar or scraped by Prometheus through Exporter.ServeHTTP.
+//
+// Sources are read from goroutines of expvar or HTTP handlers,
+// but allocators from the arena package aren't safe for concurrent use,
+// so please register allocators that are used concurrently with the export wrapped by WithLock,
+// or register thread-safe sources, like arena.Registry.
+type Exporter struct {
+	mu      sync.Mutex
+	sources map[string]Source
+}
+
+// NewExporter creates an instance of arenametrics.Exporter.
+func NewExporter() *Exporter {
+	return &Exporter{sources: make(map[string]Source)}
+}
+
+// Register adds the source under the specified name, which is used as the allocator label value.
+// Register returns AlreadyRegisteredError if there is a source with the same name.
+func (e *Exporter) Register(name string, source Source) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.sources[name]; ok {
+		return AlreadyRegisteredError
+	}
+	e.sources[name] = source
+	return nil
+}
+
+// Unregister removes the source with the specified name, if there is one.
+func (e *Exporter) Unregister(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.sources, name)
+}
+
+// PublishExpvar publishes Exporter.Expvar under the specified name.
+// As any other expvar variable, it can be published only once, otherwise PublishExpvar panics.
+func (e *Exporter) PublishExpvar(name string) {
+	expvar.Publish(name, e.Expvar())
+}
+
+// Expvar returns an expvar variable that provides a snapshot of metrics of all registered sources,
+// where every source is represented by its arena.Metrics or arena.EnhancedMetrics.
+func (e *Exporter) Expvar() expvar.Var {
+	return expvar.Func(func() interface{} {
+		result := make(map[string]interface{})
+		for _, snapshot := range e.snapshot() {
+			if snapshot.enhanced {
+				result[snapshot.name] = snapshot.metrics
+				continue
+			}
+			result[snapshot.name] = snapshot.metrics.Metrics
+		}
+		return result
+	})
+}
+
+// ServeHTTP writes metrics of all registered sources in the Prometheus text exposition format,
+// so the Exporter can be used as a scraping endpoint.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	_ = e.WritePrometheus(w)
+}
+
+// WritePrometheus writes metrics of all registered sources to w in the Prometheus text exposition format.
+// All metrics are gauges labeled by the source name.
+// Metrics specific to arena.EnhancedMetrics are written only for sources that provide them.
+func (e *Exporter) WritePrometheus(w io.Writer) error {
+	snapshots := e.snapshot()
+	enhancedSnapshots := make([]sourceSnapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.enhanced {
+			enhancedSnapshots = append(enhancedSnapshots, snapshot)
+		}
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, family := range metricFamilies() {
+		writeFamily(buf, family, snapshots)
+	}
+	for _, family := range enhancedMetricFamilies() {
+		writeFamily(buf, family, enhancedSnapshots)
+	}
+	return buf.Flush()
+}
+
+type sourceSnapshot struct {
+	name     string
+	metrics  arena.EnhancedMetrics
+	enhanced bool
+}
+
+func (e *Exporter) snapshot() []sourceSnapshot {
+	e.mu.Lock()
+	sources := make(map[string]Source, len(e.sources))
+	for name, source := range e.sources {
+		sources[name] = source
+	}
+	e.mu.Unlock()
+
+	result := make([]sourceSnapshot, 0, len(sources))
+	for name, source := range sources {
+		if enhanced, ok := source.(enhancedSource); ok {
+			result = append(result, sourceSnapshot{name: name, metrics: enhanced.EnhancedMetrics(), enhanced: true})
+			continue
+		}
+		result = append(result, sourceSnapshot{name: name, metrics: arena.EnhancedMetrics{Metrics: source.Metrics()}})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+func writeFamily(w *bufio.Writer, family metricFamily, snapshots []sourceSnapshot) {
+	if len(snapshots) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v gauge\n", family.name, family.help, family.name)
+	for _, snapshot := range snapshots {
+		_, _ = fmt.Fprintf(
+			w, "%v{allocator=\"%v\"} %v\n",
+			family.name, escapeLabelValue(snapshot.name), family.value(snapshot.metrics),
+		)
+	}
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
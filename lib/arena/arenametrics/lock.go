@@ -0,0 +1,39 @@
+package arenametrics
+
+import (
+	"sync"
+
+	"github.com/storozhukBM/allocator/lib/arena"
+)
+
+// WithLock wraps the source that isn't safe for concurrent use, so every metrics snapshot
+// is taken under the specified lock. The same lock should guard all other usages of the source.
+// If the source provides arena.EnhancedMetrics, the result provides them as well.
+func WithLock(source Source, lock sync.Locker) Source {
+	if enhanced, ok := source.(enhancedSource); ok {
+		return &lockedEnhancedSource{lockedSource: lockedSource{source: source, lock: lock}, enhanced: enhanced}
+	}
+	return &lockedSource{source: source, lock: lock}
+}
+
+type lockedSource struct {
+	source Source
+	lock   sync.Locker
+}
+
+func (s *lockedSource) Metrics() arena.Metrics {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.source.Metrics()
+}
+
+type lockedEnhancedSource struct {
+	lockedSource
+	enhanced enhancedSource
+}
+
+func (s *lockedEnhancedSource) EnhancedMetrics() arena.EnhancedMetrics {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.enhanced.EnhancedMetrics()
+}
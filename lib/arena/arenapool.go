@@ -0,0 +1,166 @@
+package arena
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// count of Put calls after which the pool starts to forget the peak usage observed before
+	arenaPoolPeakWindow = 64
+	// pooled allocator is considered as oversized if it allocated more than this ratio of the peak usage
+	arenaPoolOversizeRatio = 4
+)
+
+// ArenaPoolStats is a snapshot of arena.ArenaPool statistics.
+type ArenaPoolStats struct {
+	Name           string // name of the pool
+	Hits           int    // count of Get calls served by idle allocators
+	Misses         int    // count of Get calls that created a new pre-warmed allocator
+	Discarded      int    // count of allocators that were closed instead of pooling because they were oversized
+	IdleAllocators int    // count of allocators currently waiting in the pool
+	PeakUsedBytes  int    // recent peak of used bytes that is used to pre-warm new allocators
+}
+
+// String provides a string snapshot of the ArenaPoolStats.
+func (s ArenaPoolStats) String() string {
+	return fmt.Sprintf(
+		"{Name: %v Hits: %v Misses: %v Discarded: %v IdleAllocators: %v PeakUsedBytes: %v}",
+		s.Name, s.Hits, s.Misses, s.Discarded, s.IdleAllocators, s.PeakUsedBytes,
+	)
+}
+
+// ArenaPool is a thread-safe pool of arena.DynamicAllocator instances issued by arena.Registry
+// and dedicated to one kind of workload, like allocations of one generated type.
+//
+// ArenaPool.Get hands out an idle allocator or, if there is none, a new allocator that is pre-warmed
+// with a buffer big enough to fit the recent peak usage of the pool.
+// ArenaPool.Put clears the allocator and takes it back, so steady-state workloads,
+// like per-request allocations, reuse already allocated buffers and never allocate them from the heap.
+//
+// Allocators that allocated much more memory than the recent peak usage,
+// for example, after a rare spike of load, are closed instead of pooling,
+// so their budget is returned to the registry.
+//
+// Pooled allocators take their memory from the registry budget,
+// including the memory of idle allocators waiting in the pool.
+// Registry tracks AllocatedBytes of pooled allocators, but not their UsedBytes,
+// since DynamicAllocator doesn't publish its metrics on every allocation.
+type ArenaPool struct {
+	registry *Registry
+	name     string
+
+	mu                 sync.Mutex
+	idle               []*DynamicAllocator
+	countOfPuts        int
+	currentWindowPeak  int
+	previousWindowPeak int
+	hits               int
+	misses             int
+	discarded          int
+}
+
+// Get hands out an idle allocator from the pool or creates a new pre-warmed one.
+// Allocator should be returned to the pool by ArenaPool.Put as soon as it isn't needed,
+// and can't be used after that.
+func (p *ArenaPool) Get() *DynamicAllocator {
+	p.mu.Lock()
+	if len(p.idle) > 0 {
+		result := p.idle[len(p.idle)-1]
+		p.idle[len(p.idle)-1] = nil
+		p.idle = p.idle[:len(p.idle)-1]
+		p.hits++
+		p.mu.Unlock()
+		return result
+	}
+	p.misses++
+	peakUsedBytes := p.peakUsedBytes()
+	p.mu.Unlock()
+
+	result := p.registry.newDynamicAllocator(&registryMember{registry: p.registry, pool: p, name: p.name})
+	if peakUsedBytes > 0 {
+		// if the registry budget can't afford pre-warming, the allocator will grow on demand
+		newArena, ok := result.getNewArena(peakUsedBytes, peakUsedBytes)
+		if ok {
+			result.currentArena = newArena
+		}
+	}
+	return result
+}
+
+// Put clears the allocator and returns it to the pool.
+//
+// Allocator should be issued by the same pool, otherwise Put panics.
+// Closed allocators are ignored.
+func (p *ArenaPool) Put(a *DynamicAllocator) {
+	if a.registryMember == nil || a.registryMember.pool != p {
+		panic("allocator isn't part of this pool")
+	}
+	if a.closed {
+		return
+	}
+	usedBytes := a.usedBytes
+	a.Clear()
+	a.registryMember.publishUsedBytes(0)
+
+	p.mu.Lock()
+	p.currentWindowPeak = max(p.currentWindowPeak, usedBytes)
+	p.countOfPuts++
+	var oversized []*DynamicAllocator
+	if p.countOfPuts%arenaPoolPeakWindow == 0 {
+		p.previousWindowPeak = p.currentWindowPeak
+		p.currentWindowPeak = 0
+		oversized = p.dropOversizedIdleAllocators()
+	}
+	if p.isOversized(a) {
+		oversized = append(oversized, a)
+	} else {
+		p.idle = append(p.idle, a)
+	}
+	p.discarded += len(oversized)
+	p.mu.Unlock()
+
+	for _, oversizedAllocator := range oversized {
+		oversizedAllocator.Close()
+	}
+}
+
+// Stats provides a snapshot of the pool statistics.
+func (p *ArenaPool) Stats() ArenaPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ArenaPoolStats{
+		Name:           p.name,
+		Hits:           p.hits,
+		Misses:         p.misses,
+		Discarded:      p.discarded,
+		IdleAllocators: len(p.idle),
+		PeakUsedBytes:  p.peakUsedBytes(),
+	}
+}
+
+func (p *ArenaPool) peakUsedBytes() int {
+	return max(p.currentWindowPeak, p.previousWindowPeak)
+}
+
+func (p *ArenaPool) isOversized(a *DynamicAllocator) bool {
+	optimalSize := int(optimalRawAllocatorSize(uint32(p.peakUsedBytes())))
+	return a.allocatedBytes > arenaPoolOversizeRatio*optimalSize
+}
+
+func (p *ArenaPool) dropOversizedIdleAllocators() []*DynamicAllocator {
+	var result []*DynamicAllocator
+	idle := p.idle[:0]
+	for _, a := range p.idle {
+		if p.isOversized(a) {
+			result = append(result, a)
+			continue
+		}
+		idle = append(idle, a)
+	}
+	for i := len(idle); i < len(p.idle); i++ {
+		p.idle[i] = nil
+	}
+	p.idle = idle
+	return result
+}
@@ -0,0 +1,499 @@
+package arena
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"unsafe"
+)
+
+const (
+	defaultBuddyMinBlockSize = 4 * 1024
+	defaultBuddyMaxBlockSize = 1024 * 1024
+)
+
+const (
+	buddyBlockNone uint8 = iota // part of another block
+	buddyBlockFree
+	buddyBlockAllocated
+)
+
+// buddyBlock is a metadata of the block that starts at the corresponding min block of the region.
+type buddyBlock struct {
+	prev  int32 // free-list links, -1 if there is no such block
+	next  int32
+	size  uint32 // requested size of the allocated block
+	state uint8
+	order uint8
+}
+
+// BuddyAllocator is the allocator of power-of-two blocks within one contiguous region,
+// that supports Free of individual blocks in arbitrary order and merges freed buddies back into large blocks.
+//
+// It is intended for pools of blocks of different sizes, like network buffers,
+// where blocks are freed in arbitrary order and external fragmentation should be avoided.
+//
+// Requested sizes are rounded up to the nearest power of two between BuddyOptions.MinBlockSize
+// and BuddyOptions.MaxBlockSize, so internal fragmentation can be up to a half of the block,
+// please refer to arena.EnhancedMetrics FragmentationBytes to monitor it.
+// Metadata of blocks is stored on the heap, it takes 16 bytes per each min block of the region.
+//
+// It can prevent some types of unsafe behaviour by throwing panics:
+//  - ToRef call with arena.Ptr that wasn't allocated by this arena.
+//  - ToRef call with arena.Ptr that was allocated before arena.BuddyAllocator.Clear call.
+//  - Free call with arena.Ptr that isn't the start of the allocated block, including double free.
+//  - Alloc call with unsupported alignment value.
+//
+// Since it has fixed capacity and supports Free, it can be used as a target of arena.NewSubAllocator
+// to split one region between different functional scopes.
+//
+// BuddyAllocator should be created by NewBuddyAllocator.
+type BuddyAllocator struct {
+	raw             RawAllocator
+	startPtr        uintptr
+	capacity        uintptr
+	regionAlignment uintptr
+	minBlockShift   uint
+	maxOrder        int
+
+	blocks    []buddyBlock
+	freeLists []int32
+
+	usedBytes   int
+	dataBytes   int
+	allocations int
+
+	arenaMask uint16
+	check     ptrCheck
+	closed    bool
+}
+
+// BuddyOptions is a structure used to configure arena.BuddyAllocator.
+//
+// You can configure:
+//  - MinBlockSize - size of the smallest block, should be a power of 2, 4KB by default.
+//  - MaxBlockSize - size of the biggest block, should be a power of 2, 1MB by default.
+//  - Capacity - size of the whole region, it is rounded up to MaxBlockSize, by default it is one MaxBlockSize.
+//  - Mmap - allocate the region by mmap outside of the Go heap,
+//    for additional details please refer to arena.NewMmapRawAllocator documentation.
+type BuddyOptions struct {
+	MinBlockSize uint32
+	MaxBlockSize uint32
+	Capacity     uint32
+	Mmap         *MmapOptions
+}
+
+// NewBuddyAllocator creates an instance of arena.BuddyAllocator configured by BuddyOptions
+// and allocates its whole region in advance.
+//
+// It returns arena.AllocationInvalidArgumentError if block sizes aren't powers of 2
+// or the region is too big, and errors of arena.NewMmapRawAllocator if BuddyOptions.Mmap is specified.
+func NewBuddyAllocator(opts BuddyOptions) (*BuddyAllocator, error) {
+	minBlockSize := uint64(opts.MinBlockSize)
+	if minBlockSize == 0 {
+		minBlockSize = defaultBuddyMinBlockSize
+	}
+	maxBlockSize := uint64(opts.MaxBlockSize)
+	if maxBlockSize == 0 {
+		maxBlockSize = defaultBuddyMaxBlockSize
+	}
+	if !isPowerOfTwo(uintptr(minBlockSize)) || !isPowerOfTwo(uintptr(maxBlockSize)) || minBlockSize > maxBlockSize {
+		return nil, AllocationInvalidArgumentError
+	}
+	capacity := uint64(opts.Capacity)
+	if capacity < maxBlockSize {
+		capacity = maxBlockSize
+	}
+	capacity += uint64(calculatePadding(uintptr(capacity), uintptr(maxBlockSize)))
+	if capacity > math.MaxUint32 || capacity/minBlockSize > math.MaxInt32 {
+		return nil, AllocationInvalidArgumentError
+	}
+
+	raw := &RawAllocator{}
+	if opts.Mmap != nil {
+		mmapRaw, mmapErr := NewMmapRawAllocator(uint32(capacity), *opts.Mmap)
+		if mmapErr != nil {
+			return nil, mmapErr
+		}
+		raw = mmapRaw
+	} else {
+		raw = NewRawAllocator(uint32(capacity))
+	}
+
+	startPtr := uintptr(raw.startPtr)
+	result := &BuddyAllocator{
+		raw:             *raw,
+		startPtr:        startPtr,
+		capacity:        uintptr(capacity),
+		regionAlignment: startPtr & -startPtr,
+		minBlockShift:   uint(bits.TrailingZeros64(minBlockSize)),
+		maxOrder:        bits.TrailingZeros64(maxBlockSize) - bits.TrailingZeros64(minBlockSize),
+		blocks:          make([]buddyBlock, capacity/minBlockSize),
+	}
+	result.freeLists = make([]int32, result.maxOrder+1)
+	result.resetBlocks()
+	result.init()
+	return result, nil
+}
+
+// AllocUnaligned performs allocation of the block that fits size bytes.
+// Since all blocks are aligned, it is the same as Alloc with alignment of 1 byte.
+func (a *BuddyAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	return a.Alloc(size, 1)
+}
+
+// Alloc performs allocation of the smallest power-of-two block that fits size bytes,
+// splitting bigger free blocks if necessary.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+// Blocks are aligned at least to their size, as long as the region start is aligned to it,
+// so Alloc returns arena.AllocationInvalidArgumentError for alignment bigger than the alignment of the region.
+//
+// Alloc returns arena.AllocationLimitError if size is bigger than BuddyOptions.MaxBlockSize
+// or if there is no free block that can fit it.
+//
+// arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
+// but we'd suggest to do it right before use to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+// Allocated block can be returned to the allocator by BuddyAllocator.Free.
+func (a *BuddyAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	a.init()
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if alignment > a.regionAlignment {
+		return Ptr{}, AllocationInvalidArgumentError
+	}
+	requiredSize := size
+	if requiredSize < alignment {
+		requiredSize = alignment
+	}
+	if requiredSize > a.blockSize(a.maxOrder) {
+		return Ptr{}, AllocationLimitError
+	}
+	order := a.orderOf(requiredSize)
+	freeOrder := order
+	for freeOrder <= a.maxOrder && a.freeLists[freeOrder] < 0 {
+		freeOrder++
+	}
+	if freeOrder > a.maxOrder {
+		return Ptr{}, AllocationLimitError
+	}
+
+	idx := a.freeLists[freeOrder]
+	a.removeFreeBlock(idx)
+	for freeOrder > order {
+		freeOrder--
+		a.pushFreeBlock(idx+1<<freeOrder, freeOrder)
+	}
+	a.blocks[idx] = buddyBlock{prev: -1, next: -1, size: uint32(size), state: buddyBlockAllocated, order: uint8(order)}
+
+	a.usedBytes += int(a.blockSize(order))
+	a.dataBytes += int(size)
+	a.allocations++
+	return Ptr{offset: a.startPtr + uintptr(idx)<<a.minBlockShift, arenaMask: a.arenaMask, check: a.check}, nil
+}
+
+// Free returns the block referenced by arena.Ptr to the allocator
+// and merges it with its free buddy blocks into bigger blocks.
+// Block memory is filled with zeros, so values allocated in the reused block are always clear.
+//
+// Free panics if arena.Ptr wasn't allocated by this allocator, was allocated before Clear,
+// isn't the start of the allocated block, or the block is already freed.
+// Any usage of arena.Ptr or values converted by ToRef after Free is a "use after free" error.
+func (a *BuddyAllocator) Free(p Ptr) {
+	a.ToRef(p)
+	blockOffset := p.offset - a.startPtr
+	idx := int32(blockOffset >> a.minBlockShift)
+	if blockOffset&(1<<a.minBlockShift-1) != 0 || a.blocks[idx].state != buddyBlockAllocated {
+		panic(fmt.Sprintf("pointer isn't an allocated block of this arena: %v", p))
+	}
+
+	block := a.blocks[idx]
+	order := int(block.order)
+	a.clearBlock(idx, order)
+	a.usedBytes -= int(a.blockSize(order))
+	a.dataBytes -= int(block.size)
+	a.blocks[idx] = buddyBlock{}
+
+	for order < a.maxOrder {
+		buddyIdx := idx ^ 1<<order
+		buddy := a.blocks[buddyIdx]
+		if buddy.state != buddyBlockFree || int(buddy.order) != order {
+			break
+		}
+		a.removeFreeBlock(buddyIdx)
+		if buddyIdx < idx {
+			idx = buddyIdx
+		}
+		order++
+	}
+	a.pushFreeBlock(idx, order)
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// If arena.Ptr is the start of the allocated block, oldSize isn't smaller than the size of the block value,
+// and newSize fits into this block or into the bigger block merged with its free buddies,
+// it is extended in place and the same arena.Ptr is returned.
+// Otherwise, the value is copied into a new block, and the previous block is freed,
+// so arena.Ptr should be the start of the allocated block, the same as for BuddyAllocator.Free.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *BuddyAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	a.init()
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	if oldSize > 0 && a.extendInPlace(p, oldSize, newSize, alignment) {
+		return p, nil
+	}
+	return reallocByMove(a, p, oldSize, newSize, alignment)
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer.
+//
+// This method performs bounds check, so it can panic if you pass an arena.Ptr
+// allocated by different arena with internal offset out of the region.
+//
+// Also, this BuddyAllocator.ToRef has protection and can panic if you try to convert arena.Ptr
+// that was allocated by other arena, this is done by comparison of arena.Ptr.arenaMask fields.
+//
+// We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+//go:nocheckptr
+func (a *BuddyAllocator) ToRef(p Ptr) unsafe.Pointer {
+	if p.arenaMask != a.arenaMask || p.check != a.check || p.bucketIdx != 0 {
+		a.panicIfClosed()
+		panic("pointer isn't part of this arena")
+	}
+	if p.offset < a.startPtr || p.offset >= a.startPtr+a.capacity {
+		panic(fmt.Sprintf(
+			"buddy arena index out of range. "+
+				"requested ptr: %#x; arena: [%#x: %#x)",
+			p.offset, a.startPtr, a.startPtr+a.capacity,
+		))
+	}
+	return addressToRef(p.offset)
+}
+
+// CurrentOffset returns the offset of the region start.
+// arena.BuddyAllocator doesn't allocate blocks consecutively, so it can be used only to identify the allocator,
+// for example, by other allocators built on top of arena.BuddyAllocator.
+func (a *BuddyAllocator) CurrentOffset() Offset {
+	a.init()
+	return Offset{p: Ptr{offset: a.startPtr, arenaMask: a.arenaMask, check: a.check}}
+}
+
+// Clear fills all allocated blocks with zeros and frees them at once.
+//
+// Clear invocation also changes the arena.BuddyAllocator.arenaMask
+// so it can prevent some "use after free" arena.BuddyAllocator.ToRef calls with arena.Ptr allocated before Clear,
+// but it can't catch usages of already converted values.
+//
+// Clear has no effect on the closed allocator.
+func (a *BuddyAllocator) Clear() {
+	if a.closed {
+		return
+	}
+	for idx := range a.blocks {
+		if a.blocks[idx].state == buddyBlockAllocated {
+			a.clearBlock(int32(idx), int(a.blocks[idx].order))
+		}
+	}
+	a.resetBlocks()
+	a.usedBytes = 0
+	a.dataBytes = 0
+	a.arenaMask = (a.arenaMask + 1) | 1
+	a.check = a.check.next()
+}
+
+// Close gets rid of the region and makes the allocator unusable.
+// If the allocator is created with BuddyOptions.Mmap, the region is returned to the OS immediately,
+// otherwise it is left to the GC.
+//
+// Any subsequent call to Alloc, AllocUnaligned, Realloc, Free, CurrentOffset or ToRef
+// will panic with arena.AllocatorClosedError, and for mmap-backed allocators
+// any usage of values allocated before Close leads to the segmentation fault.
+// Close is idempotent, and Clear has no effect on the closed allocator.
+func (a *BuddyAllocator) Close() {
+	if a.closed {
+		return
+	}
+	releaseErr := a.raw.Release()
+	if releaseErr != nil {
+		panic(releaseErr)
+	}
+	*a = BuddyAllocator{closed: true}
+}
+
+// Stats provides a snapshot of essential allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// UsedBytes of arena.BuddyAllocator is the count of bytes of allocated blocks,
+// and AllocatedBytes is the size of the whole region.
+func (a *BuddyAllocator) Stats() Stats {
+	result := Stats{
+		UsedBytes:      a.usedBytes,
+		AllocatedBytes: int(a.capacity),
+	}
+	if a.capacity > 0 && !a.raw.mmapped {
+		result.CountOfOnHeapAllocations = 1
+	}
+	return result
+}
+
+// Metrics provides a snapshot of current allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// AvailableBytes of arena.BuddyAllocator is the count of bytes of all free blocks,
+// but due to external fragmentation, the biggest block that can be allocated can be smaller.
+func (a *BuddyAllocator) Metrics() Metrics {
+	return Metrics{
+		Stats:          a.Stats(),
+		AvailableBytes: int(a.capacity) - a.usedBytes,
+		MaxCapacity:    int(a.capacity),
+	}
+}
+
+// EnhancedMetrics provides a snapshot of detailed allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// FragmentationBytes of arena.BuddyAllocator is the count of bytes lost due to rounding
+// of allocated values up to the power-of-two blocks, and FreeListBytes is the count of bytes of all free blocks.
+func (a *BuddyAllocator) EnhancedMetrics() EnhancedMetrics {
+	return EnhancedMetrics{
+		Metrics:            a.Metrics(),
+		CountOfAllocations: a.allocations,
+		DataBytes:          a.dataBytes,
+		FreeListBytes:      int(a.capacity) - a.usedBytes,
+		FragmentationBytes: a.usedBytes - a.dataBytes,
+	}
+}
+
+// String provides a string snapshot of the current state of the allocator.
+func (a *BuddyAllocator) String() string {
+	if a.closed {
+		return "buddyarena{closed}"
+	}
+	return fmt.Sprintf("buddyarena{mask: %v used: %v capacity: %v}", a.arenaMask, a.usedBytes, a.capacity)
+}
+
+func (a *BuddyAllocator) orderOf(size uintptr) int {
+	if size <= 1<<a.minBlockShift {
+		return 0
+	}
+	return bits.Len(uint(size-1)) - int(a.minBlockShift)
+}
+
+func (a *BuddyAllocator) blockSize(order int) uintptr {
+	return 1 << (a.minBlockShift + uint(order))
+}
+
+// extendInPlace grows the allocated block that starts at arena.Ptr to fit newSize by merging it with its free buddies.
+// It reports false if arena.Ptr isn't the start of the allocated block or its buddies aren't free.
+// If oldSize is smaller than the size of the block value, the rest of the value can be still used,
+// for example, by the original slice of the shortened one, so it can't be overwritten.
+func (a *BuddyAllocator) extendInPlace(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) bool {
+	a.ToRef(p)
+	blockOffset := p.offset - a.startPtr
+	idx := int32(blockOffset >> a.minBlockShift)
+	if blockOffset&(1<<a.minBlockShift-1) != 0 || p.offset&(alignment-1) != 0 || a.blocks[idx].state != buddyBlockAllocated {
+		return false
+	}
+	if oldSize < uintptr(a.blocks[idx].size) {
+		return false
+	}
+	if newSize > a.blockSize(a.maxOrder) {
+		return false
+	}
+	order := int(a.blocks[idx].order)
+	targetOrder := a.orderOf(newSize)
+	for k := order; k < targetOrder; k++ {
+		// only the left buddy can be extended, and the right one should be inside the region
+		buddyIdx := idx + 1<<k
+		if idx&(1<<k) != 0 || int(buddyIdx) >= len(a.blocks) {
+			return false
+		}
+		buddy := a.blocks[buddyIdx]
+		if buddy.state != buddyBlockFree || int(buddy.order) != k {
+			return false
+		}
+	}
+	for k := order; k < targetOrder; k++ {
+		a.removeFreeBlock(idx + 1<<k)
+	}
+	if targetOrder > order {
+		a.usedBytes += int(a.blockSize(targetOrder) - a.blockSize(order))
+		a.blocks[idx].order = uint8(targetOrder)
+	}
+	a.dataBytes += int(newSize) - int(a.blocks[idx].size)
+	a.blocks[idx].size = uint32(newSize)
+	return true
+}
+
+func (a *BuddyAllocator) pushFreeBlock(idx int32, order int) {
+	head := a.freeLists[order]
+	a.blocks[idx] = buddyBlock{prev: -1, next: head, state: buddyBlockFree, order: uint8(order)}
+	if head >= 0 {
+		a.blocks[head].prev = idx
+	}
+	a.freeLists[order] = idx
+}
+
+func (a *BuddyAllocator) removeFreeBlock(idx int32) {
+	block := a.blocks[idx]
+	if block.prev >= 0 {
+		a.blocks[block.prev].next = block.next
+	} else {
+		a.freeLists[block.order] = block.next
+	}
+	if block.next >= 0 {
+		a.blocks[block.next].prev = block.prev
+	}
+	a.blocks[idx] = buddyBlock{}
+}
+
+// clearBlock fills the block with zeros, large blocks of mmap-backed region are returned to the OS instead.
+func (a *BuddyAllocator) clearBlock(idx int32, order int) {
+	blockStart := uintptr(idx) << a.minBlockShift
+	bytesToClear := a.raw.buffer()[blockStart : blockStart+a.blockSize(order)]
+	if a.raw.mmapped && len(bytesToClear) >= int(minInternalBufferSize) && releaseRawBufferPages(bytesToClear) == nil {
+		return
+	}
+	clearBytes(bytesToClear)
+}
+
+func (a *BuddyAllocator) resetBlocks() {
+	for i := range a.blocks {
+		a.blocks[i] = buddyBlock{}
+	}
+	for order := range a.freeLists {
+		a.freeLists[order] = -1
+	}
+	maxBlockBlocks := int32(1) << a.maxOrder
+	for idx := int32(0); int(idx) < len(a.blocks); idx += maxBlockBlocks {
+		a.pushFreeBlock(idx, a.maxOrder)
+	}
+}
+
+func (a *BuddyAllocator) init() {
+	if a.arenaMask == 0 {
+		a.panicIfClosed()
+		a.arenaMask = uint16(rand.Uint32()) | 1
+		a.check = newPtrCheck()
+	}
+}
+
+func (a *BuddyAllocator) panicIfClosed() {
+	if a.closed {
+		panic(AllocatorClosedError)
+	}
+}
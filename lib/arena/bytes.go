@@ -60,6 +60,7 @@ func (b Bytes) SubSlice(low int, high int) Bytes {
 			offset:    b.data.offset + uintptr(low),
 			bucketIdx: b.data.bucketIdx,
 			arenaMask: b.data.arenaMask,
+			check:     b.data.check,
 		},
 		len: uintptr(high - low),
 		cap: b.cap - uintptr(low),
@@ -98,6 +99,28 @@ func (s *BytesView) MakeBytes(len int) (Bytes, error) {
 	}, nil
 }
 
+// MakeBytesUninitialized allocates a slice with specified length inside your target allocator,
+// but it allows the target to skip zeroing of the slice, so it can contain stale data.
+// Only allocators created with ZeroOnAlloc option skip zeroing,
+// for other allocators MakeBytesUninitialized is the same as MakeBytes.
+//
+// Please use it only if you fully overwrite the slice before reading it.
+func (s *BytesView) MakeBytesUninitialized(len int) (Bytes, error) {
+	uninitializedAlloc, ok := s.alloc.(uninitializedAllocator)
+	if !ok {
+		return s.MakeBytes(len)
+	}
+	slicePtr, allocErr := uninitializedAlloc.AllocNoZero(uintptr(len), 1)
+	if allocErr != nil {
+		return Bytes{}, allocErr
+	}
+	return Bytes{
+		data: slicePtr,
+		len:  uintptr(len),
+		cap:  uintptr(len),
+	}, nil
+}
+
 // MakeBytesWithCapacity is a direct analog of make([]byte, len, cap)
 // It allocates a slice with specified length and capacity inside your target allocator.
 func (s *BytesView) MakeBytesWithCapacity(length int, capacity int) (Bytes, error) {
@@ -112,6 +135,39 @@ func (s *BytesView) MakeBytesWithCapacity(length int, capacity int) (Bytes, erro
 	return bytes, nil
 }
 
+// MakeBytesInRange allocates a slice with length of at least minLen and at most preferredLen
+// inside your target allocator.
+//
+// It can be used if you'd rather get a smaller slice than arena.AllocationLimitError,
+// for example, to stream records into the allocator with specified allocation limit.
+// Resulting slice has the same length and capacity, so please refer to arena.Bytes.SubSlice
+// if you want to use it as an empty buffer.
+//
+// If the target allocator doesn't support AllocRange, preferredLen will be allocated,
+// with fallback to minLen if the target can't afford it.
+func (s *BytesView) MakeBytesInRange(minLen int, preferredLen int) (Bytes, error) {
+	if minLen < 0 || preferredLen < minLen {
+		return Bytes{}, AllocationInvalidArgumentError
+	}
+	rangeAlloc, ok := s.alloc.(rangeAllocator)
+	if !ok {
+		bytes, allocErr := s.MakeBytes(preferredLen)
+		if allocErr != AllocationLimitError || minLen == preferredLen {
+			return bytes, allocErr
+		}
+		return s.MakeBytes(minLen)
+	}
+	slicePtr, size, allocErr := rangeAlloc.AllocRange(uintptr(minLen), uintptr(preferredLen), 1)
+	if allocErr != nil {
+		return Bytes{}, allocErr
+	}
+	return Bytes{
+		data: slicePtr,
+		len:  size,
+		cap:  size,
+	}, nil
+}
+
 // Append is a direct analog of append([]byte, ...byte).
 // If necessary, it will allocate additional bytes from underlying allocator.
 func (s *BytesView) Append(bytesSlice Bytes, bytesToAppend ...byte) (Bytes, error) {
@@ -154,7 +210,8 @@ func (s *BytesView) AppendByte(bytesSlice Bytes, byteToAppend byte) (Bytes, erro
 // but you want to eliminate excessive allocations or for future bytes manipulation
 // or just to hide this byte slice from GC.
 func (s *BytesView) Embed(src []byte) (Bytes, error) {
-	result, allocErr := s.MakeBytes(len(src))
+	// the whole slice is overwritten, so there is no need to zero it
+	result, allocErr := s.MakeBytesUninitialized(len(src))
 	if allocErr != nil {
 		return Bytes{}, allocErr
 	}
@@ -225,6 +282,17 @@ func (s *BytesView) CopyBytesToStringOnHeap(bytes Bytes) string {
 	return *(*string)(unsafe.Pointer(&copyOnHeap))
 }
 
+// Free returns memory of arena.Bytes to the target allocator, so it can be reused by subsequent allocations.
+// Only allocators that can free values of any size, like arena.SizeClassAllocator or arena.BuddyAllocator,
+// support it, for other allocators it returns arena.UnsupportedOperationError.
+//
+// Please free only arena.Bytes returned by allocation and append methods of this view, but not their sub-slices.
+// If Append has to move the data, it frees the previous buffer for such allocators,
+// and any usage of arena.Bytes or []byte converted by BytesToRef after Free is a "use after free" error.
+func (s *BytesView) Free(bytes Bytes) error {
+	return free(s.alloc, bytes.data, bytes.cap)
+}
+
 func (s *BytesView) growIfNecessary(bytesSlice Bytes, requiredSize int) (Bytes, error) {
 	target := bytesSlice
 	availableSize := int(target.cap - target.len)
@@ -236,30 +304,36 @@ func (s *BytesView) growIfNecessary(bytesSlice Bytes, requiredSize int) (Bytes,
 }
 
 func (s *BytesView) grow(target Bytes, requiredSize int) (Bytes, error) {
-	nextPtr, probeAllocErr := s.alloc.AllocUnaligned(0)
-	if probeAllocErr != nil {
-		return Bytes{}, probeAllocErr
-	}
-	// current allocation offset is the same as previous
-	// we can try to just enhance current buffer
-	nextAllocationIsRightAfterTargetSlice := nextPtr.offset == target.data.offset+target.cap
-	if nextAllocationIsRightAfterTargetSlice && s.alloc.Metrics().AvailableBytes >= requiredSize {
-		_, enhancingErr := s.alloc.AllocUnaligned(uintptr(requiredSize))
-		if enhancingErr != nil {
-			return Bytes{}, enhancingErr
+	// we prefer to double the capacity, but near the allocation limit
+	// it's enough to add the required size
+	minSize := int(target.cap) + requiredSize
+	newSize := max(minSize, 2*int(target.cap))
+	reallocTarget, ok := s.alloc.(reallocator)
+	if ok {
+		data, reallocErr := reallocTarget.Realloc(target.data, target.cap, uintptr(newSize), 1)
+		if reallocErr == AllocationLimitError && newSize > minSize {
+			newSize = minSize
+			data, reallocErr = reallocTarget.Realloc(target.data, target.cap, uintptr(newSize), 1)
 		}
-		target.cap += uintptr(requiredSize)
+		if reallocErr != nil {
+			return Bytes{}, reallocErr
+		}
+		target.data = data
+		target.cap = uintptr(newSize)
 		return target, nil
 	}
 
-	newSize := max(2*(int(target.cap)+requiredSize), 2*int(target.cap))
-	newTarget, allocErr := s.MakeBytes(newSize)
+	// allocators without Realloc can't extend the slice in place, so the unused capacity isn't required
+	newTarget, allocErr := s.MakeBytesInRange(int(target.len)+requiredSize, newSize)
 	if allocErr != nil {
 		return Bytes{}, allocErr
 	}
 	if target.len > 0 {
 		copy(s.BytesToRef(newTarget), s.BytesToRef(target))
 	}
+	if target.data != (Ptr{}) {
+		_ = free(s.alloc, target.data, target.cap)
+	}
 	target = newTarget
 
 	return target, nil
@@ -2,6 +2,7 @@ package arena
 
 import (
 	"fmt"
+	"unsafe"
 )
 
 // Error type used by the library to declare error constants.
@@ -20,6 +21,22 @@ const AllocationLimitError = Error("allocation limit")
 // you passed an invalid argument to the allocation method.
 const AllocationInvalidArgumentError = Error("allocation argument is invalid")
 
+// AllocatorClosedError is used as a panic value if
+// allocator is used after the call to its Close method.
+const AllocatorClosedError = Error("arena closed")
+
+// UnsupportedPlatformError typically returned if
+// the requested feature isn't supported on the current platform.
+const UnsupportedPlatformError = Error("unsupported platform")
+
+// UnsupportedOperationError typically returned if
+// the requested operation isn't supported by the underlying allocator.
+const UnsupportedOperationError = Error("unsupported operation")
+
+// InvalidDumpError typically returned by ReadFrom if
+// the input isn't a dump written by WriteTo of the same kind of allocator and the same build mode.
+const InvalidDumpError = Error("invalid arena dump")
+
 // Ptr is a struct, which is basically represents an offset of the allocated value
 // inside one of the arenas.
 //
@@ -30,16 +47,21 @@ const AllocationInvalidArgumentError = Error("allocation argument is invalid")
 // arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
 // but we'd suggest to do it right before use to eliminate its visibility scope
 // and potentially prevent it's escaping to the heap.
+//
+// Allocators detect foreign and stale arena.Ptr values by the 16-bit arena mask, that is changed on Clear,
+// so such detection isn't guaranteed. If the library is built with `arenachecked` tag,
+// arena.Ptr also carries the identity and the generation of the allocator, so the detection is guaranteed.
 type Ptr struct {
 	offset    uintptr
 	bucketIdx uint8
 
 	arenaMask uint16
+	check     ptrCheck // empty unless the library is built with `arenachecked` tag
 }
 
 // String provides a string snapshot of the current arena.Ptr.
 func (p Ptr) String() string {
-	return fmt.Sprintf("{mask: %v bucketIdx: %v offset: %v}", p.arenaMask, p.bucketIdx, p.offset)
+	return fmt.Sprintf("{mask: %v bucketIdx: %v offset: %v%v}", p.arenaMask, p.bucketIdx, p.offset, p.check)
 }
 
 // Offset is a arena.Ptr that can't be converted to unsafe.Pointer
@@ -56,6 +78,17 @@ func (o Offset) String() string {
 	return o.p.String()
 }
 
+// PtrTranslator maps arena.Ptr values issued before compaction of the allocator
+// to the new locations of the same values. It panics if arena.Ptr wasn't issued by the compacted allocator.
+// Empty arena.Ptr is left unchanged.
+type PtrTranslator func(p Ptr) Ptr
+
+// Bytes maps arena.Bytes issued before compaction of the allocator to the new location of the same bytes.
+func (t PtrTranslator) Bytes(b Bytes) Bytes {
+	b.data = t(b.data)
+	return b
+}
+
 // Stats is a struct that represents a snapshot of essential allocation statistics,
 // that can be used by end-users or other allocators for introspection.
 type Stats struct {
@@ -78,13 +111,18 @@ type Metrics struct {
 	Stats
 	AvailableBytes int // count of bytes that are reserved from the general heap, but aren't used
 	MaxCapacity    int // count of bytes that potentially can be allocated using specific arena
+	RetainedBytes  int // count of AllocatedBytes retained in clear buffers for future allocations
+
+	PendingDirtyBytes int // count of AllocatedBytes waiting for zeroing by arena.BackgroundZeroer
 }
 
 // String provides a string snapshot of the Metrics state.
 func (p Metrics) String() string {
 	return fmt.Sprintf(
-		"{UsedBytes: %v AvailableBytes: %v AllocatedBytes %v MaxCapacity %v CountOfOnHeapAllocations %v}",
+		"{UsedBytes: %v AvailableBytes: %v AllocatedBytes %v MaxCapacity %v CountOfOnHeapAllocations %v "+
+			"RetainedBytes %v PendingDirtyBytes %v}",
 		p.UsedBytes, p.AvailableBytes, p.AllocatedBytes, p.MaxCapacity, p.CountOfOnHeapAllocations,
+		p.RetainedBytes, p.PendingDirtyBytes,
 	)
 }
 
@@ -113,6 +151,13 @@ func clearBytes(buf []byte) {
 	}
 }
 
+// addressToRef converts an address of the arena memory to unsafe.Pointer.
+// The memory is kept alive by the allocator itself, so we load the address through a pointer
+// instead of the direct uintptr conversion that is reported by go vet.
+func addressToRef(address uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&address))
+}
+
 func max(a int, b int) int {
 	if a > b {
 		return a
@@ -126,3 +171,147 @@ func min(a int, b int) int {
 	}
 	return b
 }
+
+type closer interface {
+	Close()
+}
+
+type compactor interface {
+	Compact() (PtrTranslator, error)
+}
+
+type unusedReleaser interface {
+	ReleaseUnused() int
+}
+
+type resetter interface {
+	CurrentOffset() Offset
+	ResetTo(o Offset) error
+}
+
+type freeingAllocator interface {
+	Free(p Ptr)
+}
+
+type sizedFreeingAllocator interface {
+	Free(p Ptr, size uintptr)
+}
+
+type checkedFreeingAllocator interface {
+	Free(p Ptr, size uintptr) error
+}
+
+// free returns the value to the target allocator if it supports Free,
+// otherwise it returns arena.UnsupportedOperationError.
+// Size should be the same as it was passed to allocation.
+func free(target interface{}, p Ptr, size uintptr) error {
+	switch alloc := target.(type) {
+	case sizedFreeingAllocator:
+		alloc.Free(p, size)
+	case freeingAllocator:
+		alloc.Free(p)
+	case checkedFreeingAllocator:
+		return alloc.Free(p, size)
+	default:
+		return UnsupportedOperationError
+	}
+	return nil
+}
+
+// supportsFree reports whether the target allocator can free individual values,
+// so its allocations aren't consecutive, and buffers can't be enhanced in place.
+func supportsFree(target interface{}) bool {
+	if generic, ok := target.(*GenericAllocator); ok {
+		// arena.GenericAllocator can free values only if its own target can
+		return supportsFree(generic.target)
+	}
+	_, freeing := target.(freeingAllocator)
+	_, sizedFreeing := target.(sizedFreeingAllocator)
+	return freeing || sizedFreeing
+}
+
+type rangeAllocator interface {
+	AllocRange(minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error)
+}
+
+// allocRange delegates to the AllocRange method of the target if it is supported,
+// otherwise it tries to allocate preferredSize and falls back to minSize
+// if the target can't afford preferredSize.
+func allocRange(target allocator, minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error) {
+	rangeTarget, ok := target.(rangeAllocator)
+	if ok {
+		return rangeTarget.AllocRange(minSize, preferredSize, alignment)
+	}
+	result, allocErr := target.Alloc(preferredSize, alignment)
+	if allocErr == nil {
+		return result, preferredSize, nil
+	}
+	if allocErr != AllocationLimitError || minSize == preferredSize {
+		return Ptr{}, 0, allocErr
+	}
+	result, allocErr = target.Alloc(minSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, 0, allocErr
+	}
+	return result, minSize, nil
+}
+
+type uninitializedAllocator interface {
+	AllocNoZero(size uintptr, alignment uintptr) (Ptr, error)
+}
+
+// allocNoZero delegates to the AllocNoZero method of the target if it is supported,
+// otherwise it falls back to Alloc, so the result is zeroed anyway.
+func allocNoZero(target allocator, size uintptr, alignment uintptr) (Ptr, error) {
+	uninitializedTarget, ok := target.(uninitializedAllocator)
+	if ok {
+		return uninitializedTarget.AllocNoZero(size, alignment)
+	}
+	return target.Alloc(size, alignment)
+}
+
+type reallocator interface {
+	Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error)
+}
+
+// realloc delegates to the Realloc method of the target if it is supported,
+// otherwise it allocates newSize bytes and copies the previous value.
+func realloc(target allocator, p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	reallocTarget, ok := target.(reallocator)
+	if ok {
+		return reallocTarget.Realloc(p, oldSize, newSize, alignment)
+	}
+	return reallocByCopy(target, p, oldSize, newSize, alignment)
+}
+
+// reallocByCopy allocates newSize bytes and copies the previous value into them.
+// The previous value is left untouched.
+func reallocByCopy(target allocator, p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	result, allocErr := target.Alloc(newSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	copySize := int(oldSize)
+	if newSize < oldSize {
+		copySize = int(newSize)
+	}
+	if copySize > 0 {
+		dst := sliceHeader{Data: uintptr(target.ToRef(result)), Len: copySize, Cap: copySize}
+		src := sliceHeader{Data: uintptr(target.ToRef(p)), Len: copySize, Cap: copySize}
+		copy(*(*[]byte)(unsafe.Pointer(&dst)), *(*[]byte)(unsafe.Pointer(&src)))
+	}
+	return result, nil
+}
+
+// reallocByMove allocates newSize bytes, copies the previous value into them, and frees the previous value,
+// so p should be the start of the allocation and oldSize should be the same as it was passed to allocation.
+func reallocByMove(target allocator, p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	result, allocErr := reallocByCopy(target, p, oldSize, newSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	if p != (Ptr{}) {
+		_ = free(target, p, oldSize)
+	}
+	return result, nil
+}
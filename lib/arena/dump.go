@@ -0,0 +1,131 @@
+package arena
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unsafe"
+)
+
+const (
+	dumpMagic   = 0x414e5241 // "ARNA"
+	dumpVersion = 2
+
+	dynamicDumpKind = 1
+	genericDumpKind = 2
+)
+
+// dumpWriter writes little-endian values and remembers the first error,
+// so the dump can be written without checks after each value.
+type dumpWriter struct {
+	w       io.Writer
+	written int64
+	err     error
+	buf     [8]byte
+}
+
+func (d *dumpWriter) uint16(v uint16) {
+	binary.LittleEndian.PutUint16(d.buf[:2], v)
+	d.bytes(d.buf[:2])
+}
+
+func (d *dumpWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(d.buf[:4], v)
+	d.bytes(d.buf[:4])
+}
+
+func (d *dumpWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(d.buf[:8], v)
+	d.bytes(d.buf[:8])
+}
+
+func (d *dumpWriter) bytes(b []byte) {
+	if d.err != nil {
+		return
+	}
+	n, err := d.w.Write(b)
+	d.written += int64(n)
+	d.err = err
+}
+
+// header writes the format version and the identity of arena.Ptr values issued by the dumped allocator.
+func (d *dumpWriter) header(kind uint16, arenaMask uint16, check ptrCheck) {
+	allocatorID, generation := check.parts()
+	d.uint32(dumpMagic)
+	d.uint16(dumpVersion)
+	d.uint16(kind)
+	d.uint16(uint16(unsafe.Sizeof(Ptr{})))
+	d.uint16(arenaMask)
+	d.uint32(allocatorID)
+	d.uint64(generation)
+}
+
+// dumpReader is the counterpart of dumpWriter, it returns zeros after the first error.
+type dumpReader struct {
+	r    io.Reader
+	read int64
+	err  error
+	buf  [8]byte
+}
+
+func (d *dumpReader) uint16() uint16 {
+	d.bytes(d.buf[:2])
+	return binary.LittleEndian.Uint16(d.buf[:2])
+}
+
+func (d *dumpReader) uint32() uint32 {
+	d.bytes(d.buf[:4])
+	return binary.LittleEndian.Uint32(d.buf[:4])
+}
+
+func (d *dumpReader) uint64() uint64 {
+	d.bytes(d.buf[:8])
+	return binary.LittleEndian.Uint64(d.buf[:8])
+}
+
+func (d *dumpReader) bytes(b []byte) {
+	if d.err != nil {
+		for i := range b {
+			b[i] = 0
+		}
+		return
+	}
+	n, err := io.ReadFull(d.r, b)
+	d.read += int64(n)
+	d.err = err
+}
+
+// copyTo copies n bytes to w, so w grows only as the bytes are actually read.
+func (d *dumpReader) copyTo(w *bytes.Buffer, n int64) {
+	if d.err != nil {
+		return
+	}
+	read, err := io.CopyN(w, d.r, n)
+	d.read += read
+	if err == io.EOF && read > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	d.err = err
+}
+
+// header reads the header written by dumpWriter.header.
+// It returns arena.InvalidDumpError if the dump was written by another kind of allocator,
+// or by the library built with different layout of arena.Ptr.
+func (d *dumpReader) header(kind uint16) (uint16, ptrCheck, error) {
+	magic := d.uint32()
+	version := d.uint16()
+	dumpKind := d.uint16()
+	ptrSize := d.uint16()
+	arenaMask := d.uint16()
+	allocatorID := d.uint32()
+	generation := d.uint64()
+	if d.err != nil {
+		return 0, ptrCheck{}, d.err
+	}
+	validHeader := magic == dumpMagic && version == dumpVersion && dumpKind == kind &&
+		uintptr(ptrSize) == unsafe.Sizeof(Ptr{}) && arenaMask != 0
+	if !validHeader {
+		return 0, ptrCheck{}, InvalidDumpError
+	}
+	return arenaMask, makePtrCheck(allocatorID, generation), nil
+}
@@ -1,9 +1,13 @@
 package arena
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"runtime"
+	"sort"
 	"unsafe"
 )
 
@@ -21,6 +25,8 @@ import (
 // and refer to this one only if you really need to.
 type DynamicAllocator struct {
 	freeListOfClearArenas minHeapOfClearArenas
+	pool                  *RawAllocatorPool
+	registryMember        *registryMember
 
 	arenas          []RawAllocator
 	currentArena    RawAllocator
@@ -30,8 +36,23 @@ type DynamicAllocator struct {
 	allocatedBytes    int
 	onHeapAllocations int
 	maxCapacity       int
+	maxAlignment      uintptr
+
+	growth        GrowthStrategy
+	capacityLimit int
+
+	retention          RetentionPolicy
+	clearCycle         int
+	recentPeakCapacity float64
+
+	zeroer      *BackgroundZeroer
+	zeroed      *zeroedArenas
+	zeroOnAlloc bool
 
 	arenaMask uint16
+	check     ptrCheck
+	history   ptrCheckHistory
+	closed    bool
 
 	zeroPointerTarget [1]byte
 }
@@ -50,6 +71,98 @@ func NewDynamicAllocatorWithInitialCapacity(size uint32) *DynamicAllocator {
 	return result
 }
 
+// DynamicOptions is a structure used to configure arena.DynamicAllocator.
+//
+// You can configure:
+//  - InitialCapacity - initial capacity of the allocator,
+//    if not specified the first arena is allocated on the first allocation.
+//  - GrowthStrategy - strategy that calculates the size of the next arena on growth,
+//    if not specified we will use arena.ExponentialGrowth without cap, that doubles the size of arenas.
+//  - CapacityLimitInBytes - hard upper limit for AllocatedBytes of the allocator,
+//    if the allocator can't grow within this limit, allocations return arena.AllocationLimitError.
+//    If specified, it is also reported as MaxCapacity.
+//  - RetentionPolicy - policy that limits clear arenas retained after Clear for future allocations,
+//    if not specified all arenas are retained, for additional details please refer to arena.RetentionPolicy.
+//  - BackgroundZeroer - worker that zeroes buffers after Clear in the background,
+//    if not specified buffers are zeroed synchronously by Clear,
+//    for additional details please refer to arena.BackgroundZeroer.
+//  - ZeroOnAlloc - if specified, Clear doesn't zero buffers at all, and instead each allocation
+//    zeroes its own memory, so memory that is never allocated again isn't zeroed.
+//    Only memory that was used before Clear is zeroed, since buffers are clean up to the highest offset used in them.
+//    In this mode DynamicAllocator.AllocNoZero skips zeroing completely, and BackgroundZeroer isn't used.
+//  - Pool - arena.RawAllocatorPool that provides buffers before allocating them from the heap,
+//    for additional details please refer to arena.NewDynamicAllocatorWithPool.
+type DynamicOptions struct {
+	CapacityLimitInBytes uint64
+	GrowthStrategy       GrowthStrategy
+	RetentionPolicy      RetentionPolicy
+	BackgroundZeroer     *BackgroundZeroer
+	Pool                 *RawAllocatorPool
+	InitialCapacity      uint32
+	ZeroOnAlloc          bool
+}
+
+// RetentionPolicy is a structure used to configure how many clear arenas arena.DynamicAllocator
+// retains in its free-list after Clear, so they can be reused by future allocations.
+//
+// You can configure:
+//  - MaxRetainedBytes - upper limit for the total size of retained arenas.
+//  - MaxIdleClears - count of Clear calls after which a retained arena, that wasn't reused, is released.
+//  - PeakDecayFactor - if specified, retained arenas are limited by the recent peak of the capacity
+//    used between Clear calls, that decays with this factor on each Clear, so after a spike of UsedBytes
+//    retained memory gradually follows the current load. It should be in the range (0, 1),
+//    the lower it is, the faster retained memory decays.
+//
+// Arenas that are idle for the longest time are released first.
+// Released arenas are returned to arena.RawAllocatorPool if the allocator has one, otherwise they are left to the GC.
+// Retained arenas are reported by Metrics as RetainedBytes, that is a part of AllocatedBytes.
+type RetentionPolicy struct {
+	MaxRetainedBytes uint64
+	PeakDecayFactor  float64
+	MaxIdleClears    uint32
+}
+
+// NewDynamicAllocatorWithOptions creates an instance of arena.DynamicAllocator configured by DynamicOptions.
+func NewDynamicAllocatorWithOptions(opts DynamicOptions) *DynamicAllocator {
+	result := &DynamicAllocator{}
+	result.configure(opts)
+	if opts.InitialCapacity > 0 {
+		result.grow(int(opts.InitialCapacity))
+	}
+	return result
+}
+
+func (a *DynamicAllocator) configure(opts DynamicOptions) {
+	if opts.CapacityLimitInBytes > uint64(math.MaxInt64) {
+		panic("CapacityLimitInBytes is too large")
+	}
+	if opts.RetentionPolicy.MaxRetainedBytes > uint64(math.MaxInt64) {
+		panic("MaxRetainedBytes is too large")
+	}
+	if opts.RetentionPolicy.PeakDecayFactor < 0 || opts.RetentionPolicy.PeakDecayFactor >= 1 {
+		panic("PeakDecayFactor should be in the range (0, 1)")
+	}
+	a.growth = opts.GrowthStrategy
+	a.capacityLimit = int(opts.CapacityLimitInBytes)
+	a.retention = opts.RetentionPolicy
+	a.zeroOnAlloc = opts.ZeroOnAlloc
+	if opts.Pool != nil {
+		a.pool = opts.Pool
+	}
+	if opts.BackgroundZeroer != nil {
+		a.zeroer = opts.BackgroundZeroer
+		a.zeroed = &zeroedArenas{}
+	}
+	a.updateMaxCapacity()
+}
+
+// NewDynamicAllocatorWithPool creates an instance of arena.DynamicAllocator
+// that takes its buffers from the specified arena.RawAllocatorPool before allocating them from the heap
+// and returns them back to the pool on DynamicAllocator.Close.
+func NewDynamicAllocatorWithPool(pool *RawAllocatorPool) *DynamicAllocator {
+	return &DynamicAllocator{pool: pool}
+}
+
 // AllocUnaligned performs allocation within an underlying arenas, but without automatic alignment.
 // This method is more performant and can be used to allocate memory with an alignment of 1 byte
 // or to create a dedicated method that will allocate only object with the same alignment,
@@ -82,8 +195,14 @@ func (a *DynamicAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
 		return Ptr{}, allocErr
 	}
 	a.usedBytes += int(targetSize)
+	result.offset -= uintptr(a.currentArena.startPtr)
 	result.bucketIdx = uint8(a.currentArenaIdx)
 	result.arenaMask = a.arenaMask
+	a.check = a.history.next(a.check)
+	result.check = a.check
+	if a.zeroOnAlloc {
+		a.zeroAllocated(result.offset, size)
+	}
 	return result, nil
 }
 
@@ -106,27 +225,143 @@ func (a *DynamicAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
 // but we'd suggest to do it right before use to eliminate its visibility scope
 // and potentially prevent it's escaping to the heap.
 func (a *DynamicAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	result, allocErr := a.alloc(size, alignment)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	if a.zeroOnAlloc {
+		a.zeroAllocated(result.offset, size)
+	}
+	return result, nil
+}
+
+// AllocNoZero performs allocation within underlying arenas the same way as Alloc,
+// but if the allocator is created with ZeroOnAlloc option, the allocated memory isn't zeroed,
+// so it can contain stale data of values allocated before Clear.
+// Otherwise, memory is zeroed by Clear anyway, so AllocNoZero is the same as Alloc.
+//
+// IMPORTANT, this method is potentially UNSAFE to use, please use it only if you
+// fully overwrite the allocated memory before reading it, and never allocate values with pointers by it.
+func (a *DynamicAllocator) AllocNoZero(size, alignment uintptr) (Ptr, error) {
+	return a.alloc(size, alignment)
+}
+
+func (a *DynamicAllocator) alloc(size, alignment uintptr) (Ptr, error) {
 	a.init()
 
 	if !isPowerOfTwo(alignment) {
 		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
 	}
+	if alignment > a.maxAlignment {
+		a.maxAlignment = alignment
+	}
 
 	padding := calculatePadding(a.currentArena.offset, alignment)
 	resultSize := size + padding
 	if a.currentArena.offset+resultSize > a.currentArena.endPtr {
 		a.grow(int(resultSize))
 	}
+	paddingStart := a.currentArena.idx()
 	result, allocErr := a.currentArena.Alloc(size, alignment)
 	if allocErr != nil {
 		return Ptr{}, allocErr
 	}
 	a.usedBytes += int(resultSize)
+	result.offset -= uintptr(a.currentArena.startPtr)
 	result.bucketIdx = uint8(a.currentArenaIdx)
 	result.arenaMask = a.arenaMask
+	a.check = a.history.next(a.check)
+	result.check = a.check
+	if a.zeroOnAlloc {
+		// padding is never overwritten by the caller, but it is a part of the dump written by WriteTo
+		a.zeroAllocated(paddingStart, result.offset-paddingStart)
+	}
 	return result, nil
 }
 
+// AllocRange performs allocation of at least minSize and at most preferredSize bytes within underlying arenas.
+//
+// It returns arena.Ptr value and the actual size granted for this allocation.
+// If the current arena can fit preferredSize, it will be granted.
+// Otherwise, if the current arena can fit at least minSize, the rest of the current arena will be granted
+// without growth, so the resulting size is always between minSize and preferredSize.
+// If even minSize can't be fitted, arena.DynamicAllocator grows to fit preferredSize.
+//
+// minSize - should be less than or equal to preferredSize,
+// otherwise arena.AllocationInvalidArgumentError will be returned.
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *DynamicAllocator) AllocRange(minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if minSize > preferredSize {
+		return Ptr{}, 0, AllocationInvalidArgumentError
+	}
+	if alignment > a.maxAlignment {
+		a.maxAlignment = alignment
+	}
+
+	padding := calculatePadding(a.currentArena.offset, alignment)
+	if a.currentArena.offset+minSize+padding > a.currentArena.endPtr {
+		a.grow(int(preferredSize + padding))
+		if a.currentArena.offset+minSize+padding > a.currentArena.endPtr {
+			// growth within the registry budget or the capacity limit can be possible only for minSize
+			a.grow(int(minSize + padding))
+		}
+		padding = calculatePadding(a.currentArena.offset, alignment)
+	}
+	paddingStart := a.currentArena.idx()
+	result, size, allocErr := a.currentArena.AllocRange(minSize, preferredSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, 0, allocErr
+	}
+	a.usedBytes += int(size + padding)
+	result.offset -= uintptr(a.currentArena.startPtr)
+	result.bucketIdx = uint8(a.currentArenaIdx)
+	result.arenaMask = a.arenaMask
+	a.check = a.history.next(a.check)
+	result.check = a.check
+	if a.zeroOnAlloc {
+		a.zeroAllocated(paddingStart, result.offset-paddingStart+size)
+	}
+	return result, size, nil
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// If the value is the last allocation in the current arena and the arena can fit newSize,
+// it is extended in place and the same arena.Ptr is returned. Otherwise, newSize bytes are allocated,
+// with growth if required, and the value is copied there, but the previous value is left untouched.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *DynamicAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	addr := uintptr(a.currentArena.startPtr) + p.offset
+	isLastAllocation := oldSize > 0 && p.arenaMask == a.arenaMask && a.history.accepts(a.check, p.check) &&
+		p.bucketIdx == uint8(a.currentArenaIdx) && addr+oldSize == a.currentArena.offset && addr&(alignment-1) == 0
+	if isLastAllocation && addr+newSize <= a.currentArena.endPtr {
+		a.currentArena.offset = addr + newSize
+		a.usedBytes += int(newSize - oldSize)
+		if a.zeroOnAlloc {
+			a.zeroAllocated(p.offset+oldSize, newSize-oldSize)
+		}
+		return p, nil
+	}
+	return reallocByCopy(a, p, oldSize, newSize, alignment)
+}
+
 // ToRef converts arena.Ptr to unsafe.Pointer.
 //
 // This method performs bounds check, so it can panic if you pass an arena.Ptr
@@ -138,7 +373,8 @@ func (a *DynamicAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
 // We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
 // and potentially prevent it's escaping to the heap.
 func (a *DynamicAllocator) ToRef(p Ptr) unsafe.Pointer {
-	if p.arenaMask != a.arenaMask {
+	if p.arenaMask != a.arenaMask || !a.history.accepts(a.check, p.check) {
+		a.panicIfClosed()
 		panic("pointer isn't part of this arena")
 	}
 	targetArena := a.currentArena
@@ -146,28 +382,86 @@ func (a *DynamicAllocator) ToRef(p Ptr) unsafe.Pointer {
 		targetArena = a.arenas[p.bucketIdx]
 	}
 	if targetArena.startPtr == nil && p.offset == 0 {
+		a.panicIfClosed()
 		return unsafe.Pointer(&a.zeroPointerTarget[0])
 	}
-	if p.offset < uintptr(targetArena.startPtr) || p.offset > targetArena.endPtr {
+	// values allocated after the current offset were freed by ResetTo
+	if p.offset > targetArena.idx() {
+		a.panicIfClosed()
 		panic(fmt.Sprintf(
 			"raw arena index out of range. "+
-				"requested ptr: %#x; arena: [%#x: %#x]",
-			p.offset, uintptr(targetArena.startPtr), targetArena.endPtr,
+				"requested ptr: %#x; arena: [0: %#x]",
+			p.offset, targetArena.idx(),
 		))
 	}
+	p.offset += uintptr(targetArena.startPtr)
 	return targetArena.ToRef(p)
 }
 
 // CurrentOffset returns the current allocation offset.
 // This method can be primarily used to build other allocators on top of arena.DynamicAllocator.
+//
+// In checked mode, enabled by `arenachecked` or `arenadebug` build tags,
+// the returned offset is also a checkpoint, so values allocated after it start a new generation of arena.Ptr.
 func (a *DynamicAllocator) CurrentOffset() Offset {
 	a.init()
-	offset := a.currentArena.CurrentOffset()
+	a.history.checkpoint()
+	// offsets are relative to the start of the arena, so they stay valid after ReadFrom
+	offset := Offset{p: Ptr{offset: a.currentArena.idx()}}
 	offset.p.bucketIdx = uint8(a.currentArenaIdx)
 	offset.p.arenaMask = a.arenaMask
+	offset.p.check = a.check
 	return offset
 }
 
+// ResetTo frees everything allocated after the checkpoint previously returned by CurrentOffset.
+// It fills with zeros only the region allocated after the checkpoint,
+// and moves arenas allocated after the checkpoint to the free-list of clear arenas,
+// so checkpoints can be nested, and the allocator can be rewound to any of them, from the latest to the earliest.
+//
+// ToRef can catch most usages of arena.Ptr allocated after the checkpoint until the same memory is allocated again,
+// but usages of already converted values can't be caught.
+// In checked mode, enabled by `arenachecked` or `arenadebug` build tags, such arena.Ptr values
+// are always rejected by ToRef, even after the same memory is allocated again,
+// since they belong to generations started after the checkpoint.
+//
+// ResetTo returns arena.AllocationInvalidArgumentError if the checkpoint doesn't belong to this allocator
+// or is out of the currently allocated region, for example, if it was taken before Clear or a previous ResetTo.
+func (a *DynamicAllocator) ResetTo(o Offset) error {
+	a.init()
+	p := o.p
+	if p.arenaMask != a.arenaMask || !a.history.accepts(a.check, p.check) || int(p.bucketIdx) > a.currentArenaIdx {
+		return AllocationInvalidArgumentError
+	}
+	targetArena := a.currentArena
+	if int(p.bucketIdx) != a.currentArenaIdx {
+		targetArena = a.arenas[p.bucketIdx]
+	}
+	if targetArena.startPtr == nil && p.offset == 0 {
+		// checkpoint was taken before the first allocation, and nothing was allocated since
+		a.check = a.history.resetTo(p.check)
+		return nil
+	}
+	if p.offset > targetArena.idx() {
+		return AllocationInvalidArgumentError
+	}
+
+	releasedBytes := 0
+	if int(p.bucketIdx) != a.currentArenaIdx {
+		releasedBytes += a.releaseArena(a.currentArena)
+		for _, ar := range a.arenas[p.bucketIdx+1:] {
+			releasedBytes += a.releaseArena(ar)
+		}
+		a.currentArena = a.arenas[p.bucketIdx]
+		a.arenas = a.arenas[:p.bucketIdx]
+		a.currentArenaIdx = int(p.bucketIdx)
+	}
+	releasedBytes += a.currentArena.resetTo(uintptr(a.currentArena.startPtr) + p.offset)
+	a.usedBytes = max(a.usedBytes-releasedBytes, 0)
+	a.check = a.history.resetTo(p.check)
+	return nil
+}
+
 // Clear fills all underlying buffers with zeros and moves offsets to zero.
 // Moves all unused arenas to free-list that can be used to prevent future allocations.
 //
@@ -176,24 +470,259 @@ func (a *DynamicAllocator) CurrentOffset() Offset {
 // but it can't catch usages of already converted values.
 // To avoid such situations, we'd suggest calling this method right before using the result pointer to eliminate its
 // visibility scope and potentially prevent it's escaping to the heap.
+//
+// Clear has no effect on the closed allocator.
+//
+// Clear applies arena.RetentionPolicy of the allocator, so some clear arenas can be released from the free-list.
+// If the allocator has arena.BackgroundZeroer, used buffers are handed to it
+// and return to the free-list only after they are zeroed.
+// If the allocator is created with ZeroOnAlloc option, buffers aren't zeroed by Clear at all.
 func (a *DynamicAllocator) Clear() {
+	if a.closed {
+		return
+	}
+	a.collectZeroedArenas()
+	usedCapacity := a.allocatedBytes - a.freeListOfClearArenas.bytes - a.pendingDirtyBytes()
+	a.clearCycle++
 	if a.currentArena.startPtr != nil {
-		a.currentArena.Clear()
-		a.freeListOfClearArenas.Push(a.currentArena)
+		a.retainArena(a.currentArena)
 	}
 	a.currentArena = RawAllocator{}
 
 	for _, ar := range a.arenas {
 		if ar.startPtr != nil {
-			ar.Clear()
-			a.freeListOfClearArenas.Push(ar)
+			a.retainArena(ar)
 		}
 	}
 	a.arenas = a.arenas[:0]
+	a.applyRetentionPolicy(usedCapacity)
 
 	a.currentArenaIdx = 0
 	a.usedBytes = 0
+	a.maxAlignment = 0
+	a.arenaMask = (a.arenaMask + 1) | 1
+	a.check = a.history.restart(a.check)
+}
+
+// Close gets rid of all underlying buffers, including the free-list of clear arenas.
+// If the allocator was created with arena.RawAllocatorPool, buffers are cleared and returned to the pool,
+// otherwise they are left to the GC.
+// Buffers that are still waiting for arena.BackgroundZeroer are returned to the pool once they are zeroed.
+//
+// Any subsequent call to Alloc, AllocUnaligned, AllocRange, Realloc, CurrentOffset or ToRef
+// will panic with arena.AllocatorClosedError, so all outstanding arena.Ptr values become unusable.
+// Close is idempotent, and Clear has no effect on the closed allocator.
+func (a *DynamicAllocator) Close() {
+	if a.closed {
+		return
+	}
+	a.Clear()
+	if a.pool != nil {
+		if a.zeroed != nil {
+			a.zeroed.forwardTo(a.pool)
+		}
+		for {
+			ar, ok := a.freeListOfClearArenas.Pop()
+			if !ok {
+				break
+			}
+			a.putToPool(ar)
+		}
+	}
+	a.freeListOfClearArenas = minHeapOfClearArenas{}
+	a.arenas = nil
+	a.pool = nil
+	if a.registryMember != nil {
+		a.registryMember.release(a.allocatedBytes)
+		a.registryMember.deregister()
+		runtime.SetFinalizer(a, nil)
+	}
+
+	a.allocatedBytes = 0
+	a.maxCapacity = 0
+	a.arenaMask = 0
+	a.check = ptrCheck{}
+	a.history = ptrCheckHistory{}
+	a.closed = true
+}
+
+// WriteTo writes the dump of the allocator to w, so it can be restored later by DynamicAllocator.ReadFrom.
+// The dump consists of the header, the max alignment of allocated values,
+// and the used regions of all arenas, and their unused capacity isn't written.
+//
+// arena.Ptr values issued by arena.DynamicAllocator are relative to their arenas,
+// so arena.Ptr, arena.Bytes and generated pointers issued before WriteTo, including the ones stored inside the arena,
+// stay valid for the allocator restored from the dump.
+// The dump can be read only by the library built with the same layout of arena.Ptr and the same byte order,
+// for example, dumps written with `arenachecked` build tag can't be read without it.
+func (a *DynamicAllocator) WriteTo(w io.Writer) (int64, error) {
+	a.init()
+	arenas := a.arenas
+	if a.currentArena.startPtr != nil {
+		arenas = append(arenas[:len(arenas):len(arenas)], a.currentArena)
+	}
+
+	d := &dumpWriter{w: w}
+	d.header(dynamicDumpKind, a.arenaMask, a.check)
+	d.uint64(uint64(a.maxAlignment))
+	d.uint16(uint16(len(arenas)))
+	for _, ar := range arenas {
+		d.uint32(uint32(ar.idx()))
+	}
+	for _, ar := range arenas {
+		d.bytes(ar.buffer()[:ar.idx()])
+	}
+	a.history.writeTo(d)
+	return d.written, d.err
+}
+
+// ReadFrom replaces the content of the allocator with the dump previously written by DynamicAllocator.WriteTo.
+// It reads exactly one dump, so several dumps can be stored in one stream.
+// Before loading, the allocator is cleared, and then it allocates arenas that fit used regions of the dumped ones,
+// reusing clear arenas, the pool, and the registry budget the same way as growth does.
+// Sizes declared by the dump are checked against the capacity limit before any allocation,
+// and every arena is allocated only after its content is actually read from r,
+// so a truncated or malicious dump can't make the allocator reserve more memory than it contains.
+//
+// The restored allocator adopts the arena mask of the dumped one, so all arena.Ptr values
+// issued by the dumped allocator are accepted by the restored one.
+//
+// ReadFrom returns arena.InvalidDumpError if r doesn't contain a valid dump, arena.AllocationLimitError
+// if arenas can't be allocated within the registry budget or the capacity limit, or the error of r.
+// In case of any error, the allocator is left cleared.
+func (a *DynamicAllocator) ReadFrom(r io.Reader) (int64, error) {
+	a.init()
+	d := &dumpReader{r: r}
+	arenaMask, check, headerErr := d.header(dynamicDumpKind)
+	if headerErr != nil {
+		return d.read, headerErr
+	}
+	maxAlignment := uintptr(d.uint64())
+	countOfArenas := int(d.uint16())
+	if d.err == nil && (countOfArenas > math.MaxUint8+1 || (maxAlignment != 0 && !isPowerOfTwo(maxAlignment))) {
+		return d.read, InvalidDumpError
+	}
+	usedSizes := make([]uint32, countOfArenas)
+	requiredCapacity := 0
+	for i := range usedSizes {
+		usedSizes[i] = d.uint32()
+		if d.err == nil && usedSizes[i] > math.MaxUint32-uint32(minInternalBufferSize) {
+			return d.read, InvalidDumpError
+		}
+		// end of the arena is inclusive
+		requiredCapacity += int(optimalRawAllocatorSize(usedSizes[i] + 1))
+	}
+	if d.err != nil {
+		return d.read, d.err
+	}
+
+	a.Clear()
+	if a.capacityLimit > 0 && requiredCapacity > a.capacityLimit {
+		return d.read, AllocationLimitError
+	}
+	content := &bytes.Buffer{}
+	for _, usedSize := range usedSizes {
+		content.Reset()
+		d.copyTo(content, int64(usedSize))
+		if d.err != nil {
+			a.Clear()
+			return d.read, d.err
+		}
+		newArena, ok := a.getNewArena(int(usedSize)+1, int(usedSize)+1)
+		if !ok {
+			a.Clear()
+			return d.read, AllocationLimitError
+		}
+		if a.currentArena.startPtr != nil {
+			a.arenas = append(a.arenas, a.currentArena)
+			a.currentArenaIdx++
+		}
+		a.currentArena = newArena
+		copy(a.currentArena.buffer(), content.Bytes())
+		a.currentArena.offset += uintptr(usedSize)
+		a.usedBytes += int(usedSize)
+	}
+	// generations of arena.Ptr values are dumped only in checked mode
+	history := ptrCheckHistory{}
+	validHistory := history.readFrom(d, check)
+	if d.err != nil || !validHistory {
+		a.Clear()
+		if d.err != nil {
+			return d.read, d.err
+		}
+		return d.read, InvalidDumpError
+	}
+	a.maxAlignment = maxAlignment
+	a.arenaMask = arenaMask
+	a.check = check
+	a.history = history
+	return d.read, nil
+}
+
+// Compact copies used regions of all underlying arenas into one new arena of the right size
+// and moves the previous arenas to the free-list of clear arenas, so wasted tails of arenas
+// left behind by the growth are released to the subsequent allocations.
+//
+// Compaction changes the location of all allocated values, so arena.Ptr values issued before Compact
+// are rejected by the allocator, the same way as after Clear, and have to be migrated
+// by the returned arena.PtrTranslator. arena.Offset values taken before Compact can't be used by ResetTo.
+// If the allocator has no more than one arena, there is nothing to merge,
+// so Compact leaves it unchanged and returns the translator that doesn't change arena.Ptr values.
+//
+// Compact returns arena.AllocationLimitError if the new arena can't be allocated
+// within the registry budget or the capacity limit, in such case the allocator is left unchanged.
+func (a *DynamicAllocator) Compact() (PtrTranslator, error) {
+	a.init()
+	if len(a.arenas) == 0 {
+		return func(p Ptr) Ptr { return p }, nil
+	}
+	arenas := append(a.arenas[:len(a.arenas):len(a.arenas)], a.currentArena)
+	// values are moved with the same address modulo the max alignment, to keep all of them aligned
+	alignment := uintptr(max(int(a.maxAlignment), 1))
+	requiredSize := 1 // end of the arena is inclusive
+	for _, ar := range arenas {
+		requiredSize += int(ar.idx() + alignment - 1)
+	}
+	newArena, ok := a.getNewArena(requiredSize, requiredSize)
+	if !ok {
+		return nil, AllocationLimitError
+	}
+
+	bases := make([]uintptr, len(arenas))
+	usedSizes := make([]uintptr, len(arenas))
+	for i, ar := range arenas {
+		newArena.offset += (uintptr(ar.startPtr) - newArena.offset) & (alignment - 1)
+		bases[i], usedSizes[i] = newArena.idx(), ar.idx()
+		copy(newArena.buffer()[bases[i]:], ar.buffer()[:usedSizes[i]])
+		newArena.offset += usedSizes[i]
+		a.releaseArena(ar)
+	}
+	a.arenas = a.arenas[:0]
+	a.currentArena = newArena
+	a.currentArenaIdx = 0
+	a.usedBytes = int(newArena.idx())
+	a.updateMaxCapacity()
+
+	fromMask, fromCheck, fromHistory := a.arenaMask, a.check, a.history
 	a.arenaMask = (a.arenaMask + 1) | 1
+	a.check = a.history.restart(a.check)
+	toMask, toCheck := a.arenaMask, a.check
+	return func(p Ptr) Ptr {
+		if p == (Ptr{}) {
+			return p
+		}
+		if p.arenaMask != fromMask || !fromHistory.accepts(fromCheck, p.check) || int(p.bucketIdx) >= len(bases) {
+			panic("pointer isn't part of this arena")
+		}
+		if p.offset > usedSizes[p.bucketIdx] {
+			panic(fmt.Sprintf(
+				"raw arena index out of range. "+
+					"requested ptr: %#x; arena: [0: %#x]",
+				p.offset, usedSizes[p.bucketIdx],
+			))
+		}
+		return Ptr{offset: bases[p.bucketIdx] + p.offset, arenaMask: toMask, check: toCheck}
+	}, nil
 }
 
 // Stats provides a snapshot of essential allocation statistics,
@@ -216,20 +745,169 @@ func (a *DynamicAllocator) Metrics() Metrics {
 			CountOfOnHeapAllocations: a.onHeapAllocations,
 		},
 		// we inline AvailableBytes calculation by hand to avoid full call to a.currentArena.Metrics
-		AvailableBytes: a.currentArena.availableBytes(),
-		MaxCapacity:    a.maxCapacity,
+		AvailableBytes:    a.currentArena.availableBytes(),
+		MaxCapacity:       a.maxCapacity,
+		RetainedBytes:     a.freeListOfClearArenas.bytes,
+		PendingDirtyBytes: a.pendingDirtyBytes(),
 	}
 }
 
 // String provides a string snapshot of the current allocation offset.
 func (a *DynamicAllocator) String() string {
+	if a.closed {
+		return "dynarena{closed}"
+	}
 	a.init()
 	return fmt.Sprintf("dynarena{mask: %v offset: %v}", a.arenaMask, a.CurrentOffset())
 }
 
+// releaseArena clears the arena, moves it to the free-list of clear arenas and returns the count of its used bytes.
+func (a *DynamicAllocator) releaseArena(ar RawAllocator) int {
+	usedBytes := int(ar.idx())
+	a.retainArena(ar)
+	return usedBytes
+}
+
+// retainArena clears the arena and moves it to the free-list of clear arenas.
+// If the allocator has arena.BackgroundZeroer, the arena is cleared in the background if possible.
+// If the allocator is created with ZeroOnAlloc option, the arena isn't cleared,
+// since allocations zero their memory by themselves, so it keeps its offset to mark the dirty region,
+// and it is rewound only when it is picked from the free-list.
+// In `arenadebug` mode, arenas are always cleared synchronously to protect their memory right away.
+func (a *DynamicAllocator) retainArena(ar RawAllocator) {
+	if a.zeroOnAlloc && !protectMemoryOnClear {
+		a.freeListOfClearArenas.Push(ar, a.clearCycle)
+		return
+	}
+	if a.zeroer != nil && !protectMemoryOnClear {
+		if a.zeroer.submit(clearArena{RawAllocator: ar, clearCycle: a.clearCycle}, a.zeroed) {
+			return
+		}
+	}
+	ar.Clear()
+	a.freeListOfClearArenas.Push(ar, a.clearCycle)
+}
+
+// collectZeroedArenas moves arenas zeroed by arena.BackgroundZeroer to the free-list.
+func (a *DynamicAllocator) collectZeroedArenas() {
+	if a.zeroed != nil {
+		a.zeroed.take(&a.freeListOfClearArenas)
+	}
+}
+
+func (a *DynamicAllocator) pendingDirtyBytes() int {
+	if a.zeroed == nil {
+		return 0
+	}
+	return a.zeroed.pending()
+}
+
+// ReleaseUnused releases all clear arenas retained in the free-list
+// and returns the count of released bytes.
+// Released arenas are returned to arena.RawAllocatorPool if the allocator has one, otherwise they are left to the GC.
+func (a *DynamicAllocator) ReleaseUnused() int {
+	a.collectZeroedArenas()
+	return a.releaseRetainedArenas(0, a.clearCycle+1)
+}
+
+func (a *DynamicAllocator) applyRetentionPolicy(usedCapacity int) {
+	if a.retention == (RetentionPolicy{}) {
+		return
+	}
+	limit := math.MaxInt64
+	if a.retention.MaxRetainedBytes > 0 {
+		limit = int(a.retention.MaxRetainedBytes)
+	}
+	if a.retention.PeakDecayFactor > 0 {
+		a.recentPeakCapacity = math.Max(float64(usedCapacity), a.recentPeakCapacity*a.retention.PeakDecayFactor)
+		limit = min(limit, int(a.recentPeakCapacity))
+	}
+	idleBefore := 0
+	if a.retention.MaxIdleClears > 0 {
+		idleBefore = a.clearCycle - int(a.retention.MaxIdleClears) + 1
+	}
+	a.releaseRetainedArenas(limit, idleBefore)
+}
+
+// releaseRetainedArenas releases clear arenas that were idle since Clear cycles before idleBefore,
+// and then releases the most idle arenas, until retained bytes fit into the limit.
+func (a *DynamicAllocator) releaseRetainedArenas(limit int, idleBefore int) int {
+	retained := a.freeListOfClearArenas.heap
+	sort.Slice(retained, func(i, j int) bool {
+		if retained[i].clearCycle != retained[j].clearCycle {
+			return retained[i].clearCycle < retained[j].clearCycle
+		}
+		return retained[i].len() > retained[j].len()
+	})
+	retainedBytes := a.freeListOfClearArenas.bytes
+	a.freeListOfClearArenas = minHeapOfClearArenas{heap: retained[:0:0]}
+	releasedBytes := 0
+	for _, ar := range retained {
+		if ar.clearCycle < idleBefore || retainedBytes > limit {
+			retainedBytes -= ar.len()
+			releasedBytes += a.dropClearArena(ar.RawAllocator)
+			continue
+		}
+		a.freeListOfClearArenas.Push(ar.RawAllocator, ar.clearCycle)
+	}
+	a.updateMaxCapacity()
+	return releasedBytes
+}
+
+// dropClearArena releases the clear arena, that isn't retained anymore, and returns its size.
+func (a *DynamicAllocator) dropClearArena(ar RawAllocator) int {
+	size := ar.len()
+	a.allocatedBytes -= size
+	if a.registryMember != nil {
+		a.registryMember.release(size)
+	}
+	if a.pool != nil {
+		a.putToPool(ar)
+	}
+	return size
+}
+
+// putToPool returns the arena from the free-list to arena.RawAllocatorPool.
+// The pool is shared with other allocators that expect clear arenas,
+// so the dirty region of arenas retained in ZeroOnAlloc mode is cleared before that.
+func (a *DynamicAllocator) putToPool(ar RawAllocator) {
+	ar.Clear()
+	a.pool.put(ar)
+}
+
+// zeroAllocated fills with zeros the memory of the allocation in the current arena
+// at the specified offset relative to the start of the arena.
+// Only the part below the dirty mark of the arena is zeroed, since the memory above it was never used.
+func (a *DynamicAllocator) zeroAllocated(offset uintptr, size uintptr) {
+	end := offset + size
+	if end > a.currentArena.dirtyIdx {
+		end = a.currentArena.dirtyIdx
+	}
+	if offset >= end {
+		return
+	}
+	clearBytes(a.currentArena.buffer()[offset:end])
+}
+
 func (a *DynamicAllocator) grow(requiredAvailableSize int) {
-	newSize := max(a.currentArena.len()*2, requiredAvailableSize*2)
-	newArena := a.getNewArena(newSize)
+	currentSize := 0
+	if a.currentArena.startPtr != nil {
+		currentSize = a.currentArena.len()
+		if a.currentArenaIdx == math.MaxUint8 {
+			// index of the next arena doesn't fit into arena.Ptr.bucketIdx
+			return
+		}
+	}
+	newSize := max(currentSize*2, requiredAvailableSize*2)
+	if a.growth != nil {
+		newSize = a.growth(currentSize, requiredAvailableSize)
+	}
+	minSize := requiredAvailableSize + 1 // end of the arena is inclusive
+	newArena, ok := a.getNewArena(max(newSize, minSize), minSize)
+	if !ok {
+		// current arena stays the same, so the allocation fails with AllocationLimitError
+		return
+	}
 	if a.currentArena.startPtr != nil {
 		a.arenas = append(a.arenas, a.currentArena)
 		a.currentArenaIdx++
@@ -237,25 +915,63 @@ func (a *DynamicAllocator) grow(requiredAvailableSize int) {
 	a.currentArena = newArena
 }
 
-func (a *DynamicAllocator) getNewArena(size int) RawAllocator {
-	if len(a.freeListOfClearArenas.heap) == 0 {
-		newRawArena := NewRawAllocatorWithOptimalSize(uint32(size))
+// getNewArena tries to find or allocate an arena of the specified size,
+// but if it isn't possible within the registry budget or the capacity limit, it falls back to the minSize.
+func (a *DynamicAllocator) getNewArena(size int, minSize int) (RawAllocator, bool) {
+	a.collectZeroedArenas()
+	if len(a.freeListOfClearArenas.heap) > 0 {
+		newArenaFromFreeList, ok := a.tryToPickClearArenaFromFreeList(size)
+		if ok {
+			return newArenaFromFreeList, true
+		}
+	}
+	if a.pool != nil {
+		newArenaFromPool, ok := a.pool.get(size)
+		if ok && a.reserve(newArenaFromPool.len()) {
+			a.allocatedBytes += newArenaFromPool.len()
+			a.updateMaxCapacity()
+			return newArenaFromPool, true
+		}
+		if ok {
+			a.pool.put(newArenaFromPool)
+		}
+	}
+	for _, targetSize := range [...]int{size, minSize} {
+		rawArenaSize := optimalRawAllocatorSize(uint32(targetSize))
+		if !a.reserve(int(rawArenaSize)) {
+			continue
+		}
+		newRawArena := NewRawAllocator(rawArenaSize)
 		a.updateAllocationMetrics(newRawArena.len())
-		return *newRawArena
+		return *newRawArena, true
 	}
+	return RawAllocator{}, false
+}
 
-	newArenaFromFreeList, ok := a.tryToPickClearArenaFromFreeList(size)
-	if ok {
-		return newArenaFromFreeList
+func (a *DynamicAllocator) reserve(bytes int) bool {
+	if a.capacityLimit > 0 && a.allocatedBytes+bytes > a.capacityLimit {
+		return false
+	}
+	if a.registryMember == nil {
+		return true
 	}
-	newRawArena := NewRawAllocatorWithOptimalSize(uint32(size))
-	a.updateAllocationMetrics(newRawArena.len())
-	return *newRawArena
+	return a.registryMember.reserve(bytes)
 }
 
 func (a *DynamicAllocator) updateAllocationMetrics(allocatedBytes int) {
 	a.allocatedBytes += allocatedBytes
 	a.onHeapAllocations++
+	if a.registryMember != nil {
+		a.registryMember.countOnHeapAllocation()
+	}
+	a.updateMaxCapacity()
+}
+
+func (a *DynamicAllocator) updateMaxCapacity() {
+	if a.capacityLimit > 0 {
+		a.maxCapacity = a.capacityLimit
+		return
+	}
 	a.maxCapacity = a.allocatedBytes + (math.MaxInt8-len(a.arenas))*math.MaxUint32
 }
 
@@ -266,24 +982,43 @@ func (a *DynamicAllocator) tryToPickClearArenaFromFreeList(size int) (RawAllocat
 			return RawAllocator{}, false
 		}
 		if candidate.len() < size {
+			// too small arenas are released
+			a.dropClearArena(candidate)
 			continue
 		}
+		// in ZeroOnAlloc mode arenas are retained dirty, and allocations will zero their memory
+		candidate.rewind()
 		return candidate, true
 	}
 }
 
 func (a *DynamicAllocator) init() {
 	if a.arenaMask == 0 {
+		a.panicIfClosed()
 		a.arenaMask = uint16(rand.Uint32()) | 1
+		a.check = newPtrCheck()
+	}
+}
+
+func (a *DynamicAllocator) panicIfClosed() {
+	if a.closed {
+		panic(AllocatorClosedError)
 	}
 }
 
 type minHeapOfClearArenas struct {
-	heap []RawAllocator
+	heap  []clearArena
+	bytes int
+}
+
+type clearArena struct {
+	RawAllocator
+	clearCycle int // Clear call of the owner, after which the arena was retained
 }
 
-func (h *minHeapOfClearArenas) Push(arena RawAllocator) {
-	h.heap = append(h.heap, arena)
+func (h *minHeapOfClearArenas) Push(arena RawAllocator, clearCycle int) {
+	h.heap = append(h.heap, clearArena{RawAllocator: arena, clearCycle: clearCycle})
+	h.bytes += arena.len()
 	currentIdx := len(h.heap) - 1
 	for {
 		parentIdx := (currentIdx - 1) / 2
@@ -299,7 +1034,8 @@ func (h *minHeapOfClearArenas) Pop() (RawAllocator, bool) {
 	if len(h.heap) == 0 {
 		return RawAllocator{}, false
 	}
-	result := h.heap[0]
+	result := h.heap[0].RawAllocator
+	h.bytes -= result.len()
 	h.heap[0] = h.heap[len(h.heap)-1]
 	currentIdx := 0
 
@@ -2,8 +2,10 @@ package arena
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"runtime"
 	"unsafe"
 )
 
@@ -34,10 +36,18 @@ type allocator interface {
 // and refer to other implementations only if you really need to.
 type GenericAllocator struct {
 	target          allocator
+	leakRecord      *allocatorLeakRecord
+	registryMember  *registryMember
 	targetArenaMask uint16
 	thisArenaMask   uint16
+	targetCheck     ptrCheck
+	thisCheck       ptrCheck
+	history         ptrCheckHistory
+	targetOpts      DynamicOptions
 
 	delegateClear          bool
+	ownsTarget             bool
+	closed                 bool
 	allocationLimitInBytes int
 
 	countOfAllocations int
@@ -55,14 +65,44 @@ type GenericAllocator struct {
 //    if not specified we will use the limit of the underlying allocator.
 //  - InitialCapacity - initial capacity of the underlying allocator,
 //    if not specified we will use the default capacity of the underlying allocator.
-//  - DelegateClearToUnderlyingAllocator - delegate Clear call,
-//    this option changes behaviour of Clear method,
-//    so it calls Clear on underlying allocator,
-//    for additional details please refer to Clear method documentation.
+//  - DelegateClearToUnderlyingAllocator - delegate Clear and Close calls,
+//    this option changes behaviour of Clear and Close methods,
+//    so they call Clear and Close on underlying allocator,
+//    for additional details please refer to Clear and Close methods documentation.
+//    It is always enabled for the underlying allocator created by the allocator itself
+//    if RetentionPolicy, BackgroundZeroer or ZeroOnAlloc is specified,
+//    because they take effect only if the underlying allocator is reused after Clear.
+//  - LeakDetector - opt-in arena.GenericLeakDetector that will track the allocator,
+//    for additional details please refer to arena.GenericLeakDetector documentation.
+//  - GrowthStrategy - strategy that calculates the size of the next arena of the underlying allocator,
+//    for additional details please refer to arena.DynamicOptions documentation.
+//  - CapacityLimitInBytes - hard upper limit for AllocatedBytes of the underlying allocator,
+//    for additional details please refer to arena.DynamicOptions documentation.
+//  - RetentionPolicy - policy that limits clear arenas retained by the underlying allocator after Clear,
+//    for additional details please refer to arena.RetentionPolicy documentation.
+//  - BackgroundZeroer - worker that zeroes buffers of the underlying allocator after Clear in the background,
+//    for additional details please refer to arena.BackgroundZeroer documentation.
+//  - ZeroOnAlloc - zero memory of the underlying allocator on allocation instead of Clear,
+//    for additional details please refer to arena.DynamicOptions documentation.
+//
+// InitialCapacity, GrowthStrategy, CapacityLimitInBytes, RetentionPolicy, BackgroundZeroer and ZeroOnAlloc
+// are applied only to the underlying
+// arena.DynamicAllocator created by the allocator itself, but not to the target passed to arena.NewSubAllocator.
 type Options struct {
 	AllocationLimitInBytes             uint64
+	CapacityLimitInBytes               uint64
+	LeakDetector                       *GenericLeakDetector
+	GrowthStrategy                     GrowthStrategy
+	RetentionPolicy                    RetentionPolicy
+	BackgroundZeroer                   *BackgroundZeroer
 	InitialCapacity                    uint32
 	DelegateClearToUnderlyingAllocator bool
+	ZeroOnAlloc                        bool
+}
+
+// reusesTarget reports whether the options take effect only if the underlying allocator is reused after Clear.
+func (opts Options) reusesTarget() bool {
+	return opts.RetentionPolicy != (RetentionPolicy{}) || opts.BackgroundZeroer != nil || opts.ZeroOnAlloc
 }
 
 // NewGenericAllocator creates an instance of the arena.GenericAllocator
@@ -74,16 +114,32 @@ func NewGenericAllocator(opts Options) *GenericAllocator {
 	if opts.AllocationLimitInBytes > uint64(math.MaxInt64) {
 		panic("AllocationLimitInBytes is too large")
 	}
-	result := &GenericAllocator{delegateClear: opts.DelegateClearToUnderlyingAllocator}
+	result := &GenericAllocator{
+		delegateClear: opts.DelegateClearToUnderlyingAllocator || opts.reusesTarget(),
+		targetOpts: DynamicOptions{
+			CapacityLimitInBytes: opts.CapacityLimitInBytes,
+			GrowthStrategy:       opts.GrowthStrategy,
+			RetentionPolicy:      opts.RetentionPolicy,
+			BackgroundZeroer:     opts.BackgroundZeroer,
+			ZeroOnAlloc:          opts.ZeroOnAlloc,
+		},
+	}
 	if opts.InitialCapacity > 0 {
-		result.target = NewDynamicAllocatorWithInitialCapacity(opts.InitialCapacity)
+		targetOpts := result.targetOpts
+		targetOpts.InitialCapacity = opts.InitialCapacity
+		result.target = NewDynamicAllocatorWithOptions(targetOpts)
+		result.ownsTarget = true
 		result.targetArenaMask = result.target.CurrentOffset().p.arenaMask
+		result.targetCheck = result.target.CurrentOffset().p.check
 		result.allocatedBytes += result.target.Metrics().AllocatedBytes
 	}
 	if opts.AllocationLimitInBytes > 0 {
 		result.allocationLimitInBytes = int(opts.AllocationLimitInBytes)
 	}
 	result.init()
+	if opts.LeakDetector != nil {
+		opts.LeakDetector.track(result)
+	}
 	return result
 }
 
@@ -98,18 +154,27 @@ func NewSubAllocator(target allocator, opts Options) *GenericAllocator {
 	if opts.AllocationLimitInBytes > uint64(math.MaxInt64) {
 		panic("AllocationLimitInBytes is too large")
 	}
+	ownsTarget := target == nil
 	if target == nil {
-		target = NewGenericAllocator(opts)
+		targetOpts := opts
+		// only the sub-allocator itself is tracked, because the target is owned by it
+		targetOpts.LeakDetector = nil
+		target = NewGenericAllocator(targetOpts)
 	}
 	result := &GenericAllocator{
 		target:          target,
 		targetArenaMask: target.CurrentOffset().p.arenaMask,
-		delegateClear:   opts.DelegateClearToUnderlyingAllocator,
+		targetCheck:     target.CurrentOffset().p.check,
+		delegateClear:   opts.DelegateClearToUnderlyingAllocator || (ownsTarget && opts.reusesTarget()),
+		ownsTarget:      ownsTarget,
 	}
 	if opts.AllocationLimitInBytes > 0 {
 		result.allocationLimitInBytes = int(opts.AllocationLimitInBytes)
 	}
 	result.init()
+	if opts.LeakDetector != nil {
+		opts.LeakDetector.track(result)
+	}
 	return result
 }
 
@@ -154,7 +219,13 @@ func (a *GenericAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
 	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
 	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
 
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+
 	result.arenaMask = a.thisArenaMask
+	a.thisCheck = a.history.next(a.thisCheck)
+	result.check = a.thisCheck
 	return result, nil
 }
 
@@ -178,6 +249,21 @@ func (a *GenericAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
 // but we'd suggest to do it right before use to eliminate its visibility scope
 // and potentially prevent it's escaping to the heap.
 func (a *GenericAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	return a.alloc(size, alignment, true)
+}
+
+// AllocNoZero performs allocation within the underlying target allocator the same way as Alloc,
+// but it allows the target to skip zeroing of the allocated memory, so it can contain stale data.
+// Only targets created with ZeroOnAlloc option skip zeroing,
+// for other targets AllocNoZero is the same as Alloc.
+//
+// IMPORTANT, this method is potentially UNSAFE to use, please use it only if you
+// fully overwrite the allocated memory before reading it, and never allocate values with pointers by it.
+func (a *GenericAllocator) AllocNoZero(size, alignment uintptr) (Ptr, error) {
+	return a.alloc(size, alignment, false)
+}
+
+func (a *GenericAllocator) alloc(size, alignment uintptr, zero bool) (Ptr, error) {
 	a.init()
 	targetSize := int(size)
 
@@ -191,7 +277,13 @@ func (a *GenericAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
 	}
 
 	beforeCallStats := a.target.Stats()
-	result, allocErr := a.target.Alloc(size, alignment)
+	var result Ptr
+	var allocErr error
+	if zero {
+		result, allocErr = a.target.Alloc(size, alignment)
+	} else {
+		result, allocErr = allocNoZero(a.target, size, alignment)
+	}
 	if allocErr != nil {
 		return Ptr{}, allocErr
 	}
@@ -204,10 +296,193 @@ func (a *GenericAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
 	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
 	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
 
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+
 	result.arenaMask = a.thisArenaMask
+	a.thisCheck = a.history.next(a.thisCheck)
+	result.check = a.thisCheck
 	return result, nil
 }
 
+// AllocRange performs allocation of at least minSize and at most preferredSize bytes
+// within the underlying target allocator.
+//
+// It returns arena.Ptr value and the actual size granted for this allocation,
+// so the resulting size is always between minSize and preferredSize.
+//
+// arena.GenericAllocator has "limits" functionality, so instead of returning arena.AllocationLimitError
+// it will shrink preferredSize to fit into specified allocationLimitInBytes.
+// arena.AllocationLimitError will be returned only if even minSize violates the limit.
+//
+// If the target allocator doesn't support AllocRange, preferredSize will be allocated,
+// with fallback to minSize if the target can't afford it.
+//
+// minSize - should be less than or equal to preferredSize,
+// otherwise arena.AllocationInvalidArgumentError will be returned.
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *GenericAllocator) AllocRange(minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if minSize > preferredSize {
+		return Ptr{}, 0, AllocationInvalidArgumentError
+	}
+	targetPadding := calculatePadding(a.target.CurrentOffset().p.offset, alignment)
+
+	if a.allocationLimitInBytes > 0 {
+		availableSize := a.allocationLimitInBytes - a.usedBytes - int(targetPadding)
+		if availableSize < 0 || uintptr(availableSize) < minSize {
+			return Ptr{}, 0, AllocationLimitError
+		}
+		if uintptr(availableSize) < preferredSize {
+			preferredSize = uintptr(availableSize)
+		}
+	}
+
+	beforeCallStats := a.target.Stats()
+	result, size, allocErr := allocRange(a.target, minSize, preferredSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, 0, allocErr
+	}
+	afterCallStats := a.target.Stats()
+
+	a.countOfAllocations++
+	a.usedBytes += afterCallStats.UsedBytes - beforeCallStats.UsedBytes
+	a.dataBytes += int(size)
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
+	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
+
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+
+	result.arenaMask = a.thisArenaMask
+	a.thisCheck = a.history.next(a.thisCheck)
+	result.check = a.thisCheck
+	return result, size, nil
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes
+// within the underlying target allocator.
+//
+// If the target allocator can extend the value in place, the same arena.Ptr is returned.
+// Otherwise, newSize bytes are allocated and the value is copied there.
+// If the target allocator supports Free, the previous value is freed,
+// so arena.Ptr should be the start of the allocation, and oldSize should be the same as it was passed to allocation.
+// Otherwise, the previous value is left untouched, so it stays valid until Clear.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// arena.GenericAllocator has "limits" functionality, so it returns arena.AllocationLimitError
+// if the extension in place or the new allocation violates the specified allocationLimitInBytes.
+//
+// If the target allocator doesn't support Realloc, the value is always moved to the new allocation.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *GenericAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if oldSize > 0 && (p.arenaMask != a.thisArenaMask || !a.history.accepts(a.thisCheck, p.check)) {
+		a.panicIfClosed()
+		panic("pointer isn't part of this arena")
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+
+	targetPtr := p
+	targetPtr.arenaMask = a.targetArenaMask
+	targetPtr.check = a.targetCheck
+	if a.allocationLimitInBytes > 0 {
+		targetOffset := a.target.CurrentOffset().p
+		// only bump allocators can extend the last allocation in place
+		requiredSize := newSize + calculatePadding(targetOffset.offset, alignment)
+		isLastAllocation := targetOffset.bucketIdx == p.bucketIdx && targetOffset.offset == p.offset+oldSize
+		if oldSize > 0 && isLastAllocation && !supportsFree(a.target) {
+			requiredSize = newSize - oldSize
+		}
+		if a.usedBytes+int(requiredSize) > a.allocationLimitInBytes {
+			return Ptr{}, AllocationLimitError
+		}
+	}
+
+	beforeCallStats := a.target.Stats()
+	result, reallocErr := realloc(a.target, targetPtr, oldSize, newSize, alignment)
+	if reallocErr != nil {
+		return Ptr{}, reallocErr
+	}
+	afterCallStats := a.target.Stats()
+
+	if result != targetPtr {
+		a.countOfAllocations++
+	}
+	if result == targetPtr || supportsFree(a.target) {
+		// the value is extended in place, or the previous value is freed by the target
+		a.dataBytes += int(newSize - oldSize)
+	} else {
+		a.dataBytes += int(newSize)
+	}
+	a.usedBytes += afterCallStats.UsedBytes - beforeCallStats.UsedBytes
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
+	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
+
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+
+	result.arenaMask = a.thisArenaMask
+	a.thisCheck = a.history.next(a.thisCheck)
+	result.check = a.thisCheck
+	return result, nil
+}
+
+// Free returns the value referenced by arena.Ptr to the underlying target allocator,
+// so it can be reused by subsequent allocations.
+// Size should be the same as it was passed to allocation, or the length of allocated arena.Bytes or buffer.
+// It is passed to targets that need it, like arena.SizeClassAllocator,
+// and ignored by targets that free values by arena.Ptr only, like arena.SlabAllocator or arena.BuddyAllocator.
+//
+// Free returns arena.UnsupportedOperationError if the target allocator can't free individual values.
+// It panics if arena.Ptr wasn't allocated by this allocator or was allocated before Clear,
+// and any usage of arena.Ptr or values converted by ToRef after Free is a "use after free" error.
+func (a *GenericAllocator) Free(p Ptr, size uintptr) error {
+	a.init()
+	if p.arenaMask != a.thisArenaMask || !a.history.accepts(a.thisCheck, p.check) {
+		a.panicIfClosed()
+		panic("pointer isn't part of this arena")
+	}
+	if !supportsFree(a.target) {
+		return UnsupportedOperationError
+	}
+
+	beforeCallStats := a.target.Stats()
+	p.arenaMask = a.targetArenaMask
+	p.check = a.targetCheck
+	freeErr := free(a.target, p, size)
+	if freeErr != nil {
+		return freeErr
+	}
+	afterCallStats := a.target.Stats()
+
+	a.usedBytes = max(a.usedBytes+afterCallStats.UsedBytes-beforeCallStats.UsedBytes, 0)
+	a.dataBytes = min(max(a.dataBytes-int(size), 0), a.usedBytes)
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+	return nil
+}
+
 // ToRef converts arena.Ptr to unsafe.Pointer.
 //
 // This method performs bounds check, so it can panic if you pass an arena.Ptr
@@ -219,7 +494,8 @@ func (a *GenericAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
 // We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
 // and potentially prevent it's escaping to the heap.
 func (a *GenericAllocator) ToRef(p Ptr) unsafe.Pointer {
-	if p.arenaMask != a.thisArenaMask {
+	if p.arenaMask != a.thisArenaMask || !a.history.accepts(a.thisCheck, p.check) {
+		a.panicIfClosed()
 		panic("pointer isn't part of this arena")
 	}
 
@@ -227,18 +503,78 @@ func (a *GenericAllocator) ToRef(p Ptr) unsafe.Pointer {
 		return nil
 	}
 	p.arenaMask = a.targetArenaMask
+	p.check = a.targetCheck
 	return a.target.ToRef(p)
 }
 
 // CurrentOffset returns the current allocation offset.
 // This method can be primarily used to build other allocators on top of arena.GenericAllocator.
+//
+// In checked mode, enabled by `arenachecked` or `arenadebug` build tags,
+// the returned offset is also a checkpoint, so values allocated after it start a new generation of arena.Ptr.
 func (a *GenericAllocator) CurrentOffset() Offset {
 	a.init()
+	a.history.checkpoint()
 	result := a.target.CurrentOffset()
+	if result.p.arenaMask == a.targetArenaMask {
+		// ResetTo rewinds the target to its latest checkpoint generation,
+		// so values allocated by the target before it stay valid
+		a.targetCheck = result.p.check
+	}
 	result.p.arenaMask = a.thisArenaMask
+	result.p.check = a.thisCheck
 	return result
 }
 
+// ResetTo frees everything allocated after the checkpoint previously returned by CurrentOffset
+// by rewinding the underlying target allocator, so only the region allocated after the checkpoint is filled with zeros.
+// Checkpoints can be nested, and the allocator can be rewound to any of them, from the latest to the earliest.
+//
+// If the target allocator is shared with other allocators, their values allocated after the checkpoint are freed too.
+// Used bytes are rewound precisely, but the count of allocations is not,
+// and data bytes and padding overhead are rewound approximately, since per-allocation history isn't tracked.
+//
+// Unlike Clear, ResetTo doesn't change the arena.GenericAllocator.thisArenaMask,
+// because arena.Ptr values allocated before the checkpoint should stay valid.
+// So by default ToRef catches only usages of arena.Ptr that point beyond the current offset of the target allocator,
+// and once the same memory is allocated again, arena.Ptr allocated after the checkpoint
+// silently points to the new value.
+// In checked mode, enabled by `arenachecked` or `arenadebug` build tags, such arena.Ptr values
+// are always rejected, since they belong to generations started after the checkpoint.
+//
+// ResetTo returns arena.AllocationInvalidArgumentError if the checkpoint doesn't belong to this allocator
+// or is out of the currently allocated region,
+// and arena.UnsupportedOperationError if the target allocator doesn't support ResetTo.
+func (a *GenericAllocator) ResetTo(o Offset) error {
+	a.init()
+	if o.p.arenaMask != a.thisArenaMask || !a.history.accepts(a.thisCheck, o.p.check) {
+		return AllocationInvalidArgumentError
+	}
+	target, ok := a.target.(resetter)
+	if !ok {
+		return UnsupportedOperationError
+	}
+
+	beforeCallStats := a.target.Stats()
+	checkpoint := o.p.check
+	o.p.arenaMask = a.targetArenaMask
+	o.p.check = a.targetCheck
+	resetErr := target.ResetTo(o)
+	if resetErr != nil {
+		return resetErr
+	}
+	a.thisCheck = a.history.resetTo(checkpoint)
+	releasedBytes := beforeCallStats.UsedBytes - a.target.Stats().UsedBytes
+
+	a.usedBytes = max(a.usedBytes-releasedBytes, 0)
+	a.dataBytes = min(max(a.dataBytes-releasedBytes, 0), a.usedBytes)
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+	return nil
+}
+
 // Clear gets rid of data in current allocator, clears metrics, and makes it available for re-use.
 // According to DelegateClearToUnderlyingAllocator option, it will either call Clear on underlying allocator
 // or simply gets rid of it, so it will create a new target during the first call after Clear.
@@ -248,19 +584,226 @@ func (a *GenericAllocator) CurrentOffset() Offset {
 // but it can't catch usages of already converted values.
 // To avoid such situations, we'd suggest calling this method right before using the result pointer to eliminate its
 // visibility scope and potentially prevent it's escaping to the heap.
+//
+// Clear has no effect on the closed allocator.
 func (a *GenericAllocator) Clear() {
+	if a.closed {
+		return
+	}
+	if a.leakRecord != nil {
+		a.leakRecord.cleared()
+	}
 	if a.delegateClear {
+		beforeCallStats := a.target.Stats()
 		a.target.Clear()
+		// clear arenas can be released by the target according to its retention policy
+		a.allocatedBytes += a.target.Stats().AllocatedBytes - beforeCallStats.AllocatedBytes
 		a.targetArenaMask = a.target.CurrentOffset().p.arenaMask
+		a.targetCheck = a.target.CurrentOffset().p.check
 	} else {
-		a.target = nil
-		a.targetArenaMask = 0
+		a.dropTarget()
+	}
+
+	a.thisArenaMask = (a.thisArenaMask + 1) | 1
+	a.thisCheck = a.history.restart(a.thisCheck)
+	a.paddingOverhead = 0
+	a.dataBytes = 0
+	a.usedBytes = 0
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(0)
+	}
+}
+
+// Close gets rid of data in current allocator and makes it unusable.
+// According to DelegateClearToUnderlyingAllocator option, it will either propagate Close to underlying allocator,
+// or simply gets rid of it, so it can be collected by the GC.
+// If the underlying allocator doesn't support Close, its Clear method will be called instead.
+//
+// Any subsequent call to Alloc, AllocUnaligned, AllocRange, Realloc, Free, CurrentOffset or ToRef
+// will panic with arena.AllocatorClosedError, so all outstanding arena.Ptr values become unusable.
+// Close is idempotent, and Clear has no effect on the closed allocator.
+func (a *GenericAllocator) Close() {
+	if a.closed {
+		return
+	}
+	if a.leakRecord != nil {
+		a.leakRecord.closed()
+		a.leakRecord = nil
+		runtime.SetFinalizer(a, nil)
 	}
+	if a.delegateClear && a.target != nil {
+		targetCloser, ok := a.target.(closer)
+		if ok {
+			targetCloser.Close()
+		} else {
+			a.target.Clear()
+		}
+	}
+	a.dropTarget()
 
 	a.thisArenaMask = (a.thisArenaMask + 1) | 1
+	a.thisCheck = a.history.restart(a.thisCheck)
 	a.paddingOverhead = 0
 	a.dataBytes = 0
 	a.usedBytes = 0
+	a.allocatedBytes = 0
+	a.closed = true
+}
+
+// WriteTo writes the dump of the allocator to w, so it can be restored later by GenericAllocator.ReadFrom.
+// The dump consists of the header with the arena mask and metrics of this allocator
+// and the dump of the underlying target allocator.
+//
+// WriteTo returns arena.UnsupportedOperationError if the target allocator is shared with other allocators,
+// or doesn't support WriteTo. For details please refer to arena.DynamicAllocator.WriteTo.
+func (a *GenericAllocator) WriteTo(w io.Writer) (int64, error) {
+	a.init()
+	target, ok := a.target.(io.WriterTo)
+	if !ok || !a.ownsTarget {
+		return 0, UnsupportedOperationError
+	}
+
+	d := &dumpWriter{w: w}
+	d.header(genericDumpKind, a.thisArenaMask, a.thisCheck)
+	d.uint64(uint64(a.countOfAllocations))
+	d.uint64(uint64(a.dataBytes))
+	if d.err != nil {
+		return d.written, d.err
+	}
+	targetWritten, writeErr := target.WriteTo(w)
+	if writeErr != nil {
+		return d.written + targetWritten, writeErr
+	}
+	// generations of arena.Ptr values are dumped only in checked mode
+	d.written += targetWritten
+	a.history.writeTo(d)
+	return d.written, d.err
+}
+
+// ReadFrom replaces the content of the allocator with the dump previously written by GenericAllocator.WriteTo,
+// so arena.Ptr, arena.Bytes and generated pointers issued by the dumped allocator are valid for this one.
+//
+// ReadFrom returns arena.UnsupportedOperationError if the target allocator is shared with other allocators,
+// or doesn't support ReadFrom, and arena.AllocationLimitError if the restored content exceeds
+// AllocationLimitInBytes. In case of any other error, the allocator is left cleared.
+// For details please refer to arena.DynamicAllocator.ReadFrom.
+func (a *GenericAllocator) ReadFrom(r io.Reader) (int64, error) {
+	a.init()
+	target, ok := a.target.(io.ReaderFrom)
+	if !ok || !a.ownsTarget {
+		return 0, UnsupportedOperationError
+	}
+
+	d := &dumpReader{r: r}
+	arenaMask, check, headerErr := d.header(genericDumpKind)
+	if headerErr != nil {
+		return d.read, headerErr
+	}
+	countOfAllocations := d.uint64()
+	dataBytes := d.uint64()
+	if d.err != nil {
+		return d.read, d.err
+	}
+
+	beforeCallStats := a.target.Stats()
+	targetRead, readErr := target.ReadFrom(r)
+	afterCallStats := a.target.Stats()
+	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
+	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
+	// generations of arena.Ptr values are dumped only in checked mode
+	history := ptrCheckHistory{}
+	if readErr == nil && !history.readFrom(d, check) {
+		readErr = InvalidDumpError
+	}
+	if readErr == nil && d.err != nil {
+		readErr = d.err
+	}
+	if readErr == nil && a.allocationLimitInBytes > 0 && afterCallStats.UsedBytes > a.allocationLimitInBytes {
+		readErr = AllocationLimitError
+	}
+	if readErr != nil {
+		a.Clear()
+		return d.read + targetRead, readErr
+	}
+
+	a.targetArenaMask = a.target.CurrentOffset().p.arenaMask
+	a.targetCheck = a.target.CurrentOffset().p.check
+	a.thisArenaMask = arenaMask
+	a.thisCheck = check
+	a.history = history
+	a.countOfAllocations = int(countOfAllocations)
+	a.usedBytes = afterCallStats.UsedBytes
+	a.dataBytes = min(int(dataBytes), a.usedBytes)
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+	return d.read + targetRead, nil
+}
+
+// Compact merges underlying arenas of the target allocator into one, for details please refer to
+// arena.DynamicAllocator.Compact. arena.Ptr values issued before Compact are rejected by the allocator
+// and have to be migrated by the returned arena.PtrTranslator.
+//
+// Compact returns arena.UnsupportedOperationError if the target allocator is shared with other allocators,
+// or doesn't support Compact.
+func (a *GenericAllocator) Compact() (PtrTranslator, error) {
+	a.init()
+	target, ok := a.target.(compactor)
+	if !ok || !a.ownsTarget {
+		return nil, UnsupportedOperationError
+	}
+
+	beforeCallStats := a.target.Stats()
+	translateTarget, compactErr := target.Compact()
+	afterCallStats := a.target.Stats()
+	a.allocatedBytes += afterCallStats.AllocatedBytes - beforeCallStats.AllocatedBytes
+	a.onHeapAllocations += afterCallStats.CountOfOnHeapAllocations - beforeCallStats.CountOfOnHeapAllocations
+	if compactErr != nil {
+		return nil, compactErr
+	}
+
+	fromTargetMask, fromTargetCheck := a.targetArenaMask, a.targetCheck
+	fromMask, fromCheck, fromHistory := a.thisArenaMask, a.thisCheck, a.history
+	a.targetArenaMask = a.target.CurrentOffset().p.arenaMask
+	a.targetCheck = a.target.CurrentOffset().p.check
+	a.thisArenaMask = (a.thisArenaMask + 1) | 1
+	a.thisCheck = a.history.restart(a.thisCheck)
+	a.usedBytes = afterCallStats.UsedBytes
+	a.dataBytes = min(a.dataBytes, a.usedBytes)
+	a.paddingOverhead = a.usedBytes - a.dataBytes
+	if a.registryMember != nil {
+		a.registryMember.publishUsedBytes(a.usedBytes)
+	}
+
+	toMask, toCheck := a.thisArenaMask, a.thisCheck
+	return func(p Ptr) Ptr {
+		if p == (Ptr{}) {
+			return p
+		}
+		if p.arenaMask != fromMask || !fromHistory.accepts(fromCheck, p.check) {
+			panic("pointer isn't part of this arena")
+		}
+		p.arenaMask, p.check = fromTargetMask, fromTargetCheck
+		p = translateTarget(p)
+		p.arenaMask, p.check = toMask, toCheck
+		return p
+	}, nil
+}
+
+// ReleaseUnused releases all clear arenas retained by the target allocator for future allocations
+// and returns the count of released bytes, for details please refer to arena.DynamicAllocator.ReleaseUnused.
+// If the target allocator doesn't support ReleaseUnused, it returns 0.
+// The target retains arenas only if Clear is delegated to it, so without DelegateClearToUnderlyingAllocator
+// option there is nothing to release, unless it is enabled implicitly by RetentionPolicy, BackgroundZeroer or ZeroOnAlloc.
+func (a *GenericAllocator) ReleaseUnused() int {
+	target, ok := a.target.(unusedReleaser)
+	if !ok {
+		return 0
+	}
+	releasedBytes := target.ReleaseUnused()
+	a.allocatedBytes -= releasedBytes
+	return releasedBytes
 }
 
 // Stats provides a snapshot of essential allocation statistics,
@@ -286,8 +829,10 @@ func (a *GenericAllocator) Metrics() Metrics {
 			AllocatedBytes:           a.allocatedBytes,
 			CountOfOnHeapAllocations: a.onHeapAllocations,
 		},
-		AvailableBytes: targetArenaMetrics.AvailableBytes,
-		MaxCapacity:    targetArenaMetrics.MaxCapacity,
+		AvailableBytes:    targetArenaMetrics.AvailableBytes,
+		MaxCapacity:       targetArenaMetrics.MaxCapacity,
+		RetainedBytes:     targetArenaMetrics.RetainedBytes,
+		PendingDirtyBytes: targetArenaMetrics.PendingDirtyBytes,
 	}
 	if a.allocationLimitInBytes > 0 {
 		result.MaxCapacity = a.allocationLimitInBytes
@@ -302,15 +847,19 @@ type EnhancedMetrics struct {
 	CountOfAllocations int // simple counter of Alloc calls
 	PaddingOverhead    int // count of bytes used for alignment padding
 	DataBytes          int // count of bytes used specifically for useful data
+	FreeListBytes      int // count of freed bytes that are kept for reuse by allocators that support Free
+	FragmentationBytes int // count of bytes that are lost due to rounding of allocations to size classes
 }
 
 // String provides a string snapshot of the EnhancedMetrics state.
 func (p EnhancedMetrics) String() string {
 	return fmt.Sprintf(
 		"{UsedBytes: %v AvailableBytes: %v AllocatedBytes %v MaxCapacity %v "+
-			"CountOfOnHeapAllocations %v CountOfAllocations: %v PaddingOverhead: %v DataBytes: %v}",
+			"CountOfOnHeapAllocations %v CountOfAllocations: %v PaddingOverhead: %v DataBytes: %v "+
+			"FreeListBytes: %v FragmentationBytes: %v}",
 		p.UsedBytes, p.AvailableBytes, p.AllocatedBytes, p.MaxCapacity,
 		p.CountOfOnHeapAllocations, p.CountOfAllocations, p.PaddingOverhead, p.DataBytes,
+		p.FreeListBytes, p.FragmentationBytes,
 	)
 }
 
@@ -327,18 +876,42 @@ func (a *GenericAllocator) EnhancedMetrics() EnhancedMetrics {
 
 // String provides a string snapshot of the current allocation offset.
 func (a *GenericAllocator) String() string {
+	if a.closed {
+		return fmt.Sprintf("arena{mask: %v closed}", a.thisArenaMask)
+	}
 	a.init()
 	return fmt.Sprintf("arena{mask: %v target: %v}", a.thisArenaMask, a.target)
 }
 
 func (a *GenericAllocator) init() {
 	if a.target == nil {
-		a.target = &DynamicAllocator{}
+		a.panicIfClosed()
+		a.target = NewDynamicAllocatorWithOptions(a.targetOpts)
+		a.ownsTarget = true
 		a.targetArenaMask = a.target.CurrentOffset().p.arenaMask
+		a.targetCheck = a.target.CurrentOffset().p.check
 	}
 	if a.thisArenaMask == 0 {
 		// here we can give guarantees that sub-arena mask will differ from parent arena
 		modifier := uint16(rand.Uint32()) | 1
 		a.thisArenaMask = (a.target.CurrentOffset().p.arenaMask + modifier) | 1
+		a.thisCheck = newPtrCheck()
+	}
+}
+
+func (a *GenericAllocator) panicIfClosed() {
+	if a.closed {
+		panic(AllocatorClosedError)
+	}
+}
+
+func (a *GenericAllocator) dropTarget() {
+	if protectMemoryOnClear && a.ownsTarget && a.target != nil {
+		// dropped target should be cleared to protect its memory in debug mode
+		a.target.Clear()
 	}
+	a.target = nil
+	a.targetArenaMask = 0
+	a.targetCheck = ptrCheck{}
+	a.ownsTarget = false
 }
@@ -0,0 +1,37 @@
+package arena
+
+// GrowthStrategy calculates the size of the next arena allocated by arena.DynamicAllocator on growth,
+// based on the size of the current arena, which is 0 for the first one,
+// and the size required by the allocation that caused the growth.
+//
+// arena.DynamicAllocator always extends the resulting size to fit the required size,
+// so strategies can return the preferred size only. Custom strategies can be used as well.
+type GrowthStrategy func(currentSize int, requiredSize int) int
+
+// ExponentialGrowth returns the default growth strategy of arena.DynamicAllocator,
+// that doubles the size of the next arena, but caps it by maxArenaSize.
+// If maxArenaSize is 0, the size of arenas isn't capped.
+func ExponentialGrowth(maxArenaSize uint32) GrowthStrategy {
+	return func(currentSize int, requiredSize int) int {
+		newSize := max(currentSize*2, requiredSize*2)
+		if maxArenaSize > 0 {
+			newSize = min(newSize, int(maxArenaSize))
+		}
+		return newSize
+	}
+}
+
+// LinearGrowth returns the growth strategy that makes each next arena bigger by step bytes.
+func LinearGrowth(step uint32) GrowthStrategy {
+	return func(currentSize int, requiredSize int) int {
+		return currentSize + int(step)
+	}
+}
+
+// FixedGrowth returns the growth strategy that allocates arenas of the same chunkSize,
+// unless the allocation requires more.
+func FixedGrowth(chunkSize uint32) GrowthStrategy {
+	return func(currentSize int, requiredSize int) int {
+		return int(chunkSize)
+	}
+}
@@ -0,0 +1,248 @@
+package arena
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"unsafe"
+)
+
+const maxAllocationStackDepth = 32
+
+type allocationStack [maxAllocationStackDepth]uintptr
+
+// AllocationSite is a snapshot of allocation statistics
+// collected by arena.InstrumentedAllocator for one unique call stack.
+type AllocationSite struct {
+	Stack              []uintptr // program counters of the call stack, starting from the allocation caller
+	CountOfAllocations int       // simple counter of Alloc calls
+	DataBytes          int       // count of bytes requested by callers
+	PaddingOverhead    int       // count of bytes used for alignment padding
+}
+
+// String provides a string snapshot of the AllocationSite state.
+func (s AllocationSite) String() string {
+	caller := "unknown"
+	if len(s.Stack) > 0 {
+		frame, _ := runtime.CallersFrames(s.Stack[:1]).Next()
+		caller = fmt.Sprintf("%v %v:%v", frame.Function, frame.File, frame.Line)
+	}
+	return fmt.Sprintf(
+		"{Caller: %v CountOfAllocations: %v DataBytes: %v PaddingOverhead: %v}",
+		caller, s.CountOfAllocations, s.DataBytes, s.PaddingOverhead,
+	)
+}
+
+type allocationSiteStats struct {
+	countOfAllocations int
+	dataBytes          int
+	paddingOverhead    int
+}
+
+// InstrumentedAllocator is the wrapper on top of any other allocator that records
+// count of allocations, allocated bytes and padding overhead per unique call stack.
+//
+// It can be used to figure-out which code paths consume arena memory,
+// for example, when arena.AllocationLimitError happens.
+// Collected statistics can be exported as a pprof-compatible profile with
+// InstrumentedAllocator.WriteProfile and analyzed by `go tool pprof`
+// in the same way as the heap profile.
+//
+// Statistics are collected for the whole lifetime of the allocator,
+// so they aren't affected by Clear, please refer to InstrumentedAllocator.ResetProfile for that.
+//
+// Stack unwinding is quite expensive, so InstrumentedAllocator is intended
+// to be used for diagnostics and not in the performance critical paths.
+type InstrumentedAllocator struct {
+	target allocator
+	sites  map[allocationStack]*allocationSiteStats
+}
+
+// NewInstrumentedAllocator creates an instance of arena.InstrumentedAllocator on top of the target allocator.
+// If target is nil, a new arena.GenericAllocator will be used as a target.
+func NewInstrumentedAllocator(target allocator) *InstrumentedAllocator {
+	if target == nil {
+		target = &GenericAllocator{}
+	}
+	return &InstrumentedAllocator{
+		target: target,
+		sites:  make(map[allocationStack]*allocationSiteStats),
+	}
+}
+
+// AllocUnaligned performs allocation within the target allocator, but without automatic alignment,
+// and records its statistics for the caller's stack.
+//
+// For detailed documentation please refer to the AllocUnaligned method of the target allocator.
+func (a *InstrumentedAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	beforeCallStats := a.target.Stats()
+	result, allocErr := a.target.AllocUnaligned(size)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	a.record(int(size), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	return result, nil
+}
+
+// Alloc performs allocation within the target allocator and records its statistics for the caller's stack.
+//
+// For detailed documentation please refer to the Alloc method of the target allocator.
+func (a *InstrumentedAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	beforeCallStats := a.target.Stats()
+	result, allocErr := a.target.Alloc(size, alignment)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	a.record(int(size), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	return result, nil
+}
+
+// AllocNoZero performs allocation without zeroing within the target allocator
+// and records its statistics for the caller's stack.
+//
+// If the target allocator doesn't support AllocNoZero, Alloc will be used instead.
+func (a *InstrumentedAllocator) AllocNoZero(size, alignment uintptr) (Ptr, error) {
+	beforeCallStats := a.target.Stats()
+	result, allocErr := allocNoZero(a.target, size, alignment)
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	a.record(int(size), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	return result, nil
+}
+
+// AllocRange performs allocation of at least minSize and at most preferredSize bytes within the target allocator
+// and records its statistics for the caller's stack.
+//
+// If the target allocator doesn't support AllocRange, preferredSize will be allocated,
+// with fallback to minSize if the target can't afford it.
+func (a *InstrumentedAllocator) AllocRange(minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error) {
+	beforeCallStats := a.target.Stats()
+	result, size, allocErr := allocRange(a.target, minSize, preferredSize, alignment)
+	if allocErr != nil {
+		return Ptr{}, 0, allocErr
+	}
+	a.record(int(size), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	return result, size, nil
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr within the target allocator
+// and records its statistics for the caller's stack.
+// Extension in place is recorded with the count of additional bytes, and moving with the whole newSize.
+//
+// If the target allocator doesn't support Realloc, the value is always moved to the new allocation.
+func (a *InstrumentedAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	beforeCallStats := a.target.Stats()
+	result, reallocErr := realloc(a.target, p, oldSize, newSize, alignment)
+	if reallocErr != nil {
+		return Ptr{}, reallocErr
+	}
+	if result != p {
+		a.record(int(newSize), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	} else if newSize > oldSize {
+		a.record(int(newSize-oldSize), a.target.Stats().UsedBytes-beforeCallStats.UsedBytes)
+	}
+	return result, nil
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer by delegating to the target allocator.
+func (a *InstrumentedAllocator) ToRef(p Ptr) unsafe.Pointer {
+	return a.target.ToRef(p)
+}
+
+// CurrentOffset returns the current allocation offset of the target allocator.
+func (a *InstrumentedAllocator) CurrentOffset() Offset {
+	return a.target.CurrentOffset()
+}
+
+// ResetTo calls ResetTo on the target allocator if it is supported,
+// otherwise it returns arena.UnsupportedOperationError.
+// Collected allocation statistics stay untouched.
+func (a *InstrumentedAllocator) ResetTo(o Offset) error {
+	target, ok := a.target.(resetter)
+	if !ok {
+		return UnsupportedOperationError
+	}
+	return target.ResetTo(o)
+}
+
+// Clear calls Clear on the target allocator.
+// Collected allocation statistics stay untouched.
+func (a *InstrumentedAllocator) Clear() {
+	a.target.Clear()
+}
+
+// Close calls Close on the target allocator if it is supported, otherwise it calls Clear.
+// Collected allocation statistics stay untouched.
+func (a *InstrumentedAllocator) Close() {
+	targetCloser, ok := a.target.(closer)
+	if ok {
+		targetCloser.Close()
+		return
+	}
+	a.target.Clear()
+}
+
+// Stats provides a snapshot of essential allocation statistics of the target allocator.
+func (a *InstrumentedAllocator) Stats() Stats {
+	return a.target.Stats()
+}
+
+// Metrics provides a snapshot of current allocation statistics of the target allocator.
+func (a *InstrumentedAllocator) Metrics() Metrics {
+	return a.target.Metrics()
+}
+
+// String provides a string snapshot of the current allocation offset.
+func (a *InstrumentedAllocator) String() string {
+	return fmt.Sprintf("instrumentedarena{sites: %v target: %v}", len(a.sites), a.target)
+}
+
+// AllocationSites provides a snapshot of collected allocation statistics
+// sorted by the count of used bytes in descending order.
+func (a *InstrumentedAllocator) AllocationSites() []AllocationSite {
+	result := make([]AllocationSite, 0, len(a.sites))
+	for stack, stats := range a.sites {
+		depth := 0
+		for depth < len(stack) && stack[depth] != 0 {
+			depth++
+		}
+		result = append(result, AllocationSite{
+			Stack:              append([]uintptr(nil), stack[:depth]...),
+			CountOfAllocations: stats.countOfAllocations,
+			DataBytes:          stats.dataBytes,
+			PaddingOverhead:    stats.paddingOverhead,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DataBytes+result[i].PaddingOverhead > result[j].DataBytes+result[j].PaddingOverhead
+	})
+	return result
+}
+
+// ResetProfile gets rid of all collected allocation statistics.
+func (a *InstrumentedAllocator) ResetProfile() {
+	a.sites = make(map[allocationStack]*allocationSiteStats)
+}
+
+// WriteProfile writes collected allocation statistics to w as a gzip-compressed pprof protocol buffer.
+// Resulting profile has three sample types: alloc_objects, alloc_space and padding_space
+// and can be viewed by `go tool pprof`.
+func (a *InstrumentedAllocator) WriteProfile(w io.Writer) error {
+	return writeAllocationProfile(w, a.AllocationSites())
+}
+
+func (a *InstrumentedAllocator) record(dataBytes int, usedBytes int) {
+	var stack allocationStack
+	// skip runtime.Callers, record and the allocation method itself
+	runtime.Callers(3, stack[:])
+	stats, ok := a.sites[stack]
+	if !ok {
+		stats = &allocationSiteStats{}
+		a.sites[stack] = stats
+	}
+	stats.countOfAllocations++
+	stats.dataBytes += dataBytes
+	stats.paddingOverhead += max(usedBytes-dataBytes, 0)
+}
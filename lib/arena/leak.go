@@ -0,0 +1,239 @@
+package arena
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LeakKind describes the reason why an allocator is considered as leaked.
+type LeakKind uint8
+
+const (
+	// LeakCollectedWithoutRelease means that the allocator was garbage collected
+	// without a single call to its Clear or Close methods.
+	LeakCollectedWithoutRelease LeakKind = iota + 1
+	// LeakLifetimeExceeded means that the allocator wasn't closed or cleared
+	// during the configured arena.GenericLeakDetectorOptions.MaxLifetime.
+	LeakLifetimeExceeded
+)
+
+// String provides a human-readable representation of the LeakKind.
+func (k LeakKind) String() string {
+	switch k {
+	case LeakCollectedWithoutRelease:
+		return "collected without Clear or Close"
+	case LeakLifetimeExceeded:
+		return "lifetime exceeded"
+	default:
+		return "unknown"
+	}
+}
+
+// Leak is a report about one leaked allocator produced by arena.GenericLeakDetector.
+type Leak struct {
+	Kind      LeakKind
+	Stack     []uintptr     // program counters of the allocator creation stack
+	CreatedAt time.Time     // time of the allocator creation or of its last Clear call
+	Lifetime  time.Duration // time passed since CreatedAt at the moment of detection
+}
+
+// String provides a string snapshot of the Leak including the creation stack trace.
+func (l Leak) String() string {
+	result := &strings.Builder{}
+	_, _ = fmt.Fprintf(result, "arena leak: %v; lifetime: %v; created at:\n", l.Kind, l.Lifetime)
+	frames := runtime.CallersFrames(l.Stack)
+	for {
+		frame, more := frames.Next()
+		_, _ = fmt.Fprintf(result, "\t%v\n\t\t%v:%v\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return result.String()
+}
+
+// GenericLeakDetectorOptions is a structure used to configure arena.GenericLeakDetector.
+//
+// You can configure:
+//  - MaxLifetime - maximal time that allocator can live without Clear or Close calls,
+//    if not specified, allocators are checked only on garbage collection.
+//  - OnLeak - callback that will be called for every detected leak,
+//    if not specified, leaks are accumulated and can be fetched by GenericLeakDetector.Leaks.
+//    Please note that OnLeak can be called from the finalizer goroutine.
+type GenericLeakDetectorOptions struct {
+	MaxLifetime time.Duration
+	OnLeak      func(Leak)
+}
+
+type allocatorLeakRecord struct {
+	detector         *GenericLeakDetector
+	stack            []uintptr
+	createdAt        time.Time
+	released         bool
+	lifetimeReported bool
+}
+
+// GenericLeakDetector is an opt-in debug facility that tracks allocators created with arena.Options.LeakDetector.
+//
+// Only arena.GenericAllocator instances created by arena.NewGenericAllocator or arena.NewSubAllocator are tracked.
+// Other allocators, like arena.DynamicAllocator, arena.SyncAllocator, arena.VirtualAllocator, arena.SlabAllocator,
+// arena.SizeClassAllocator or arena.BuddyAllocator, can't be tracked directly,
+// but they can be wrapped by arena.NewSubAllocator, so the sub-allocator is tracked
+// and should be cleared or closed instead of its target.
+//
+// It remembers the creation stack trace of every tracked allocator and reports allocators
+// that were garbage collected without Clear or Close calls, similar to finalizer-based file leak detectors,
+// or allocators that outlived the configured arena.GenericLeakDetectorOptions.MaxLifetime.
+//
+// GenericLeakDetector is safe for concurrent use, but tracking requires a stack unwinding on every allocator creation
+// and a finalizer per allocator, so it is intended to be used in tests or in debug builds.
+type GenericLeakDetector struct {
+	mu      sync.Mutex
+	opts    GenericLeakDetectorOptions
+	records map[*allocatorLeakRecord]struct{}
+	leaks   []Leak
+}
+
+// NewGenericLeakDetector creates an instance of arena.GenericLeakDetector configured by GenericLeakDetectorOptions.
+func NewGenericLeakDetector(opts GenericLeakDetectorOptions) *GenericLeakDetector {
+	return &GenericLeakDetector{
+		opts:    opts,
+		records: make(map[*allocatorLeakRecord]struct{}),
+	}
+}
+
+// CountOfTrackedAllocators returns the count of allocators that are alive and aren't closed yet.
+func (d *GenericLeakDetector) CountOfTrackedAllocators() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.records)
+}
+
+// CheckLifetimes reports all tracked allocators that outlived the configured MaxLifetime.
+// Every allocator is reported only once until its next Clear call.
+func (d *GenericLeakDetector) CheckLifetimes() {
+	if d.opts.MaxLifetime <= 0 {
+		return
+	}
+	now := time.Now()
+	var detectedLeaks []Leak
+	d.mu.Lock()
+	for record := range d.records {
+		lifetime := now.Sub(record.createdAt)
+		if record.lifetimeReported || lifetime <= d.opts.MaxLifetime {
+			continue
+		}
+		record.lifetimeReported = true
+		detectedLeaks = append(detectedLeaks, Leak{
+			Kind:      LeakLifetimeExceeded,
+			Stack:     record.stack,
+			CreatedAt: record.createdAt,
+			Lifetime:  lifetime,
+		})
+	}
+	d.mu.Unlock()
+	for _, leak := range detectedLeaks {
+		d.report(leak)
+	}
+}
+
+// Leaks returns all accumulated leaks and gets rid of them,
+// so subsequent calls will return only newly detected leaks.
+// If arena.GenericLeakDetectorOptions.OnLeak is specified, leaks aren't accumulated.
+func (d *GenericLeakDetector) Leaks() []Leak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := d.leaks
+	d.leaks = nil
+	return result
+}
+
+// CollectLeaks is a helper, primarily designed for tests, that forces garbage collection,
+// waits for finalizers of collected allocators, checks lifetimes, and returns all accumulated leaks.
+func (d *GenericLeakDetector) CollectLeaks() []Leak {
+	// finalizers are executed in unspecified order by a single goroutine,
+	// so we wait for two GC cycles to make sure that finalizers queued during the first one are done
+	for i := 0; i < 2; i++ {
+		finalizersAreDone := setFinalizerSentinel()
+		runtime.GC()
+		<-finalizersAreDone
+	}
+	d.CheckLifetimes()
+	return d.Leaks()
+}
+
+// setFinalizerSentinel creates an unreachable object with finalizer that signals
+// when the finalizer goroutine processes it after the next GC cycle.
+func setFinalizerSentinel() chan struct{} {
+	finalizersAreDone := make(chan struct{})
+	sentinel := &[32]byte{}
+	runtime.SetFinalizer(sentinel, func(*[32]byte) { close(finalizersAreDone) })
+	return finalizersAreDone
+}
+
+func (d *GenericLeakDetector) track(a *GenericAllocator) {
+	var stack [maxAllocationStackDepth]uintptr
+	// skip runtime.Callers, track and the allocator constructor
+	depth := runtime.Callers(3, stack[:])
+	record := &allocatorLeakRecord{
+		detector:  d,
+		stack:     append([]uintptr(nil), stack[:depth]...),
+		createdAt: time.Now(),
+	}
+	d.mu.Lock()
+	d.records[record] = struct{}{}
+	d.mu.Unlock()
+
+	a.leakRecord = record
+	runtime.SetFinalizer(a, func(a *GenericAllocator) {
+		a.leakRecord.collected()
+	})
+}
+
+func (record *allocatorLeakRecord) cleared() {
+	d := record.detector
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	record.released = true
+	record.lifetimeReported = false
+	record.createdAt = time.Now()
+}
+
+func (record *allocatorLeakRecord) closed() {
+	d := record.detector
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.records, record)
+}
+
+func (record *allocatorLeakRecord) collected() {
+	d := record.detector
+	d.mu.Lock()
+	_, tracked := d.records[record]
+	delete(d.records, record)
+	released := record.released
+	createdAt := record.createdAt
+	d.mu.Unlock()
+	if !tracked || released {
+		return
+	}
+	d.report(Leak{
+		Kind:      LeakCollectedWithoutRelease,
+		Stack:     record.stack,
+		CreatedAt: createdAt,
+		Lifetime:  time.Since(createdAt),
+	})
+}
+
+func (d *GenericLeakDetector) report(leak Leak) {
+	if d.opts.OnLeak != nil {
+		d.opts.OnLeak(leak)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.leaks = append(d.leaks, leak)
+}
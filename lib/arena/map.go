@@ -0,0 +1,342 @@
+package arena
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"unsafe"
+)
+
+const mapSegmentSize = 64
+const mapInitialBucketsCount = 8
+const mapMaxLoadFactor = 4
+
+type mapAllocator interface {
+	Alloc(size uintptr, alignment uintptr) (Ptr, error)
+	ToRef(p Ptr) unsafe.Pointer
+}
+
+// mapBucket is a head of the overflow chain of entries stored inside an arena.
+type mapBucket struct {
+	head Ptr
+	size uint32
+}
+
+// mapEntry is a header of the entry stored inside an arena,
+// key and value bytes are stored right after the header.
+type mapEntry struct {
+	next     Ptr
+	hash     uint64
+	keyLen   uint32
+	valueLen uint32
+	valueCap uint32
+}
+
+// Map is a hash map that stores all its buckets, overflow chains, keys and values inside the target allocator.
+//
+// It is implemented on top of the linear hashing algorithm, so it grows by splitting one bucket at a time
+// and never performs the full rehash of all entries. Split entries are relinked between overflow chains,
+// without copying of keys and values.
+//
+// arena.Map operates with keys and values as byte slices and copies them inside the target allocator,
+// so it can be used with arena.Bytes converted by arena.BytesView.BytesToRef or with fixed-size keys
+// represented as bytes.
+//
+// All internal references are arena.Ptr values, so the GC doesn't scan the map content.
+// As with arena.Ptr, if you call Clear on the target allocator, the map becomes invalid
+// and any subsequent call to its methods panics.
+//
+// Map isn't safe for concurrent use.
+type Map struct {
+	alloc    mapAllocator
+	segments []Ptr
+
+	seed      uint64
+	len       int
+	levelSize int
+	split     int
+}
+
+// NewMap creates an instance of arena.Map on top of the target allocator
+// and allocates its initial buckets inside this allocator.
+//
+// It can return arena.AllocationLimitError if initial buckets can't be allocated.
+func NewMap(alloc mapAllocator) (*Map, error) {
+	if alloc == nil {
+		alloc = &GenericAllocator{}
+	}
+	result := &Map{
+		alloc:     alloc,
+		seed:      rand.Uint64(),
+		levelSize: mapInitialBucketsCount,
+	}
+	allocErr := result.allocateSegment()
+	if allocErr != nil {
+		return nil, allocErr
+	}
+	return result, nil
+}
+
+// Len returns the number of entries stored in the map. Direct analog of len(map).
+func (m *Map) Len() int {
+	return m.len
+}
+
+// Get returns the value stored for the specified key.
+//
+// The result slice aliases the memory of the target allocator,
+// so it is valid only until the next modification of this key or the target allocator Clear.
+func (m *Map) Get(key []byte) ([]byte, bool) {
+	hash := m.hash(key)
+	bucket := m.bucket(m.bucketIdx(hash))
+	_, entryPtr, found := m.find(bucket, hash, key)
+	if !found {
+		return nil, false
+	}
+	return m.entryValue(entryPtr), true
+}
+
+// Put copies the key and the value inside the target allocator and stores them in the map.
+//
+// If the key is already present and the new value fits into the previously allocated space,
+// the value is overwritten in place, otherwise a new entry is allocated.
+//
+// Put can return arena.AllocationLimitError if the target allocator can't afford the new entry,
+// in this case the map stays unchanged.
+func (m *Map) Put(key []byte, value []byte) error {
+	if uint64(len(key)) > math.MaxUint32 || uint64(len(value)) > math.MaxUint32 {
+		return AllocationInvalidArgumentError
+	}
+	hash := m.hash(key)
+	bucket := m.bucket(m.bucketIdx(hash))
+	prevPtr, entryPtr, found := m.find(bucket, hash, key)
+	if found {
+		entry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+		if uint32(len(value)) <= entry.valueCap {
+			entry.valueLen = uint32(len(value))
+			copy(m.entryValue(entryPtr), value)
+			return nil
+		}
+	}
+
+	newEntryPtr, allocErr := m.allocateEntry(hash, key, value)
+	if allocErr != nil {
+		return allocErr
+	}
+	if found {
+		m.replace(bucket, prevPtr, entryPtr, newEntryPtr)
+		return nil
+	}
+
+	newEntry := (*mapEntry)(m.alloc.ToRef(newEntryPtr))
+	newEntry.next = bucket.head
+	bucket.head = newEntryPtr
+	bucket.size++
+	m.len++
+
+	if m.len > mapMaxLoadFactor*m.bucketsCount() {
+		// split is an optimization, so the map stays consistent even if we can't afford a new segment,
+		// in such case we will try to split this bucket again during the next Put
+		_ = m.splitNext()
+	}
+	return nil
+}
+
+// Delete removes the key from the map and reports whether it was present.
+//
+// Memory occupied by the deleted entry isn't reused until the target allocator Clear.
+func (m *Map) Delete(key []byte) bool {
+	hash := m.hash(key)
+	bucket := m.bucket(m.bucketIdx(hash))
+	prevPtr, entryPtr, found := m.find(bucket, hash, key)
+	if !found {
+		return false
+	}
+	m.unlink(bucket, prevPtr, entryPtr)
+	m.len--
+	return true
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Passed slices alias the memory of the target allocator,
+// and the map shouldn't be modified during the iteration.
+func (m *Map) Range(f func(key []byte, value []byte) bool) {
+	for i := 0; i < m.bucketsCount(); i++ {
+		bucket := m.bucket(i)
+		entryPtr := bucket.head
+		for j := uint32(0); j < bucket.size; j++ {
+			entry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+			if !f(m.entryKey(entryPtr), m.entryValue(entryPtr)) {
+				return
+			}
+			entryPtr = entry.next
+		}
+	}
+}
+
+// String provides a string snapshot of the current map state.
+func (m *Map) String() string {
+	return fmt.Sprintf("arenamap{len: %v buckets: %v}", m.len, m.bucketsCount())
+}
+
+func (m *Map) bucketsCount() int {
+	return m.levelSize + m.split
+}
+
+func (m *Map) bucketIdx(hash uint64) int {
+	idx := hash & uint64(m.levelSize-1)
+	if int(idx) < m.split {
+		idx = hash & uint64(2*m.levelSize-1)
+	}
+	return int(idx)
+}
+
+func (m *Map) bucket(idx int) *mapBucket {
+	segment := (*[mapSegmentSize]mapBucket)(m.alloc.ToRef(m.segments[idx/mapSegmentSize]))
+	return &segment[idx%mapSegmentSize]
+}
+
+func (m *Map) find(bucket *mapBucket, hash uint64, key []byte) (Ptr, Ptr, bool) {
+	prevPtr := Ptr{}
+	entryPtr := bucket.head
+	for i := uint32(0); i < bucket.size; i++ {
+		entry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+		if entry.hash == hash && int(entry.keyLen) == len(key) && bytes.Equal(m.entryKey(entryPtr), key) {
+			return prevPtr, entryPtr, true
+		}
+		prevPtr = entryPtr
+		entryPtr = entry.next
+	}
+	return Ptr{}, Ptr{}, false
+}
+
+func (m *Map) replace(bucket *mapBucket, prevPtr Ptr, oldPtr Ptr, newPtr Ptr) {
+	oldEntry := (*mapEntry)(m.alloc.ToRef(oldPtr))
+	newEntry := (*mapEntry)(m.alloc.ToRef(newPtr))
+	newEntry.next = oldEntry.next
+	if bucket.head == oldPtr {
+		bucket.head = newPtr
+		return
+	}
+	prevEntry := (*mapEntry)(m.alloc.ToRef(prevPtr))
+	prevEntry.next = newPtr
+}
+
+func (m *Map) unlink(bucket *mapBucket, prevPtr Ptr, entryPtr Ptr) {
+	entry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+	bucket.size--
+	if bucket.head == entryPtr {
+		bucket.head = entry.next
+		return
+	}
+	prevEntry := (*mapEntry)(m.alloc.ToRef(prevPtr))
+	prevEntry.next = entry.next
+}
+
+func (m *Map) splitNext() error {
+	newIdx := m.levelSize + m.split
+	if newIdx/mapSegmentSize >= len(m.segments) {
+		allocErr := m.allocateSegment()
+		if allocErr != nil {
+			return allocErr
+		}
+	}
+	oldBucket := m.bucket(m.split)
+	newBucket := m.bucket(newIdx)
+	mask := uint64(2*m.levelSize - 1)
+
+	entryPtr := oldBucket.head
+	chainSize := oldBucket.size
+	*oldBucket = mapBucket{}
+	for i := uint32(0); i < chainSize; i++ {
+		entry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+		nextPtr := entry.next
+		target := oldBucket
+		if int(entry.hash&mask) == newIdx {
+			target = newBucket
+		}
+		entry.next = target.head
+		target.head = entryPtr
+		target.size++
+		entryPtr = nextPtr
+	}
+
+	m.split++
+	if m.split == m.levelSize {
+		m.levelSize *= 2
+		m.split = 0
+	}
+	return nil
+}
+
+func (m *Map) allocateSegment() error {
+	var bucket mapBucket
+	segmentPtr, allocErr := m.alloc.Alloc(mapSegmentSize*unsafe.Sizeof(bucket), unsafe.Alignof(bucket))
+	if allocErr != nil {
+		return allocErr
+	}
+	m.segments = append(m.segments, segmentPtr)
+	return nil
+}
+
+func (m *Map) allocateEntry(hash uint64, key []byte, value []byte) (Ptr, error) {
+	var entry mapEntry
+	entrySize := unsafe.Sizeof(entry) + uintptr(len(key)) + uintptr(len(value))
+	entryPtr, allocErr := m.alloc.Alloc(entrySize, unsafe.Alignof(entry))
+	if allocErr != nil {
+		return Ptr{}, allocErr
+	}
+	newEntry := (*mapEntry)(m.alloc.ToRef(entryPtr))
+	*newEntry = mapEntry{
+		hash:     hash,
+		keyLen:   uint32(len(key)),
+		valueLen: uint32(len(value)),
+		valueCap: uint32(len(value)),
+	}
+	copy(m.entryKey(entryPtr), key)
+	copy(m.entryValue(entryPtr), value)
+	return entryPtr, nil
+}
+
+func (m *Map) entryKey(entryPtr Ptr) []byte {
+	ref := m.alloc.ToRef(entryPtr)
+	entry := (*mapEntry)(ref)
+	sliceHdr := sliceHeader{
+		Data: uintptr(ref) + unsafe.Sizeof(*entry),
+		Len:  int(entry.keyLen),
+		Cap:  int(entry.keyLen),
+	}
+	return *(*[]byte)(unsafe.Pointer(&sliceHdr))
+}
+
+func (m *Map) entryValue(entryPtr Ptr) []byte {
+	ref := m.alloc.ToRef(entryPtr)
+	entry := (*mapEntry)(ref)
+	sliceHdr := sliceHeader{
+		Data: uintptr(ref) + unsafe.Sizeof(*entry) + uintptr(entry.keyLen),
+		Len:  int(entry.valueLen),
+		Cap:  int(entry.valueCap),
+	}
+	return *(*[]byte)(unsafe.Pointer(&sliceHdr))
+}
+
+// hash is a seeded FNV-1a with the additional finalization step,
+// because linear hashing relies on the lowest bits of the hash.
+func (m *Map) hash(key []byte) uint64 {
+	const offsetBasis = 14695981039346656037
+	const prime = 1099511628211
+	h := uint64(offsetBasis) ^ m.seed
+	for _, b := range key {
+		h ^= uint64(b)
+		h *= prime
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
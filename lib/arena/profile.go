@@ -0,0 +1,200 @@
+package arena
+
+import (
+	"compress/gzip"
+	"io"
+	"runtime"
+	"time"
+)
+
+// field numbers of the pprof protocol buffer messages,
+// for details please refer to https://github.com/google/pprof/blob/master/proto/profile.proto
+const (
+	profileSampleTypeField        = 1
+	profileSampleField            = 2
+	profileLocationField          = 4
+	profileFunctionField          = 5
+	profileStringTableField       = 6
+	profileTimeNanosField         = 9
+	profilePeriodTypeField        = 11
+	profilePeriodField            = 12
+	profileDefaultSampleTypeField = 14
+
+	valueTypeTypeField = 1
+	valueTypeUnitField = 2
+
+	sampleLocationIDField = 1
+	sampleValueField      = 2
+
+	locationIDField      = 1
+	locationAddressField = 3
+	locationLineField    = 4
+
+	lineFunctionIDField = 1
+	lineLineField       = 2
+
+	functionIDField         = 1
+	functionNameField       = 2
+	functionSystemNameField = 3
+	functionFilenameField   = 4
+)
+
+// protoBuffer is a minimal protocol buffer encoder,
+// sufficient to write the pprof profile without additional dependencies.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protoBuffer) uint64Field(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64Field(field int, x int64) {
+	b.uint64Field(field, uint64(x))
+}
+
+func (b *protoBuffer) bytesField(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) packedUint64Field(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytesField(field, packed.data)
+}
+
+type functionKey struct {
+	name string
+	file string
+}
+
+type profileBuilder struct {
+	result      protoBuffer
+	strings     map[string]int64
+	functions   map[functionKey]uint64
+	locations   map[uintptr]uint64
+	stringTable []string
+}
+
+func writeAllocationProfile(w io.Writer, sites []AllocationSite) error {
+	b := &profileBuilder{
+		strings:   make(map[string]int64),
+		functions: make(map[functionKey]uint64),
+		locations: make(map[uintptr]uint64),
+	}
+	b.string("")
+
+	b.valueType(profileSampleTypeField, "alloc_objects", "count")
+	b.valueType(profileSampleTypeField, "alloc_space", "bytes")
+	b.valueType(profileSampleTypeField, "padding_space", "bytes")
+	for _, site := range sites {
+		locationIDs := make([]uint64, 0, len(site.Stack))
+		for _, pc := range site.Stack {
+			locationIDs = append(locationIDs, b.location(pc))
+		}
+		var sample protoBuffer
+		sample.packedUint64Field(sampleLocationIDField, locationIDs)
+		sample.packedUint64Field(sampleValueField, []uint64{
+			uint64(site.CountOfAllocations), uint64(site.DataBytes), uint64(site.PaddingOverhead),
+		})
+		b.result.bytesField(profileSampleField, sample.data)
+	}
+	b.result.int64Field(profileTimeNanosField, time.Now().UnixNano())
+	b.valueType(profilePeriodTypeField, "space", "bytes")
+	b.result.int64Field(profilePeriodField, 1)
+	b.result.int64Field(profileDefaultSampleTypeField, b.string("alloc_space"))
+	for _, s := range b.stringTable {
+		b.result.bytesField(profileStringTableField, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	_, writeErr := zw.Write(b.result.data)
+	if writeErr != nil {
+		return writeErr
+	}
+	return zw.Close()
+}
+
+func (b *profileBuilder) string(s string) int64 {
+	idx, ok := b.strings[s]
+	if ok {
+		return idx
+	}
+	idx = int64(len(b.stringTable))
+	b.strings[s] = idx
+	b.stringTable = append(b.stringTable, s)
+	return idx
+}
+
+func (b *profileBuilder) valueType(field int, typeName string, unit string) {
+	var valueType protoBuffer
+	valueType.int64Field(valueTypeTypeField, b.string(typeName))
+	valueType.int64Field(valueTypeUnitField, b.string(unit))
+	b.result.bytesField(field, valueType.data)
+}
+
+func (b *profileBuilder) location(pc uintptr) uint64 {
+	id, ok := b.locations[pc]
+	if ok {
+		return id
+	}
+	id = uint64(len(b.locations) + 1)
+	b.locations[pc] = id
+
+	var location protoBuffer
+	location.uint64Field(locationIDField, id)
+	location.uint64Field(locationAddressField, uint64(pc))
+	// frames are returned from the innermost inlined function to the outermost one,
+	// the same order is expected by pprof for Location.line
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		frame, more := frames.Next()
+		var line protoBuffer
+		line.uint64Field(lineFunctionIDField, b.function(frame.Function, frame.File))
+		line.int64Field(lineLineField, int64(frame.Line))
+		location.bytesField(locationLineField, line.data)
+		if !more {
+			break
+		}
+	}
+	b.result.bytesField(profileLocationField, location.data)
+	return id
+}
+
+func (b *profileBuilder) function(name string, file string) uint64 {
+	key := functionKey{name: name, file: file}
+	id, ok := b.functions[key]
+	if ok {
+		return id
+	}
+	id = uint64(len(b.functions) + 1)
+	b.functions[key] = id
+
+	var function protoBuffer
+	function.uint64Field(functionIDField, id)
+	function.int64Field(functionNameField, b.string(name))
+	function.int64Field(functionSystemNameField, b.string(name))
+	function.int64Field(functionFilenameField, b.string(file))
+	b.result.bytesField(profileFunctionField, function.data)
+	return id
+}
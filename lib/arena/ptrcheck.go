@@ -0,0 +1,64 @@
+//go:build !arenachecked && !arenadebug
+// +build !arenachecked,!arenadebug
+
+package arena
+
+// checkedPtrMode is enabled only by `arenachecked` or `arenadebug` build tags,
+// please refer to ptrcheck_checked.go for details.
+const checkedPtrMode = false
+
+// ptrCheck is empty in the default mode, so it doesn't change the size of arena.Ptr,
+// and its comparisons are eliminated by the compiler.
+type ptrCheck struct{}
+
+func newAllocatorID() uint32 {
+	return 0
+}
+
+func makePtrCheck(allocatorID uint32, generation uint64) ptrCheck {
+	return ptrCheck{}
+}
+
+func newPtrCheck() ptrCheck {
+	return ptrCheck{}
+}
+
+func (c ptrCheck) next() ptrCheck {
+	return c
+}
+
+func (c ptrCheck) parts() (uint32, uint64) {
+	return 0, 0
+}
+
+func (c ptrCheck) String() string {
+	return ""
+}
+
+// ptrCheckHistory is empty in the default mode, so values allocated after a checkpoint
+// can't be distinguished from the ones allocated before it.
+type ptrCheckHistory struct{}
+
+func (h *ptrCheckHistory) checkpoint() {}
+
+func (h *ptrCheckHistory) next(current ptrCheck) ptrCheck {
+	return current
+}
+
+func (h *ptrCheckHistory) accepts(current ptrCheck, c ptrCheck) bool {
+	return true
+}
+
+func (h *ptrCheckHistory) resetTo(checkpoint ptrCheck) ptrCheck {
+	return checkpoint
+}
+
+func (h *ptrCheckHistory) restart(current ptrCheck) ptrCheck {
+	return current
+}
+
+func (h *ptrCheckHistory) writeTo(d *dumpWriter) {}
+
+func (h *ptrCheckHistory) readFrom(d *dumpReader, current ptrCheck) bool {
+	return true
+}
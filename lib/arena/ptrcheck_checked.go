@@ -0,0 +1,173 @@
+//go:build arenachecked || arenadebug
+// +build arenachecked arenadebug
+
+package arena
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// checkedPtrMode enables debug mode that guarantees detection of foreign and stale arena.Ptr values.
+//
+// By default, arena.Ptr carries only the 16-bit arena mask, that is randomly initialized and changed on Clear,
+// so after enough Clear calls, or with two arenas that got the same random mask,
+// ToRef can silently accept arena.Ptr that wasn't allocated by the current generation of the allocator.
+//
+// In this mode, arena.Ptr also carries the unique identity of the allocator and the 64-bit generation,
+// that is incremented on each Clear, so such arena.Ptr values are always rejected.
+// Allocations after CurrentOffset also start a new generation, so ResetTo rejects arena.Ptr values
+// allocated after the checkpoint, even if the same memory is allocated again.
+// It makes arena.Ptr 8 bytes bigger and adds one more comparison to each ToRef call,
+// so it is intended only for tests and debugging. Please refer to BenchmarkToRef to estimate its cost.
+// It can be enabled with `-tags arenachecked` build flag, and it is also enabled by `arenadebug` build tag.
+const checkedPtrMode = true
+
+// lastAllocatorID is the only global state of this package,
+// it is required to give each allocator the identity that isn't shared with any other allocator,
+// so it is excluded from gochecknoglobals linter.
+var lastAllocatorID uint32
+
+type ptrCheck struct {
+	allocatorID uint32
+	generation  uint64
+}
+
+func newAllocatorID() uint32 {
+	return atomic.AddUint32(&lastAllocatorID, 1)
+}
+
+func makePtrCheck(allocatorID uint32, generation uint64) ptrCheck {
+	return ptrCheck{allocatorID: allocatorID, generation: generation}
+}
+
+func newPtrCheck() ptrCheck {
+	return makePtrCheck(newAllocatorID(), 1)
+}
+
+func (c ptrCheck) next() ptrCheck {
+	c.generation++
+	return c
+}
+
+func (c ptrCheck) parts() (uint32, uint64) {
+	return c.allocatorID, c.generation
+}
+
+func (c ptrCheck) String() string {
+	return fmt.Sprintf(" allocator: %v generation: %v", c.allocatorID, c.generation)
+}
+
+// ptrCheckHistory allows ResetTo to reject arena.Ptr values allocated after the checkpoint,
+// while values allocated before it stay valid.
+//
+// CurrentOffset marks the current generation as a checkpoint, so the next allocation starts a new generation,
+// and ResetTo drops all generations started after the checkpoint and makes the checkpoint generation current again.
+// Previous generations that are still valid are kept as sorted ranges, and consecutive generations are merged,
+// so the history grows only with the depth of nested checkpoints that were rewound.
+type ptrCheckHistory struct {
+	ranges         []generationRange
+	lastGeneration uint64
+	checkpointed   bool
+}
+
+type generationRange struct {
+	first uint64
+	last  uint64
+}
+
+// checkpoint makes the next allocation start a new generation.
+func (h *ptrCheckHistory) checkpoint() {
+	h.checkpointed = true
+}
+
+// next returns the check of the next allocation.
+func (h *ptrCheckHistory) next(current ptrCheck) ptrCheck {
+	if !h.checkpointed {
+		return current
+	}
+	h.checkpointed = false
+	if n := len(h.ranges); n > 0 && h.ranges[n-1].last+1 == current.generation {
+		h.ranges[n-1].last = current.generation
+	} else {
+		h.ranges = append(h.ranges, generationRange{first: current.generation, last: current.generation})
+	}
+	h.lastGeneration = maxGeneration(h.lastGeneration, current.generation) + 1
+	return makePtrCheck(current.allocatorID, h.lastGeneration)
+}
+
+// accepts reports whether c belongs to the current or to a previous generation that is still valid.
+func (h *ptrCheckHistory) accepts(current ptrCheck, c ptrCheck) bool {
+	if c == current {
+		return true
+	}
+	if c.allocatorID != current.allocatorID {
+		return false
+	}
+	for i := len(h.ranges) - 1; i >= 0 && c.generation >= h.ranges[i].first; i-- {
+		if c.generation <= h.ranges[i].last {
+			return true
+		}
+	}
+	return false
+}
+
+// resetTo drops all generations started after the accepted checkpoint and returns its check as the current one.
+func (h *ptrCheckHistory) resetTo(checkpoint ptrCheck) ptrCheck {
+	i := len(h.ranges)
+	for i > 0 && h.ranges[i-1].first >= checkpoint.generation {
+		i--
+	}
+	h.ranges = h.ranges[:i]
+	if i > 0 && h.ranges[i-1].last >= checkpoint.generation {
+		h.ranges[i-1].last = checkpoint.generation - 1
+	}
+	h.checkpointed = true
+	return checkpoint
+}
+
+// restart drops all previous generations and returns the check of a new generation,
+// that wasn't used even by generations dropped by ResetTo.
+func (h *ptrCheckHistory) restart(current ptrCheck) ptrCheck {
+	h.ranges = nil
+	h.checkpointed = false
+	h.lastGeneration = maxGeneration(h.lastGeneration, current.generation) + 1
+	return makePtrCheck(current.allocatorID, h.lastGeneration)
+}
+
+func (h *ptrCheckHistory) writeTo(d *dumpWriter) {
+	d.uint64(h.lastGeneration)
+	d.uint16(uint16(len(h.ranges)))
+	for _, r := range h.ranges {
+		d.uint64(r.first)
+		d.uint64(r.last)
+	}
+}
+
+// readFrom restores the history written by writeTo and reports whether it is consistent with the current check.
+func (h *ptrCheckHistory) readFrom(d *dumpReader, current ptrCheck) bool {
+	h.lastGeneration = maxGeneration(d.uint64(), current.generation)
+	count := int(d.uint16())
+	ranges := make([]generationRange, 0, min(count, 64))
+	for i := 0; i < count && d.err == nil; i++ {
+		r := generationRange{first: d.uint64(), last: d.uint64()}
+		if d.err != nil {
+			break
+		}
+		if r.first > r.last || r.last >= current.generation || (len(ranges) > 0 && r.first <= ranges[len(ranges)-1].last) {
+			return false
+		}
+		ranges = append(ranges, r)
+	}
+	h.ranges = ranges
+	// values allocated after the load start a new generation, since the dumped allocator could be rewound
+	h.checkpointed = true
+	return true
+}
+
+func maxGeneration(a uint64, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -23,12 +23,23 @@ type RawAllocator struct {
 	startPtr unsafe.Pointer // strong reference to actual byte slice
 	endPtr   uintptr
 	offset   uintptr
+	dirtyIdx uintptr // end of the region rewound without zeroing, so it can contain stale data
+	mmapped  bool    // buffer is allocated outside of the Go heap by NewMmapRawAllocator
+}
+
+// MmapOptions is a structure used to configure arena.RawAllocator created by NewMmapRawAllocator.
+//
+// You can configure:
+//  - HugePages - advise the kernel to back the buffer with transparent huge pages,
+//    it is only a hint, so it is ignored if the kernel doesn't support it.
+type MmapOptions struct {
+	HugePages bool
 }
 
 // NewRawAllocator creates an instance of arena.RawAllocator
 // and allocates the whole it's underlying buffer from the heap in advance.
 func NewRawAllocator(size uint32) *RawAllocator {
-	bytes := make([]byte, int(size))
+	bytes := allocateRawBuffer(int(size))
 	startPtr := unsafe.Pointer(&bytes[0])
 	return &RawAllocator{
 		startPtr: startPtr,
@@ -42,9 +53,40 @@ func NewRawAllocator(size uint32) *RawAllocator {
 // This method will figure-out size that will be >= size and will enable certain
 // underlying optimizations like vectorized Clear operation.
 func NewRawAllocatorWithOptimalSize(size uint32) *RawAllocator {
+	return NewRawAllocator(optimalRawAllocatorSize(size))
+}
+
+// NewMmapRawAllocator creates an instance of arena.RawAllocator
+// with underlying buffer allocated directly from the OS by mmap, outside of the Go heap.
+//
+// Such buffer isn't owned, sized, or scanned by the GC and doesn't count toward the GOGC heap target,
+// so it is a good fit for large and long-living arenas.
+// Memory of the buffer is returned to the OS by RawAllocator.Release or by Clear of large used regions,
+// but never by the GC, so please don't forget to Release such allocators.
+//
+// NewMmapRawAllocator is supported only on Linux,
+// on other platforms it returns arena.UnsupportedPlatformError.
+func NewMmapRawAllocator(size uint32, opts MmapOptions) (*RawAllocator, error) {
+	if size == 0 {
+		return nil, AllocationInvalidArgumentError
+	}
+	bytes, mmapErr := mmapRawBuffer(int(size), opts.HugePages)
+	if mmapErr != nil {
+		return nil, mmapErr
+	}
+	startPtr := unsafe.Pointer(&bytes[0])
+	return &RawAllocator{
+		startPtr: startPtr,
+		endPtr:   uintptr(unsafe.Pointer(&bytes[size-1])),
+		offset:   uintptr(startPtr),
+		mmapped:  true,
+	}, nil
+}
+
+func optimalRawAllocatorSize(size uint32) uint32 {
 	targetSize := uintptr(max(int(size), int(minInternalBufferSize)))
 	additionalPadding := calculatePadding(targetSize, minInternalBufferSize)
-	return NewRawAllocator(uint32(targetSize + additionalPadding))
+	return uint32(targetSize + additionalPadding)
 }
 
 // AllocUnaligned performs allocation within an underlying buffer, but without automatic alignment.
@@ -107,6 +149,60 @@ func (a *RawAllocator) Alloc(size uintptr, alignment uintptr) (Ptr, error) {
 	return result, nil
 }
 
+// AllocRange performs allocation of at least minSize and at most preferredSize bytes within an underlying buffer.
+//
+// It returns arena.Ptr value and the actual size granted for this allocation.
+// If preferredSize can't be fitted into the current buffer, the rest of the buffer will be granted,
+// so the resulting size is always between minSize and preferredSize.
+//
+// minSize - should be less than or equal to preferredSize
+// alignment - should be a power of 2 number and can't be 0
+// Important: this is a raw arena, it will not check violations of this contract.
+// Any violations will lead to unpredictable behavior
+//
+// AllocRange can return arena.AllocationLimitError if even minSize
+// can't be fitted into the current buffer.
+func (a *RawAllocator) AllocRange(minSize uintptr, preferredSize uintptr, alignment uintptr) (Ptr, uintptr, error) {
+	paddingSize := calculatePadding(a.offset, alignment)
+	if a.offset+minSize+paddingSize > a.endPtr {
+		return Ptr{}, 0, AllocationLimitError
+	}
+	size := preferredSize
+	if a.offset+size+paddingSize > a.endPtr {
+		size = a.endPtr - a.offset - paddingSize
+	}
+	a.offset += paddingSize
+	result := Ptr{offset: a.offset}
+	a.offset += size
+	return result, size, nil
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// If the value is the last allocation in the underlying buffer, it is extended in place
+// and the same arena.Ptr is returned. Otherwise, newSize bytes are allocated
+// and the value is copied there, but the previous value is left untouched.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// alignment - should be a power of 2 number and can't be 0
+// Important: this is a raw arena, it will not check violations of this contract.
+// Any violations will lead to unpredictable behavior
+//
+// Realloc can return arena.AllocationLimitError if newSize can't be fitted into the current buffer.
+func (a *RawAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	if newSize <= oldSize {
+		return p, nil
+	}
+	if oldSize > 0 && p.offset+oldSize == a.offset && p.offset&(alignment-1) == 0 {
+		if p.offset+newSize > a.endPtr {
+			return Ptr{}, AllocationLimitError
+		}
+		a.offset = p.offset + newSize
+		return p, nil
+	}
+	return reallocByCopy(a, p, oldSize, newSize, alignment)
+}
+
 // ToRef converts arena.Ptr to unsafe.Pointer.
 //
 // UNSAFE CAUTION This method doesn't perform bounds check. CAUTION UNSAFE
@@ -120,7 +216,7 @@ func (a *RawAllocator) Alloc(size uintptr, alignment uintptr) (Ptr, error) {
 // and potentially prevent it's escaping to the heap.
 //go:nocheckptr
 func (a *RawAllocator) ToRef(p Ptr) unsafe.Pointer {
-	return unsafe.Pointer(p.offset)
+	return addressToRef(p.offset)
 }
 
 // CurrentOffset returns the current allocation offset.
@@ -135,26 +231,89 @@ func (a *RawAllocator) CurrentOffset() Offset {
 // that was allocated before the call to Clear method.
 // To avoid such situation please refer to other allocator implementations from this library
 // that provide additional safety checks.
+//
+// If the allocator is created by NewMmapRawAllocator and used region is large enough,
+// its pages are returned to the OS with MADV_DONTNEED instead of filling with zeros,
+// and they are transparently zero-filled by the kernel on the next access.
+//
+// If the library is built with `arenadebug` tag on Linux, the underlying buffer is never reused.
+// Instead, it is protected, so any usage of previously converted values faults immediately,
+// and a new buffer is allocated.
 func (a *RawAllocator) Clear() {
-	sliceHdr := sliceHeader{
-		Data: uintptr(a.startPtr),
-		Len:  a.len(),
-		Cap:  a.len(),
+	if a.startPtr == nil {
+		return
+	}
+	if protectMemoryOnClear {
+		if a.offset != uintptr(a.startPtr) || a.dirtyIdx > 0 {
+			a.protectAndReplaceBuffer()
+		}
+		a.dirtyIdx = 0
+		return
+	}
+	bytesToClear := a.buffer()
+	usedIdx := a.usedIdx()
+	usedBytes := min(int(usedIdx), len(bytesToClear))
+	if a.mmapped && usedBytes > int(minInternalBufferSize) && releaseRawBufferPages(bytesToClear[:usedBytes]) == nil {
+		a.offset = uintptr(a.startPtr)
+		a.dirtyIdx = 0
+		return
 	}
-	bytesToClear := *(*[]byte)(unsafe.Pointer(&sliceHdr))
 	if len(bytesToClear) > 0 {
-		sliceOffset := a.idx()
-		padding := calculatePadding(sliceOffset, minInternalBufferSize)
-		idx := min(int(sliceOffset+padding), len(bytesToClear))
+		padding := calculatePadding(usedIdx, minInternalBufferSize)
+		idx := min(int(usedIdx+padding), len(bytesToClear))
 		bytesToClear = bytesToClear[:idx]
 	}
 	clearBytes(bytesToClear)
 	a.offset = uintptr(a.startPtr)
+	a.dirtyIdx = 0
+}
+
+// ResetTo moves the allocation offset back to the checkpoint previously returned by CurrentOffset
+// and fills with zeros only the region allocated after the checkpoint,
+// so it can be used to free speculative allocations without the full Clear.
+//
+// It can be a potentially unsafe operation if you try to dereference and/or use arena.Ptr
+// that was allocated after the checkpoint, since RawAllocator can't detect such usages.
+//
+// ResetTo returns arena.AllocationInvalidArgumentError if the checkpoint
+// is out of the currently allocated region, for example, if it was taken before Clear or a previous ResetTo.
+func (a *RawAllocator) ResetTo(o Offset) error {
+	if o.p.offset < uintptr(a.startPtr) || o.p.offset > a.offset || a.startPtr == nil {
+		return AllocationInvalidArgumentError
+	}
+	a.resetTo(o.p.offset)
+	return nil
+}
+
+// Release gets rid of the underlying buffer.
+// If the allocator is created by NewMmapRawAllocator, the buffer is returned to the OS immediately,
+// otherwise it is left to the GC.
+//
+// Any subsequent allocation fails with arena.AllocationLimitError.
+// IMPORTANT, all values allocated before Release become invalid, and for mmap-backed allocators
+// any usage of them leads to the segmentation fault, so please make sure that nothing refers them.
+// Release is idempotent.
+func (a *RawAllocator) Release() error {
+	if a.startPtr == nil {
+		return nil
+	}
+	if a.mmapped {
+		unmapErr := unmapRawBuffer(a.buffer())
+		if unmapErr != nil {
+			return unmapErr
+		}
+	}
+	// offset after the end of the buffer fails all subsequent allocations
+	*a = RawAllocator{offset: 1}
+	return nil
 }
 
 // Stats provides a snapshot of essential allocation statistics,
 // that can be used by end-users or other allocators for introspection.
 func (a *RawAllocator) Stats() Stats {
+	if a.startPtr == nil {
+		return Stats{}
+	}
 	return Stats{
 		UsedBytes:                int(a.offset - uintptr(a.startPtr)),
 		AllocatedBytes:           int(a.endPtr-uintptr(a.startPtr)) + 1,
@@ -165,6 +324,9 @@ func (a *RawAllocator) Stats() Stats {
 // Metrics provides a snapshot of current allocation statistics,
 // that can be used by end-users or other allocators for introspection.
 func (a *RawAllocator) Metrics() Metrics {
+	if a.startPtr == nil {
+		return Metrics{}
+	}
 	return Metrics{
 		Stats:          a.Stats(),
 		AvailableBytes: int(a.endPtr - a.offset),
@@ -185,6 +347,41 @@ func (a *RawAllocator) idx() uintptr {
 	return a.offset - uintptr(a.startPtr)
 }
 
+// rewind moves the offset to the start of the buffer without zeroing,
+// and keeps the end of the used region as a dirty mark, so only the part of the buffer below it has to be zeroed on reuse.
+func (a *RawAllocator) rewind() {
+	a.dirtyIdx = a.usedIdx()
+	a.offset = uintptr(a.startPtr)
+}
+
+// usedIdx returns the end of the region that was ever used since the last Clear.
+func (a *RawAllocator) usedIdx() uintptr {
+	if a.dirtyIdx > a.idx() {
+		return a.dirtyIdx
+	}
+	return a.idx()
+}
+
+// resetTo fills with zeros the region between the specified offset and the current one,
+// moves the current offset back and returns the count of released bytes.
+func (a *RawAllocator) resetTo(offset uintptr) int {
+	releasedBytes := int(a.offset - offset)
+	if releasedBytes > 0 {
+		clearBytes(a.buffer()[offset-uintptr(a.startPtr) : a.idx()])
+	}
+	a.offset = offset
+	return releasedBytes
+}
+
+func (a *RawAllocator) buffer() []byte {
+	sliceHdr := sliceHeader{
+		Data: uintptr(a.startPtr),
+		Len:  a.len(),
+		Cap:  a.len(),
+	}
+	return *(*[]byte)(unsafe.Pointer(&sliceHdr))
+}
+
 func (a *RawAllocator) len() int {
 	return int(a.endPtr-uintptr(a.startPtr)) + 1
 }
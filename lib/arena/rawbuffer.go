@@ -0,0 +1,14 @@
+//go:build !arenadebug || !linux
+// +build !arenadebug !linux
+
+package arena
+
+// protectMemoryOnClear is enabled only by `arenadebug` build tag on Linux,
+// please refer to rawbuffer_debug_linux.go for details.
+const protectMemoryOnClear = false
+
+func allocateRawBuffer(size int) []byte {
+	return make([]byte, size)
+}
+
+func (a *RawAllocator) protectAndReplaceBuffer() {}
@@ -0,0 +1,51 @@
+//go:build arenadebug && linux
+// +build arenadebug,linux
+
+package arena
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// protectMemoryOnClear enables debug mode that helps to catch usages of values
+// converted by ToRef, BytesToRef, or BytesToStringRef before the call to Clear.
+//
+// In this mode, underlying buffers of arena.RawAllocator are allocated with mmap,
+// and on Clear they are never reused. Instead, their physical memory is released
+// and the whole buffer is protected with PROT_NONE, so any dereference of a stale pointer, []byte, or string
+// faults immediately with `unexpected fault address` report and the stack trace of the faulty access.
+// Please use debug.SetPanicOnFault if you want to convert such faults into panics.
+//
+// Protected buffers still occupy address space, so this mode is intended only for tests and debugging.
+// It can be enabled with `-tags arenadebug` build flag.
+const protectMemoryOnClear = true
+
+func allocateRawBuffer(size int) []byte {
+	buf, mmapErr := syscall.Mmap(
+		-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if mmapErr != nil {
+		panic(fmt.Errorf("can't mmap arena buffer of size %v: %w", size, mmapErr))
+	}
+	return buf
+}
+
+func (a *RawAllocator) protectAndReplaceBuffer() {
+	buf := a.buffer()
+	adviseErr := syscall.Madvise(buf, syscall.MADV_DONTNEED)
+	if adviseErr != nil {
+		panic(fmt.Errorf("can't release memory of arena buffer: %w", adviseErr))
+	}
+	protectErr := syscall.Mprotect(buf, syscall.PROT_NONE)
+	if protectErr != nil {
+		panic(fmt.Errorf("can't protect arena buffer: %w", protectErr))
+	}
+
+	newBuf := allocateRawBuffer(len(buf))
+	a.startPtr = unsafe.Pointer(&newBuf[0])
+	a.endPtr = uintptr(unsafe.Pointer(&newBuf[len(newBuf)-1]))
+	a.offset = uintptr(a.startPtr)
+}
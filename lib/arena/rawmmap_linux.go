@@ -0,0 +1,59 @@
+//go:build linux
+// +build linux
+
+package arena
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func mmapRawBuffer(size int, hugePages bool) ([]byte, error) {
+	buf, mmapErr := syscall.Mmap(
+		-1, 0, size,
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE,
+	)
+	if mmapErr != nil {
+		return nil, fmt.Errorf("can't mmap arena buffer of size %v: %w", size, mmapErr)
+	}
+	if hugePages {
+		// huge pages are only a hint, so the buffer is still usable if the kernel doesn't support them
+		_ = syscall.Madvise(buf, syscall.MADV_HUGEPAGE)
+	}
+	return buf, nil
+}
+
+func unmapRawBuffer(buf []byte) error {
+	unmapErr := syscall.Munmap(buf)
+	if unmapErr != nil {
+		return fmt.Errorf("can't unmap arena buffer: %w", unmapErr)
+	}
+	return nil
+}
+
+// releaseRawBufferPages returns physical pages of the anonymous private mapping to the OS,
+// and the kernel fills them with zeros on the next access.
+func releaseRawBufferPages(buf []byte) error {
+	return syscall.Madvise(buf, syscall.MADV_DONTNEED)
+}
+
+// reserveAddressSpace reserves the range of virtual address space without access to it,
+// so it doesn't consume physical memory or swap until it is committed.
+func reserveAddressSpace(size int) ([]byte, error) {
+	buf, mmapErr := syscall.Mmap(
+		-1, 0, size,
+		syscall.PROT_NONE, syscall.MAP_ANON|syscall.MAP_PRIVATE|syscall.MAP_NORESERVE,
+	)
+	if mmapErr != nil {
+		return nil, fmt.Errorf("can't reserve address space of size %v: %w", size, mmapErr)
+	}
+	return buf, nil
+}
+
+func commitAddressSpace(buf []byte) error {
+	protectErr := syscall.Mprotect(buf, syscall.PROT_READ|syscall.PROT_WRITE)
+	if protectErr != nil {
+		return fmt.Errorf("can't commit address space: %w", protectErr)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package arena
+
+func mmapRawBuffer(int, bool) ([]byte, error) {
+	return nil, UnsupportedPlatformError
+}
+
+func unmapRawBuffer([]byte) error {
+	return UnsupportedPlatformError
+}
+
+func releaseRawBufferPages([]byte) error {
+	return UnsupportedPlatformError
+}
+
+func reserveAddressSpace(int) ([]byte, error) {
+	return nil, UnsupportedPlatformError
+}
+
+func commitAddressSpace([]byte) error {
+	return UnsupportedPlatformError
+}
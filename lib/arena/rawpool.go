@@ -0,0 +1,75 @@
+package arena
+
+import (
+	"sync"
+)
+
+// RawAllocatorPool is a thread-safe pool of clear raw arenas
+// that can be shared between multiple arena.DynamicAllocator instances.
+//
+// arena.DynamicAllocator created by NewDynamicAllocatorWithPool takes buffers from the pool
+// before allocating new ones from the heap and returns all its buffers to the pool on Close,
+// so short-lived allocators, like the ones created per request, can reuse memory
+// without additional pressure on the GC.
+type RawAllocatorPool struct {
+	mu             sync.Mutex
+	arenas         minHeapOfClearArenas
+	pooledBytes    int
+	maxPooledBytes int
+}
+
+// NewRawAllocatorPool creates an instance of arena.RawAllocatorPool.
+//
+// maxPooledBytes is an upper limit of bytes retained by the pool,
+// buffers that don't fit into this limit are left to the GC.
+// If maxPooledBytes is 0, the pool is unbounded.
+func NewRawAllocatorPool(maxPooledBytes int) *RawAllocatorPool {
+	return &RawAllocatorPool{maxPooledBytes: maxPooledBytes}
+}
+
+// CountOfArenas returns the count of buffers currently retained by the pool.
+func (p *RawAllocatorPool) CountOfArenas() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.arenas.heap)
+}
+
+// PooledBytes returns the count of bytes currently retained by the pool.
+func (p *RawAllocatorPool) PooledBytes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pooledBytes
+}
+
+func (p *RawAllocatorPool) put(arena RawAllocator) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.maxPooledBytes > 0 && p.pooledBytes+arena.len() > p.maxPooledBytes {
+		return
+	}
+	p.arenas.Push(arena, 0)
+	p.pooledBytes += arena.len()
+}
+
+func (p *RawAllocatorPool) get(size int) (RawAllocator, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var tooSmallArenas []RawAllocator
+	defer func() {
+		for _, ar := range tooSmallArenas {
+			p.arenas.Push(ar, 0)
+		}
+	}()
+	for {
+		candidate, ok := p.arenas.Pop()
+		if !ok {
+			return RawAllocator{}, false
+		}
+		if candidate.len() < size {
+			tooSmallArenas = append(tooSmallArenas, candidate)
+			continue
+		}
+		p.pooledBytes -= candidate.len()
+		return candidate, true
+	}
+}
@@ -0,0 +1,233 @@
+package arena
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// RegistryOptions is a structure used to configure arena.Registry.
+//
+// You can configure:
+//  - AllocationLimitInBytes - upper limit for the sum of AllocatedBytes of all registry allocators,
+//    if not specified, the registry has no limit and is used only to collect metrics.
+type RegistryOptions struct {
+	AllocationLimitInBytes uint64
+}
+
+// AllocatorMetrics is a snapshot of metrics of one allocator issued by arena.Registry.
+type AllocatorMetrics struct {
+	Metrics
+	Name string // name specified during allocator creation
+}
+
+// Registry is a thread-safe issuer of arena.GenericAllocator instances
+// that share one process-wide budget of arena memory.
+//
+// The registry tracks the sum of AllocatedBytes of all its allocators atomically,
+// so allocators can be used concurrently by different goroutines.
+// If any allocator needs to grow beyond the registry budget,
+// the allocation fails with arena.AllocationLimitError.
+//
+// Budget taken by the allocator is returned to the registry on Close,
+// or when the allocator is garbage collected, so please Close allocators as soon as you don't need them.
+//
+// Registry can also maintain named pools of pre-warmed allocators, please refer to arena.ArenaPool for details.
+type Registry struct {
+	allocatedBytes int64
+	limitInBytes   int64
+
+	mu      sync.Mutex
+	members map[*registryMember]struct{}
+	pools   map[string]*ArenaPool
+}
+
+// NewRegistry creates an instance of arena.Registry configured by RegistryOptions.
+func NewRegistry(opts RegistryOptions) *Registry {
+	if opts.AllocationLimitInBytes > uint64(math.MaxInt64) {
+		panic("AllocationLimitInBytes is too large")
+	}
+	return &Registry{
+		limitInBytes: int64(opts.AllocationLimitInBytes),
+		members:      make(map[*registryMember]struct{}),
+		pools:        make(map[string]*ArenaPool),
+	}
+}
+
+// NewAllocator creates an instance of the arena.GenericAllocator configured by Options
+// that takes its memory from the registry budget.
+//
+// Issued allocator owns its underlying arena.DynamicAllocator,
+// so DelegateClearToUnderlyingAllocator option is always enabled
+// and Clear keeps already allocated buffers for future use.
+// Name is used only to distinguish allocators in arena.Registry.AllocatorsMetrics.
+func (r *Registry) NewAllocator(name string, opts Options) *GenericAllocator {
+	member := &registryMember{registry: r, name: name}
+	target := r.newDynamicAllocator(member)
+	target.configure(DynamicOptions{
+		CapacityLimitInBytes: opts.CapacityLimitInBytes,
+		GrowthStrategy:       opts.GrowthStrategy,
+		RetentionPolicy:      opts.RetentionPolicy,
+		BackgroundZeroer:     opts.BackgroundZeroer,
+		ZeroOnAlloc:          opts.ZeroOnAlloc,
+	})
+	if opts.InitialCapacity > 0 {
+		target.grow(int(opts.InitialCapacity))
+	}
+
+	opts.DelegateClearToUnderlyingAllocator = true
+	result := NewSubAllocator(target, opts)
+	result.ownsTarget = true
+	result.registryMember = member
+	result.allocatedBytes += target.allocatedBytes
+	return result
+}
+
+// Pool returns the arena.ArenaPool registered under the specified name,
+// or creates a new one if there is no such pool yet.
+func (r *Registry) Pool(name string) *ArenaPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pool, ok := r.pools[name]
+	if !ok {
+		pool = &ArenaPool{registry: r, name: name}
+		r.pools[name] = pool
+	}
+	return pool
+}
+
+// PoolFor returns the arena.ArenaPool dedicated to the type of the specified value,
+// so values of the same type, like generated views, share one pool.
+// For example, registry.PoolFor(PointView{}) returns the pool named after the PointView type.
+func (r *Registry) PoolFor(v interface{}) *ArenaPool {
+	return r.Pool(fmt.Sprintf("%T", v))
+}
+
+// PoolsStats provides a snapshot of statistics of every registry pool sorted by name.
+func (r *Registry) PoolsStats() []ArenaPoolStats {
+	r.mu.Lock()
+	pools := make([]*ArenaPool, 0, len(r.pools))
+	for _, pool := range r.pools {
+		pools = append(pools, pool)
+	}
+	r.mu.Unlock()
+	result := make([]ArenaPoolStats, 0, len(pools))
+	for _, pool := range pools {
+		result = append(result, pool.Stats())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Metrics provides a snapshot of total allocation statistics of all alive registry allocators.
+// MaxCapacity is the registry limit, or 0 if the registry has no limit.
+func (r *Registry) Metrics() Metrics {
+	result := Metrics{MaxCapacity: int(r.limitInBytes)}
+	for _, allocatorMetrics := range r.AllocatorsMetrics() {
+		result.UsedBytes += allocatorMetrics.UsedBytes
+		result.CountOfOnHeapAllocations += allocatorMetrics.CountOfOnHeapAllocations
+	}
+	result.AllocatedBytes = int(atomic.LoadInt64(&r.allocatedBytes))
+	result.AvailableBytes = max(result.AllocatedBytes-result.UsedBytes, 0)
+	return result
+}
+
+// AllocatorsMetrics provides a snapshot of allocation statistics of every alive registry allocator
+// sorted by AllocatedBytes in descending order.
+func (r *Registry) AllocatorsMetrics() []AllocatorMetrics {
+	r.mu.Lock()
+	result := make([]AllocatorMetrics, 0, len(r.members))
+	for member := range r.members {
+		result = append(result, member.metrics())
+	}
+	r.mu.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].AllocatedBytes > result[j].AllocatedBytes
+	})
+	return result
+}
+
+func (r *Registry) newDynamicAllocator(member *registryMember) *DynamicAllocator {
+	r.mu.Lock()
+	r.members[member] = struct{}{}
+	r.mu.Unlock()
+
+	result := &DynamicAllocator{registryMember: member}
+	// budget is returned to the registry even if the allocator isn't closed properly
+	runtime.SetFinalizer(result, func(target *DynamicAllocator) {
+		target.registryMember.release(target.allocatedBytes)
+		target.registryMember.deregister()
+	})
+	return result
+}
+
+func (r *Registry) reserve(bytes int) bool {
+	for {
+		current := atomic.LoadInt64(&r.allocatedBytes)
+		if r.limitInBytes > 0 && current+int64(bytes) > r.limitInBytes {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&r.allocatedBytes, current, current+int64(bytes)) {
+			return true
+		}
+	}
+}
+
+type registryMember struct {
+	usedBytes         int64
+	allocatedBytes    int64
+	onHeapAllocations int64
+
+	registry *Registry
+	pool     *ArenaPool
+	name     string
+}
+
+func (m *registryMember) reserve(bytes int) bool {
+	if !m.registry.reserve(bytes) {
+		return false
+	}
+	atomic.AddInt64(&m.allocatedBytes, int64(bytes))
+	return true
+}
+
+func (m *registryMember) release(bytes int) {
+	atomic.AddInt64(&m.registry.allocatedBytes, -int64(bytes))
+	atomic.AddInt64(&m.allocatedBytes, -int64(bytes))
+}
+
+func (m *registryMember) publishUsedBytes(usedBytes int) {
+	atomic.StoreInt64(&m.usedBytes, int64(usedBytes))
+}
+
+func (m *registryMember) countOnHeapAllocation() {
+	atomic.AddInt64(&m.onHeapAllocations, 1)
+}
+
+func (m *registryMember) deregister() {
+	m.registry.mu.Lock()
+	defer m.registry.mu.Unlock()
+	delete(m.registry.members, m)
+}
+
+func (m *registryMember) metrics() AllocatorMetrics {
+	usedBytes := int(atomic.LoadInt64(&m.usedBytes))
+	allocatedBytes := int(atomic.LoadInt64(&m.allocatedBytes))
+	return AllocatorMetrics{
+		Name: m.name,
+		Metrics: Metrics{
+			Stats: Stats{
+				UsedBytes:                usedBytes,
+				AllocatedBytes:           allocatedBytes,
+				CountOfOnHeapAllocations: int(atomic.LoadInt64(&m.onHeapAllocations)),
+			},
+			AvailableBytes: max(allocatedBytes-usedBytes, 0),
+			MaxCapacity:    int(m.registry.limitInBytes),
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package arena
+
+import (
+	"fmt"
+)
+
+// Scope runs f as a speculative allocation scope on top of the target allocator.
+//
+// It takes a checkpoint by calling CurrentOffset before f,
+// and if f returns an error or panics, target will be rewound by ResetTo,
+// so everything allocated inside of f will be freed, while values allocated before Scope stay untouched.
+// If f succeeds, its allocations are kept.
+// Scopes can be nested, so inner failed scopes don't affect allocations of outer ones.
+//
+// Scope returns the error of f or wraps it if the rollback fails,
+// and panics of f are propagated after the rollback.
+// If the rollback after the panic fails, Scope panics with arena.ScopeRollbackPanic
+// that holds both the original panic value and the rollback error.
+//
+// Target can be arena.RawAllocator, arena.DynamicAllocator, arena.GenericAllocator or any other allocator,
+// that supports CurrentOffset and ResetTo.
+func Scope(target resetter, f func() error) error {
+	checkpoint := target.CurrentOffset()
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		resetErr := target.ResetTo(checkpoint)
+		if resetErr != nil {
+			// recover is called only here, so if the rollback succeeds, the original panic continues untouched
+			panic(ScopeRollbackPanic{Value: recover(), RollbackErr: resetErr})
+		}
+	}()
+
+	fErr := f()
+	if fErr != nil {
+		completed = true
+		resetErr := target.ResetTo(checkpoint)
+		if resetErr != nil {
+			return fmt.Errorf("can't rollback arena scope after %v: %w", fErr, resetErr)
+		}
+		return fErr
+	}
+	completed = true
+	return nil
+}
+
+// ScopeRollbackPanic is the panic value of arena.Scope when f panics and the following rollback fails.
+// Value is the original panic value of f and RollbackErr is the error returned by ResetTo.
+type ScopeRollbackPanic struct {
+	Value       interface{}
+	RollbackErr error
+}
+
+// Error method that implements error interface.
+func (p ScopeRollbackPanic) Error() string {
+	return fmt.Sprintf("can't rollback arena scope after panic: %v: %v", p.Value, p.RollbackErr)
+}
+
+// Unwrap returns the rollback error, so it can be checked by errors.Is and errors.As.
+func (p ScopeRollbackPanic) Unwrap() error {
+	return p.RollbackErr
+}
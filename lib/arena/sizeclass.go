@@ -0,0 +1,356 @@
+package arena
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+)
+
+const (
+	// sizeClassAlignment is the alignment of all blocks of arena.SizeClassAllocator.
+	sizeClassAlignment = 16
+	// maxSmallSizeClass is the biggest size served by segregated free-lists,
+	// bigger blocks are served by the large-object free-list.
+	maxSmallSizeClass = 32 * 1024
+	// largeObjectGranularity is the size granularity of large blocks.
+	largeObjectGranularity = 4 * 1024
+	// sizeClassesCount is 8 classes with 16 bytes step up to 128 bytes
+	// and then 4 classes per each power of two up to maxSmallSizeClass.
+	sizeClassesCount = 8 + 4*8
+)
+
+// SizeClassAllocator is the general-purpose allocator that supports Free of individual values of any size
+// and reuses freed blocks for subsequent allocations, like malloc.
+//
+// It is intended for long-lived data structures that allocate and free values of different sizes,
+// like arena.Bytes or generated buffers, so their memory can't be freed all at once by Clear.
+//
+// Blocks are allocated within buckets of the underlying arena.DynamicAllocator.
+// Requested sizes are rounded up to one of the size classes, and freed blocks of each class
+// are linked into their own segregated intrusive free-list stored inside the blocks themselves.
+// Blocks bigger than 32KB are served by the large-object path, they are rounded up to 4KB,
+// and freed large blocks are reused by the best fit with splitting of the remainder.
+// Adjacent freed blocks are never merged, so please refer to
+// arena.EnhancedMetrics FreeListBytes and FragmentationBytes to monitor the efficiency of memory usage.
+//
+// All blocks are 16-byte aligned, so bigger alignment isn't supported.
+//
+// It can prevent the same types of unsafe behaviour as arena.DynamicAllocator by throwing panics,
+// but it can't catch double free or "use after free", since blocks don't have headers.
+//
+// SizeClassAllocator can be used without the constructor.
+type SizeClassAllocator struct {
+	target DynamicAllocator
+
+	freeLists     [sizeClassesCount]Ptr
+	largeFreeList Ptr
+
+	freeListBytes int
+	dataBytes     int
+	blockBytes    int
+	allocations   int
+}
+
+// smallFreeLink is a link stored inside of freed small blocks.
+// All blocks in free-lists belong to the current generation of the allocator,
+// so the link keeps only the location of the next block, that fits into the smallest block
+// even if arena.Ptr is extended by `arenachecked` build tag.
+type smallFreeLink struct {
+	offset    uintptr
+	bucketIdx uint8
+	linked    bool // offsets are relative to buckets, so zero offset is a valid location
+}
+
+// largeFreeBlock is a header stored inside of freed large blocks.
+type largeFreeBlock struct {
+	next Ptr
+	size uintptr
+}
+
+// NewSizeClassAllocator creates an instance of arena.SizeClassAllocator.
+func NewSizeClassAllocator() *SizeClassAllocator {
+	return &SizeClassAllocator{}
+}
+
+// NewSizeClassAllocatorWithInitialCapacity creates an instance of arena.SizeClassAllocator
+// with specified initial capacity of the underlying arena.DynamicAllocator.
+func NewSizeClassAllocatorWithInitialCapacity(size uint32) *SizeClassAllocator {
+	result := &SizeClassAllocator{}
+	result.target.grow(int(size))
+	return result
+}
+
+// AllocUnaligned performs allocation of one block.
+// Since all blocks are aligned, it is the same as Alloc with alignment of 1 byte.
+func (a *SizeClassAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	return a.Alloc(size, 1)
+}
+
+// Alloc performs allocation of the block that fits size bytes,
+// it reuses previously freed blocks before allocating new ones within the underlying arena.DynamicAllocator.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+// Alignment bigger than 16 bytes isn't supported, so Alloc returns arena.AllocationInvalidArgumentError for it.
+//
+// arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
+// but we'd suggest to do it right before use to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+// Allocated value can be returned to the allocator by SizeClassAllocator.Free with the same size.
+func (a *SizeClassAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if alignment > sizeClassAlignment {
+		return Ptr{}, AllocationInvalidArgumentError
+	}
+
+	blockSize := sizeClassBlockSize(size)
+	var result Ptr
+	if blockSize > maxSmallSizeClass {
+		result = a.takeLargeBlock(blockSize)
+	} else {
+		result = a.takeSmallBlock(sizeClassIdx(blockSize))
+	}
+	if result == (Ptr{}) {
+		var allocErr error
+		result, allocErr = a.target.Alloc(blockSize, sizeClassAlignment)
+		if allocErr != nil {
+			return Ptr{}, allocErr
+		}
+	}
+
+	a.allocations++
+	a.dataBytes += int(size)
+	a.blockBytes += int(blockSize)
+	return result, nil
+}
+
+// Free returns the block referenced by arena.Ptr to the free-list, so it can be reused by subsequent allocations.
+// Size should be the same as it was passed to Alloc, or the length of allocated arena.Bytes or buffer.
+// Block memory is filled with zeros, so values allocated in the reused block are always clear.
+//
+// Free panics if arena.Ptr wasn't allocated by this allocator or was allocated before Clear.
+// Double free or Free with a different size corrupts free-lists,
+// and any usage of arena.Ptr or values converted by ToRef after Free is a "use after free" error.
+func (a *SizeClassAllocator) Free(p Ptr, size uintptr) {
+	ref := a.target.ToRef(p)
+	blockSize := sizeClassBlockSize(size)
+	blockHdr := sliceHeader{
+		Data: uintptr(ref),
+		Len:  int(blockSize),
+		Cap:  int(blockSize),
+	}
+	clearBytes(*(*[]byte)(unsafe.Pointer(&blockHdr)))
+
+	a.dataBytes -= int(size)
+	a.blockBytes -= int(blockSize)
+	a.putBlock(p, ref, blockSize)
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// The value is always copied into a new block, and the previous block is returned to the free-list,
+// so arena.Ptr should reference the beginning of the block, and oldSize should be the same as it was passed
+// to allocation, the same as for SizeClassAllocator.Free.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+// Alignment bigger than 16 bytes isn't supported, so Realloc returns arena.AllocationInvalidArgumentError for it.
+func (a *SizeClassAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	return reallocByMove(a, p, oldSize, newSize, alignment)
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer.
+// It has the same protection as arena.DynamicAllocator.ToRef.
+//
+// We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *SizeClassAllocator) ToRef(p Ptr) unsafe.Pointer {
+	return a.target.ToRef(p)
+}
+
+// CurrentOffset returns the current allocation offset of the underlying arena.DynamicAllocator.
+// Allocations from free-lists don't move it.
+func (a *SizeClassAllocator) CurrentOffset() Offset {
+	return a.target.CurrentOffset()
+}
+
+// Clear gets rid of all blocks, including free-lists, and makes the allocator available for re-use.
+// For details please refer to arena.DynamicAllocator.Clear.
+func (a *SizeClassAllocator) Clear() {
+	a.target.Clear()
+	a.resetFreeLists()
+}
+
+// Close gets rid of all underlying buffers and makes the allocator unusable.
+// For details please refer to arena.DynamicAllocator.Close.
+func (a *SizeClassAllocator) Close() {
+	a.target.Close()
+	a.resetFreeLists()
+}
+
+// Stats provides a snapshot of essential allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// Blocks in free-lists aren't counted as used bytes.
+func (a *SizeClassAllocator) Stats() Stats {
+	result := a.target.Stats()
+	result.UsedBytes -= a.freeListBytes
+	return result
+}
+
+// Metrics provides a snapshot of current allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// Blocks in free-lists are counted as available bytes,
+// but due to size classes, not all of them can be used for an arbitrary allocation.
+func (a *SizeClassAllocator) Metrics() Metrics {
+	result := a.target.Metrics()
+	result.UsedBytes -= a.freeListBytes
+	result.AvailableBytes += a.freeListBytes
+	return result
+}
+
+// EnhancedMetrics provides a snapshot of detailed allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// FragmentationBytes of arena.SizeClassAllocator is the count of bytes lost
+// due to rounding of allocated values up to their size classes.
+func (a *SizeClassAllocator) EnhancedMetrics() EnhancedMetrics {
+	metrics := a.Metrics()
+	fragmentationBytes := a.blockBytes - a.dataBytes
+	return EnhancedMetrics{
+		Metrics:            metrics,
+		CountOfAllocations: a.allocations,
+		PaddingOverhead:    metrics.UsedBytes - a.blockBytes,
+		DataBytes:          a.dataBytes,
+		FreeListBytes:      a.freeListBytes,
+		FragmentationBytes: fragmentationBytes,
+	}
+}
+
+// String provides a string snapshot of the current allocation offset and free-lists state.
+func (a *SizeClassAllocator) String() string {
+	return fmt.Sprintf("sizeclassarena{free: %v target: %v}", a.freeListBytes, &a.target)
+}
+
+func (a *SizeClassAllocator) takeSmallBlock(classIdx int) Ptr {
+	result := a.freeLists[classIdx]
+	if result == (Ptr{}) {
+		return Ptr{}
+	}
+	link := (*smallFreeLink)(a.target.ToRef(result))
+	next := Ptr{}
+	if link.linked {
+		next = result
+		next.offset = link.offset
+		next.bucketIdx = link.bucketIdx
+	}
+	a.freeLists[classIdx] = next
+	*link = smallFreeLink{}
+	a.freeListBytes -= int(sizeClassSize(classIdx))
+	return result
+}
+
+// takeLargeBlock finds the smallest freed large block that fits blockSize,
+// and puts the remainder of this block back to free-lists.
+func (a *SizeClassAllocator) takeLargeBlock(blockSize uintptr) Ptr {
+	bestPrev, best := Ptr{}, Ptr{}
+	bestSize := uintptr(0)
+	prev, current := Ptr{}, a.largeFreeList
+	for current != (Ptr{}) {
+		block := (*largeFreeBlock)(a.target.ToRef(current))
+		if block.size >= blockSize && (best == (Ptr{}) || block.size < bestSize) {
+			bestPrev, best, bestSize = prev, current, block.size
+			if bestSize == blockSize {
+				break
+			}
+		}
+		prev, current = current, block.next
+	}
+	if best == (Ptr{}) {
+		return Ptr{}
+	}
+
+	bestBlock := (*largeFreeBlock)(a.target.ToRef(best))
+	if bestPrev == (Ptr{}) {
+		a.largeFreeList = bestBlock.next
+	} else {
+		(*largeFreeBlock)(a.target.ToRef(bestPrev)).next = bestBlock.next
+	}
+	*bestBlock = largeFreeBlock{}
+	a.freeListBytes -= int(bestSize)
+
+	if bestSize > blockSize {
+		remainder := best
+		remainder.offset += blockSize
+		a.putBlock(remainder, a.target.ToRef(remainder), bestSize-blockSize)
+	}
+	return best
+}
+
+func (a *SizeClassAllocator) putBlock(p Ptr, ref unsafe.Pointer, blockSize uintptr) {
+	a.freeListBytes += int(blockSize)
+	if blockSize > maxSmallSizeClass {
+		*(*largeFreeBlock)(ref) = largeFreeBlock{next: a.largeFreeList, size: blockSize}
+		a.largeFreeList = p
+		return
+	}
+	classIdx := sizeClassIdx(blockSize)
+	head := a.freeLists[classIdx]
+	*(*smallFreeLink)(ref) = smallFreeLink{offset: head.offset, bucketIdx: head.bucketIdx, linked: head != (Ptr{})}
+	a.freeLists[classIdx] = p
+}
+
+func (a *SizeClassAllocator) resetFreeLists() {
+	a.freeLists = [sizeClassesCount]Ptr{}
+	a.largeFreeList = Ptr{}
+	a.freeListBytes = 0
+	a.dataBytes = 0
+	a.blockBytes = 0
+}
+
+// sizeClassBlockSize returns the size of the block that fits size bytes.
+// Small sizes are rounded up to their size classes, and large sizes are rounded up to largeObjectGranularity.
+func sizeClassBlockSize(size uintptr) uintptr {
+	if size <= 128 {
+		if size == 0 {
+			return sizeClassAlignment
+		}
+		return size + calculatePadding(size, sizeClassAlignment)
+	}
+	if size > maxSmallSizeClass {
+		return size + calculatePadding(size, largeObjectGranularity)
+	}
+	// 4 classes between each power of two
+	step := uintptr(1) << (bits.Len(uint(size-1)) - 3)
+	return size + calculatePadding(size, step)
+}
+
+// sizeClassIdx returns index of the small size class, blockSize should be the result of sizeClassBlockSize.
+func sizeClassIdx(blockSize uintptr) int {
+	if blockSize <= 128 {
+		return int(blockSize/sizeClassAlignment) - 1
+	}
+	powerOfTwo := bits.Len(uint(blockSize-1)) - 1
+	step := uintptr(1) << (powerOfTwo - 2)
+	return 8 + (powerOfTwo-7)*4 + int((blockSize-(uintptr(1)<<powerOfTwo))/step) - 1
+}
+
+// sizeClassSize returns the block size of the small size class.
+func sizeClassSize(classIdx int) uintptr {
+	if classIdx < 8 {
+		return uintptr(classIdx+1) * sizeClassAlignment
+	}
+	powerOfTwo := (classIdx-8)/4 + 7
+	step := uintptr(1) << (powerOfTwo - 2)
+	return uintptr(1)<<powerOfTwo + uintptr((classIdx-8)%4+1)*step
+}
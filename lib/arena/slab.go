@@ -0,0 +1,240 @@
+package arena
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// SlabAllocator is the allocator of fixed-size slots that supports Free of individual values
+// and reuses freed slots for subsequent allocations.
+//
+// It is intended for long-lived data structures, like caches, that churn values of the same type,
+// so their memory can't be freed all at once by Clear.
+//
+// Slots are allocated within buckets of the underlying arena.DynamicAllocator,
+// and freed slots are linked into the intrusive free-list stored inside the slots themselves,
+// so there are no additional allocations on Free.
+// Slot size is the requested size rounded up to the slot alignment,
+// but it can't be smaller than arena.Ptr, that is used as a free-list link.
+//
+// It can prevent the same types of unsafe behaviour as arena.DynamicAllocator by throwing panics,
+// and with SlabOptions.DetectDoubleFree it can also catch:
+//  - Free call with arena.Ptr that was already freed.
+//  - ToRef call with arena.Ptr that was freed and wasn't allocated again.
+//
+// SlabAllocator should be created by NewSlabAllocator.
+type SlabAllocator struct {
+	target DynamicAllocator
+
+	slotSize      uintptr
+	slotAlignment uintptr
+
+	freeList  Ptr
+	freeSlots int
+
+	freedSlots map[Ptr]struct{} // tracked only if double free detection is enabled
+}
+
+// SlabOptions is a structure used to configure arena.SlabAllocator.
+//
+// You can configure:
+//  - InitialCapacity - initial capacity of the underlying arena.DynamicAllocator,
+//    if not specified we will use its default capacity.
+//  - DetectDoubleFree - debug mode that tracks all freed slots, so Free panics on double free
+//    and ToRef panics on usage of freed slots. It costs additional map operations on each Alloc and Free,
+//    so it is intended only for tests and debugging. This mode is always enabled in `arenadebug` build mode on Linux.
+type SlabOptions struct {
+	InitialCapacity  uint32
+	DetectDoubleFree bool
+}
+
+// NewSlabAllocator creates an instance of arena.SlabAllocator
+// that serves values of the specified size and alignment.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func NewSlabAllocator(size, alignment uintptr, opts SlabOptions) *SlabAllocator {
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	result := &SlabAllocator{
+		slotAlignment: alignment,
+	}
+	if result.slotAlignment < unsafe.Alignof(Ptr{}) {
+		result.slotAlignment = unsafe.Alignof(Ptr{})
+	}
+	result.slotSize = size
+	if result.slotSize < unsafe.Sizeof(Ptr{}) {
+		result.slotSize = unsafe.Sizeof(Ptr{})
+	}
+	result.slotSize += calculatePadding(result.slotSize, result.slotAlignment)
+	if opts.InitialCapacity > 0 {
+		result.target.grow(int(opts.InitialCapacity))
+	}
+	if opts.DetectDoubleFree || protectMemoryOnClear {
+		result.freedSlots = make(map[Ptr]struct{})
+	}
+	return result
+}
+
+// AllocUnaligned performs allocation of one slot.
+// Since all slots are aligned, it is the same as Alloc with alignment of 1 byte.
+func (a *SlabAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	return a.Alloc(size, 1)
+}
+
+// Alloc performs allocation of one slot, it reuses previously freed slots before
+// allocating new ones within the underlying arena.DynamicAllocator.
+//
+// It returns arena.AllocationInvalidArgumentError if size or alignment
+// are bigger than the slot size or alignment of this allocator,
+// so it can be used with views only to allocate one value at a time.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+//
+// arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
+// but we'd suggest to do it right before use to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *SlabAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if size > a.slotSize || alignment > a.slotAlignment {
+		return Ptr{}, AllocationInvalidArgumentError
+	}
+	if a.freeList == (Ptr{}) {
+		return a.target.Alloc(a.slotSize, a.slotAlignment)
+	}
+
+	result := a.freeList
+	link := (*Ptr)(a.target.ToRef(result))
+	a.freeList = *link
+	*link = Ptr{}
+	a.freeSlots--
+	if a.freedSlots != nil {
+		delete(a.freedSlots, result)
+	}
+	return result, nil
+}
+
+// Free returns the slot referenced by arena.Ptr to the free-list, so it can be reused by subsequent allocations.
+// Slot memory is filled with zeros, so values allocated in the reused slot are always clear.
+//
+// Free panics if arena.Ptr wasn't allocated by this allocator or was allocated before Clear.
+// With SlabOptions.DetectDoubleFree, it also panics if arena.Ptr was already freed,
+// otherwise such double free corrupts the free-list, so please test your program with this option.
+//
+// Any usage of arena.Ptr or values converted by ToRef after Free is a "use after free" error.
+func (a *SlabAllocator) Free(p Ptr) {
+	ref := a.ToRef(p)
+	if a.freedSlots != nil {
+		a.freedSlots[p] = struct{}{}
+	}
+	slotHdr := sliceHeader{
+		Data: uintptr(ref),
+		Len:  int(a.slotSize),
+		Cap:  int(a.slotSize),
+	}
+	clearBytes(*(*[]byte)(unsafe.Pointer(&slotHdr)))
+	*(*Ptr)(ref) = a.freeList
+	a.freeList = p
+	a.freeSlots++
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// Sizes of values aren't tracked, so arena.SlabAllocator can't prove that the rest of the slot is unused,
+// and the value is always copied into a new slot, and the previous slot is freed,
+// so arena.Ptr should be the start of the slot, the same as for SlabAllocator.Free.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// It returns arena.AllocationInvalidArgumentError if newSize or alignment
+// are bigger than the slot size or alignment of this allocator.
+func (a *SlabAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	if newSize > a.slotSize || alignment > a.slotAlignment {
+		return Ptr{}, AllocationInvalidArgumentError
+	}
+	return reallocByMove(a, p, oldSize, newSize, alignment)
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer.
+//
+// It has the same protection as arena.DynamicAllocator.ToRef,
+// and with SlabOptions.DetectDoubleFree it also panics if arena.Ptr was freed.
+//
+// We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *SlabAllocator) ToRef(p Ptr) unsafe.Pointer {
+	if a.freedSlots != nil {
+		if _, freed := a.freedSlots[p]; freed {
+			panic(fmt.Sprintf("slab slot is already freed: %v", p))
+		}
+	}
+	return a.target.ToRef(p)
+}
+
+// CurrentOffset returns the current allocation offset of the underlying arena.DynamicAllocator.
+// Allocations from the free-list don't move it.
+func (a *SlabAllocator) CurrentOffset() Offset {
+	return a.target.CurrentOffset()
+}
+
+// Clear gets rid of all slots, including the free-list, and makes the allocator available for re-use.
+// For details please refer to arena.DynamicAllocator.Clear.
+func (a *SlabAllocator) Clear() {
+	a.target.Clear()
+	a.resetFreeList()
+}
+
+// Close gets rid of all underlying buffers and makes the allocator unusable.
+// For details please refer to arena.DynamicAllocator.Close.
+func (a *SlabAllocator) Close() {
+	a.target.Close()
+	a.resetFreeList()
+}
+
+// Stats provides a snapshot of essential allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// Slots in the free-list aren't counted as used bytes.
+func (a *SlabAllocator) Stats() Stats {
+	result := a.target.Stats()
+	result.UsedBytes -= a.freeSlots * int(a.slotSize)
+	return result
+}
+
+// Metrics provides a snapshot of current allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// Slots in the free-list are counted as available bytes.
+func (a *SlabAllocator) Metrics() Metrics {
+	result := a.target.Metrics()
+	result.UsedBytes -= a.freeSlots * int(a.slotSize)
+	result.AvailableBytes += a.freeSlots * int(a.slotSize)
+	return result
+}
+
+// SlotSize returns the size of one slot, which is the upper limit of size of the allocated value.
+func (a *SlabAllocator) SlotSize() uintptr {
+	return a.slotSize
+}
+
+// String provides a string snapshot of the current allocation offset and free-list state.
+func (a *SlabAllocator) String() string {
+	return fmt.Sprintf("slabarena{slot: %v free: %v target: %v}", a.slotSize, a.freeSlots, &a.target)
+}
+
+func (a *SlabAllocator) resetFreeList() {
+	a.freeList = Ptr{}
+	a.freeSlots = 0
+	if a.freedSlots != nil {
+		a.freedSlots = make(map[Ptr]struct{})
+	}
+}
@@ -0,0 +1,330 @@
+package arena
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"unsafe"
+)
+
+const maxCountOfSyncBuckets = math.MaxUint8 + 1
+
+// syncBucket is a raw arena that is used by arena.SyncAllocator,
+// its offset is modified only by atomic operations.
+type syncBucket struct {
+	raw RawAllocator
+	idx uint8
+}
+
+// SyncAllocator is the dynamically growable bump pointer allocator that is safe for concurrent use
+// by multiple goroutines, so one arena can be shared between goroutines of the fan-out request handler
+// without locks around every allocation.
+//
+// Allocations are performed by compare-and-swap of the current bucket offset,
+// and when the current bucket is exhausted, the next bucket is allocated and published
+// with atomic compare-and-swap, so there are no locks even on the growth path.
+//
+// SyncAllocator prevents the same types of unsafe behaviour as arena.DynamicAllocator:
+//  - ToRef call with arena.Ptr that wasn't allocated by this arena.
+//  - ToRef call with arena.Ptr that was allocated before arena SyncAllocator.Clear call.
+//  - Alloc call with unsupported alignment value.
+//
+// All methods, except Clear, can be called concurrently.
+// Clear should be called only when there are no other concurrent calls,
+// for example, after all goroutines that use the allocator are done.
+//
+// Atomic operations are more expensive than the usual ones, so if the allocator is used by one goroutine,
+// please refer to arena.DynamicAllocator or arena.GenericAllocator.
+type SyncAllocator struct {
+	// 64-bit fields go first to guarantee their alignment for atomic operations on 32-bit platforms
+	usedBytes         int64
+	allocatedBytes    int64
+	onHeapAllocations int64
+	generation        uint64 // used only by `arenachecked` build mode
+
+	buckets     [maxCountOfSyncBuckets]unsafe.Pointer // *syncBucket
+	current     unsafe.Pointer                        // *syncBucket
+	arenaMask   uint32
+	allocatorID uint32 // used only by `arenachecked` build mode
+}
+
+// NewSyncAllocator creates an instance of arena.SyncAllocator.
+func NewSyncAllocator() *SyncAllocator {
+	return &SyncAllocator{}
+}
+
+// AllocUnaligned performs allocation within underlying buckets, but without automatic alignment.
+// This method is more performant and can be used to allocate memory with an alignment of 1 byte
+// or to create a dedicated method that will allocate only object with the same alignment,
+// so there are no additional padding calculations required.
+//
+// IMPORTANT, this method is potentially UNSAFE to use, please if you use it,
+// try to test/run your program with race detector or `-d=checkptr` flag.
+//
+// It returns arena.Ptr value, which is basically
+// an offset and index of bucket used for this allocation.
+//
+// AllocUnaligned can return arena.AllocationLimitError if all buckets are exhausted.
+func (a *SyncAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	arenaMask, check := a.init()
+	for {
+		current := (*syncBucket)(atomic.LoadPointer(&a.current))
+		if current != nil {
+			// failed allocations don't move the offset, so it never overshoots the end of the bucket
+			result, usedBytes, ok := current.alloc(size, 1)
+			if ok {
+				atomic.AddInt64(&a.usedBytes, int64(usedBytes))
+				result.arenaMask = arenaMask
+				result.check = check
+				return result, nil
+			}
+		}
+		growErr := a.grow(current, size)
+		if growErr != nil {
+			return Ptr{}, growErr
+		}
+	}
+}
+
+// Alloc performs allocation within underlying buckets.
+//
+// It returns arena.Ptr value, which is basically
+// an offset and index of bucket used for this allocation.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+//
+// Alloc can return arena.AllocationLimitError if all buckets are exhausted.
+//
+// arena.Ptr is a simple struct that should be passed by value and
+// is not considered by Go runtime as a legit pointer type.
+// So the GC can skip it during the concurrent mark phase.
+//
+// arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
+// but we'd suggest to do it right before use to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *SyncAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	arenaMask, check := a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+
+	for {
+		current := (*syncBucket)(atomic.LoadPointer(&a.current))
+		if current != nil {
+			result, usedBytes, ok := current.alloc(size, alignment)
+			if ok {
+				atomic.AddInt64(&a.usedBytes, int64(usedBytes))
+				result.arenaMask = arenaMask
+				result.check = check
+				return result, nil
+			}
+		}
+		growErr := a.grow(current, size+alignment)
+		if growErr != nil {
+			return Ptr{}, growErr
+		}
+	}
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// If the value is still the last allocation in the current bucket, it is extended in place
+// by compare-and-swap of the bucket offset, and the same arena.Ptr is returned.
+// Otherwise, newSize bytes are allocated and the value is copied there, but the previous value is left untouched.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// Realloc is safe for concurrent use with other methods, except Clear,
+// but the value itself shouldn't be modified by other goroutines during Realloc.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+func (a *SyncAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	arenaMask, check := a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	current := (*syncBucket)(atomic.LoadPointer(&a.current))
+	canExtendInPlace := oldSize > 0 && current != nil && p.arenaMask == arenaMask && p.check == check &&
+		p.bucketIdx == current.idx &&
+		p.offset&(alignment-1) == 0 && p.offset+newSize <= current.raw.endPtr
+	if canExtendInPlace && atomic.CompareAndSwapUintptr(&current.raw.offset, p.offset+oldSize, p.offset+newSize) {
+		atomic.AddInt64(&a.usedBytes, int64(newSize-oldSize))
+		return p, nil
+	}
+	return reallocByCopy(a, p, oldSize, newSize, alignment)
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer.
+//
+// This method performs bounds check, so it can panic if you pass an arena.Ptr
+// allocated by different arena with internal offset bigger than the underlying buffer.
+//
+// Also, this SyncAllocator.ToRef has protection and can panic if you try to convert arena.Ptr
+// that was allocated by other arena, this is done by comparison of arena.Ptr.arenaMask fields.
+//
+// We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *SyncAllocator) ToRef(p Ptr) unsafe.Pointer {
+	if uint32(p.arenaMask) != atomic.LoadUint32(&a.arenaMask) || p.check != a.ptrCheck() {
+		panic("pointer isn't part of this arena")
+	}
+	targetBucket := (*syncBucket)(atomic.LoadPointer(&a.buckets[p.bucketIdx]))
+	if targetBucket == nil || p.offset < uintptr(targetBucket.raw.startPtr) || p.offset > targetBucket.raw.endPtr {
+		panic(fmt.Sprintf("sync arena bucket index out of range. requested ptr: %v", p))
+	}
+	return targetBucket.raw.ToRef(p)
+}
+
+// CurrentOffset returns the current allocation offset.
+// This method can be primarily used to build other allocators on top of arena.SyncAllocator,
+// but please note that the offset can be changed by other goroutines at any moment.
+func (a *SyncAllocator) CurrentOffset() Offset {
+	arenaMask, check := a.init()
+	current := (*syncBucket)(atomic.LoadPointer(&a.current))
+	if current == nil {
+		return Offset{p: Ptr{arenaMask: arenaMask, check: check}}
+	}
+	offset := atomic.LoadUintptr(&current.raw.offset)
+	return Offset{p: Ptr{offset: offset, bucketIdx: current.idx, arenaMask: arenaMask, check: check}}
+}
+
+// Clear fills all underlying buckets with zeros and moves offsets to zero.
+// Buckets are kept and reused by subsequent allocations.
+//
+// Clear invocation also changes the arena.SyncAllocator.arenaMask
+// so it can prevent some "use after free" arena.SyncAllocator.ToRef calls with arena.Ptr allocated before Clear,
+// but it can't catch usages of already converted values.
+//
+// Clear isn't safe for concurrent use, it should be called only when
+// there are no other concurrent calls to this allocator.
+func (a *SyncAllocator) Clear() {
+	for i := range a.buckets {
+		b := (*syncBucket)(atomic.LoadPointer(&a.buckets[i]))
+		if b == nil {
+			break
+		}
+		b.raw.Clear()
+	}
+	atomic.StorePointer(&a.current, atomic.LoadPointer(&a.buckets[0]))
+	atomic.StoreInt64(&a.usedBytes, 0)
+	atomic.StoreUint32(&a.arenaMask, uint32(uint16(atomic.LoadUint32(&a.arenaMask)+1)|1))
+	atomic.AddUint64(&a.generation, 1)
+}
+
+// Stats provides a snapshot of essential allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+func (a *SyncAllocator) Stats() Stats {
+	return Stats{
+		UsedBytes:                int(atomic.LoadInt64(&a.usedBytes)),
+		AllocatedBytes:           int(atomic.LoadInt64(&a.allocatedBytes)),
+		CountOfOnHeapAllocations: int(atomic.LoadInt64(&a.onHeapAllocations)),
+	}
+}
+
+// Metrics provides a snapshot of current allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+func (a *SyncAllocator) Metrics() Metrics {
+	stats := a.Stats()
+	availableBytes := 0
+	countOfBuckets := 0
+	current := (*syncBucket)(atomic.LoadPointer(&a.current))
+	if current != nil {
+		availableBytes = int(current.available())
+		countOfBuckets = int(current.idx) + 1
+	}
+	return Metrics{
+		Stats:          stats,
+		AvailableBytes: availableBytes,
+		MaxCapacity:    stats.AllocatedBytes + (maxCountOfSyncBuckets-countOfBuckets)*math.MaxUint32,
+	}
+}
+
+// String provides a string snapshot of the current allocation offset.
+func (a *SyncAllocator) String() string {
+	return fmt.Sprintf("syncarena{mask: %v offset: %v}", atomic.LoadUint32(&a.arenaMask), a.CurrentOffset())
+}
+
+// grow moves the current bucket forward if it is still the specified one.
+// It reuses buckets that were kept after Clear, skipping the ones that are too small for the required size,
+// or allocates a new one, so concurrent callers can race only on the publishing of the same bucket index.
+func (a *SyncAllocator) grow(current *syncBucket, requiredAvailableSize uintptr) error {
+	if requiredAvailableSize > math.MaxUint32/2 {
+		return AllocationLimitError
+	}
+	nextIdx := 0
+	currentSize := 0
+	if current != nil {
+		nextIdx = int(current.idx) + 1
+		currentSize = current.raw.len()
+	}
+	var next unsafe.Pointer
+	for ; nextIdx < maxCountOfSyncBuckets; nextIdx++ {
+		next = atomic.LoadPointer(&a.buckets[nextIdx])
+		if next == nil || (*syncBucket)(next).available() >= requiredAvailableSize {
+			break
+		}
+		currentSize = max(currentSize, (*syncBucket)(next).raw.len())
+	}
+	if nextIdx >= maxCountOfSyncBuckets {
+		return AllocationLimitError
+	}
+	if next == nil {
+		newSize := optimalRawAllocatorSize(uint32(max(currentSize*2, int(requiredAvailableSize)*2)))
+		candidate := &syncBucket{raw: *NewRawAllocator(newSize), idx: uint8(nextIdx)}
+		if atomic.CompareAndSwapPointer(&a.buckets[nextIdx], nil, unsafe.Pointer(candidate)) {
+			atomic.AddInt64(&a.allocatedBytes, int64(candidate.raw.len()))
+			atomic.AddInt64(&a.onHeapAllocations, 1)
+		}
+		next = atomic.LoadPointer(&a.buckets[nextIdx])
+	}
+	atomic.CompareAndSwapPointer(&a.current, unsafe.Pointer(current), next)
+	return nil
+}
+
+func (a *SyncAllocator) init() (uint16, ptrCheck) {
+	arenaMask := atomic.LoadUint32(&a.arenaMask)
+	if arenaMask == 0 {
+		if checkedPtrMode {
+			// identity is published before the mask, so it is visible to everyone who observes the mask
+			atomic.CompareAndSwapUint32(&a.allocatorID, 0, newAllocatorID())
+		}
+		atomic.CompareAndSwapUint32(&a.arenaMask, 0, uint32(uint16(rand.Uint32())|1))
+		arenaMask = atomic.LoadUint32(&a.arenaMask)
+	}
+	return uint16(arenaMask), a.ptrCheck()
+}
+
+func (a *SyncAllocator) ptrCheck() ptrCheck {
+	if !checkedPtrMode {
+		return ptrCheck{}
+	}
+	return makePtrCheck(atomic.LoadUint32(&a.allocatorID), atomic.LoadUint64(&a.generation))
+}
+
+// available returns the count of bytes left in the bucket.
+func (b *syncBucket) available() uintptr {
+	return b.raw.endPtr - atomic.LoadUintptr(&b.raw.offset)
+}
+
+// alloc performs allocation by compare-and-swap of the bucket offset
+// and returns the count of used bytes, including padding.
+func (b *syncBucket) alloc(size uintptr, alignment uintptr) (Ptr, uintptr, bool) {
+	for {
+		offset := atomic.LoadUintptr(&b.raw.offset)
+		padding := calculatePadding(offset, alignment)
+		newOffset := offset + padding + size
+		if newOffset > b.raw.endPtr || newOffset < offset {
+			return Ptr{}, 0, false
+		}
+		if atomic.CompareAndSwapUintptr(&b.raw.offset, offset, newOffset) {
+			return Ptr{offset: offset + padding, bucketIdx: b.idx}, padding + size, true
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package arena
+
+import (
+	"fmt"
+	"math/rand"
+	"unsafe"
+)
+
+// VirtualAllocator is the growable bump pointer allocator that operates on top of
+// one contiguous range of virtual address space reserved in advance.
+//
+// The whole range is reserved by mmap with PROT_NONE, so it doesn't consume physical memory,
+// and pages are committed on demand when the allocation offset reaches them.
+// As a result, memory of the VirtualAllocator always stays contiguous,
+// growth never copies or fragments previously allocated values,
+// and there is no limit on the count of growth steps, unlike arena.DynamicAllocator with its buckets.
+//
+// It can prevent the same types of unsafe behaviour as arena.DynamicAllocator by throwing panics:
+//  - ToRef call with arena.Ptr that wasn't allocated by this arena.
+//  - ToRef call with arena.Ptr that was allocated before arena VirtualAllocator.Clear call.
+//  - Alloc call with unsupported alignment value.
+//
+// VirtualAllocator should be created by NewVirtualAllocator
+// and closed by VirtualAllocator.Close to return the reserved range to the OS.
+type VirtualAllocator struct {
+	reserved     []byte // strong reference to the whole reserved range
+	startPtr     uintptr
+	endPtr       uintptr // end of the reserved range, exclusive
+	committedPtr uintptr // end of the committed part of the reserved range, exclusive
+	offset       uintptr
+
+	arenaMask uint16
+	check     ptrCheck
+	closed    bool
+}
+
+// NewVirtualAllocator creates an instance of arena.VirtualAllocator
+// and reserves reservedBytes of virtual address space for it.
+//
+// Reserved range doesn't consume physical memory until it is used,
+// so it can be much bigger than the expected usage, like several gigabytes on 64-bit platforms.
+// Reserved size is the upper limit of allocations, after it is reached,
+// Alloc returns arena.AllocationLimitError.
+//
+// NewVirtualAllocator is supported only on Linux,
+// on other platforms it returns arena.UnsupportedPlatformError.
+func NewVirtualAllocator(reservedBytes uint64) (*VirtualAllocator, error) {
+	if reservedBytes == 0 || reservedBytes > uint64(^uint(0)>>1) {
+		return nil, AllocationInvalidArgumentError
+	}
+	reserved, reserveErr := reserveAddressSpace(int(reservedBytes))
+	if reserveErr != nil {
+		return nil, reserveErr
+	}
+	startPtr := uintptr(unsafe.Pointer(&reserved[0]))
+	return &VirtualAllocator{
+		reserved:     reserved,
+		startPtr:     startPtr,
+		endPtr:       startPtr + uintptr(len(reserved)),
+		committedPtr: startPtr,
+		offset:       startPtr,
+	}, nil
+}
+
+// AllocUnaligned performs allocation within the reserved range, but without automatic alignment.
+// This method is more performant and can be used to allocate memory with an alignment of 1 byte
+// or to create a dedicated method that will allocate only object with the same alignment,
+// so there are no additional padding calculations required.
+//
+// IMPORTANT, this method is potentially UNSAFE to use, please if you use it,
+// try to test/run your program with race detector or `-d=checkptr` flag.
+//
+// AllocUnaligned can return arena.AllocationLimitError if the reserved range is exhausted.
+func (a *VirtualAllocator) AllocUnaligned(size uintptr) (Ptr, error) {
+	a.init()
+	if a.offset+size > a.committedPtr {
+		commitErr := a.commit(size)
+		if commitErr != nil {
+			return Ptr{}, commitErr
+		}
+	}
+	result := Ptr{offset: a.offset, arenaMask: a.arenaMask, check: a.check}
+	a.offset += size
+	return result, nil
+}
+
+// Alloc performs allocation within the reserved range.
+//
+// It returns arena.Ptr value, which is basically an offset of the allocated value,
+// and unlike arena.DynamicAllocator, bucket index of such arena.Ptr is always zero.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+//
+// Alloc can return arena.AllocationLimitError if the reserved range is exhausted.
+//
+// arena.Ptr is a simple struct that should be passed by value and
+// is not considered by Go runtime as a legit pointer type.
+// So the GC can skip it during the concurrent mark phase.
+//
+// arena.Ptr can be converted to unsafe.Pointer by using arena allocator ToRef method,
+// but we'd suggest to do it right before use to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+func (a *VirtualAllocator) Alloc(size, alignment uintptr) (Ptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+
+	padding := calculatePadding(a.offset, alignment)
+	if a.offset+padding+size > a.committedPtr {
+		commitErr := a.commit(padding + size)
+		if commitErr != nil {
+			return Ptr{}, commitErr
+		}
+	}
+	a.offset += padding
+	result := Ptr{offset: a.offset, arenaMask: a.arenaMask, check: a.check}
+	a.offset += size
+	return result, nil
+}
+
+// Realloc changes the size of the value referenced by arena.Ptr from oldSize to newSize bytes.
+//
+// If the value is the last allocation, it is extended in place, committing more pages if required,
+// and the same arena.Ptr is returned. Otherwise, newSize bytes are allocated
+// and the value is copied there, but the previous value is left untouched.
+// If newSize is not bigger than oldSize, the same arena.Ptr is returned.
+//
+// alignment - should be a power of 2 number and can't be 0
+// In case of any violations, panic will be thrown.
+//
+// Realloc can return arena.AllocationLimitError if the reserved range is exhausted.
+func (a *VirtualAllocator) Realloc(p Ptr, oldSize uintptr, newSize uintptr, alignment uintptr) (Ptr, error) {
+	a.init()
+
+	if !isPowerOfTwo(alignment) {
+		panic(fmt.Errorf("alignment should be power of 2. actual value: %d", alignment))
+	}
+	if newSize <= oldSize {
+		return p, nil
+	}
+	isLastAllocation := oldSize > 0 && p.arenaMask == a.arenaMask && p.check == a.check &&
+		p.offset+oldSize == a.offset && p.offset&(alignment-1) == 0
+	if !isLastAllocation {
+		return reallocByCopy(a, p, oldSize, newSize, alignment)
+	}
+	growth := newSize - oldSize
+	if a.offset+growth > a.committedPtr {
+		commitErr := a.commit(growth)
+		if commitErr != nil {
+			return Ptr{}, commitErr
+		}
+	}
+	a.offset += growth
+	return p, nil
+}
+
+// ToRef converts arena.Ptr to unsafe.Pointer.
+//
+// This method performs bounds check, so it can panic if you pass an arena.Ptr
+// allocated by different arena with internal offset out of the allocated range.
+//
+// Also, this VirtualAllocator.ToRef has protection and can panic if you try to convert arena.Ptr
+// that was allocated by other arena, this is done by comparison of arena.Ptr.arenaMask fields.
+//
+// We'd suggest calling this method right before using the result pointer to eliminate its visibility scope
+// and potentially prevent it's escaping to the heap.
+//go:nocheckptr
+func (a *VirtualAllocator) ToRef(p Ptr) unsafe.Pointer {
+	if p.arenaMask != a.arenaMask || p.check != a.check || p.bucketIdx != 0 {
+		a.panicIfClosed()
+		panic("pointer isn't part of this arena")
+	}
+	if p.offset < a.startPtr || p.offset > a.offset {
+		panic(fmt.Sprintf(
+			"virtual arena index out of range. "+
+				"requested ptr: %#x; arena: [%#x: %#x]",
+			p.offset, a.startPtr, a.offset,
+		))
+	}
+	return addressToRef(p.offset)
+}
+
+// CurrentOffset returns the current allocation offset.
+// This method can be primarily used to build other allocators on top of arena.VirtualAllocator.
+func (a *VirtualAllocator) CurrentOffset() Offset {
+	a.init()
+	return Offset{p: Ptr{offset: a.offset, arenaMask: a.arenaMask, check: a.check}}
+}
+
+// ResetTo frees everything allocated after the checkpoint previously returned by CurrentOffset
+// and fills only this region with zeros. Checkpoints can be nested,
+// and the allocator can be rewound to any of them, from the latest to the earliest.
+// Committed pages are kept, so subsequent allocations don't need to commit them again.
+//
+// ToRef can catch most usages of arena.Ptr allocated after the checkpoint until the same memory is allocated again,
+// but usages of already converted values can't be caught.
+//
+// ResetTo returns arena.AllocationInvalidArgumentError if the checkpoint doesn't belong to this allocator
+// or is out of the currently allocated region.
+func (a *VirtualAllocator) ResetTo(o Offset) error {
+	a.init()
+	p := o.p
+	if p.arenaMask != a.arenaMask || p.check != a.check || p.bucketIdx != 0 ||
+		p.offset < a.startPtr || p.offset > a.offset {
+		return AllocationInvalidArgumentError
+	}
+	clearBytes(a.reserved[p.offset-a.startPtr : a.offset-a.startPtr])
+	a.offset = p.offset
+	return nil
+}
+
+// Clear fills the used part of the reserved range with zeros and moves offset to zero.
+// Large used regions are returned to the OS with MADV_DONTNEED instead of filling with zeros,
+// and they are transparently zero-filled by the kernel on the next access,
+// but they stay committed, so subsequent allocations don't need to commit them again.
+//
+// Clear invocation also changes the arena.VirtualAllocator.arenaMask
+// so it can prevent some "use after free" arena.VirtualAllocator.ToRef calls with arena.Ptr allocated before Clear,
+// but it can't catch usages of already converted values.
+//
+// Clear has no effect on the closed allocator.
+func (a *VirtualAllocator) Clear() {
+	if a.closed {
+		return
+	}
+	usedBytes := int(a.offset - a.startPtr)
+	if usedBytes > 0 {
+		bytesToClear := a.reserved[:usedBytes]
+		if usedBytes <= int(minInternalBufferSize) || releaseRawBufferPages(bytesToClear) != nil {
+			clearBytes(bytesToClear)
+		}
+	}
+	a.offset = a.startPtr
+	a.arenaMask = (a.arenaMask + 1) | 1
+	a.check = a.check.next()
+}
+
+// Close returns the whole reserved range to the OS.
+//
+// Any subsequent call to Alloc, AllocUnaligned, Realloc, CurrentOffset or ToRef
+// will panic with arena.AllocatorClosedError, and all values allocated before Close
+// become invalid, so any usage of them leads to the segmentation fault.
+// Close is idempotent, and Clear has no effect on the closed allocator.
+func (a *VirtualAllocator) Close() {
+	if a.closed {
+		return
+	}
+	if a.reserved != nil {
+		unmapErr := unmapRawBuffer(a.reserved)
+		if unmapErr != nil {
+			panic(unmapErr)
+		}
+	}
+	*a = VirtualAllocator{closed: true}
+}
+
+// Stats provides a snapshot of essential allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+//
+// AllocatedBytes of arena.VirtualAllocator is the count of committed bytes,
+// and CountOfOnHeapAllocations is always zero, since its memory is allocated outside of the Go heap.
+func (a *VirtualAllocator) Stats() Stats {
+	return Stats{
+		UsedBytes:      int(a.offset - a.startPtr),
+		AllocatedBytes: int(a.committedPtr - a.startPtr),
+	}
+}
+
+// Metrics provides a snapshot of current allocation statistics,
+// that can be used by end-users or other allocators for introspection.
+func (a *VirtualAllocator) Metrics() Metrics {
+	return Metrics{
+		Stats:          a.Stats(),
+		AvailableBytes: int(a.committedPtr - a.offset),
+		MaxCapacity:    int(a.endPtr - a.startPtr),
+	}
+}
+
+// String provides a string snapshot of the current allocation offset.
+func (a *VirtualAllocator) String() string {
+	if a.closed {
+		return "virtualarena{closed}"
+	}
+	a.init()
+	return fmt.Sprintf("virtualarena{mask: %v offset: %v}", a.arenaMask, a.CurrentOffset())
+}
+
+// commit makes pages of the reserved range accessible, so at least requiredAvailableSize bytes
+// can be allocated from the current offset.
+// Committed part grows at least twice to amortize the cost of system calls.
+func (a *VirtualAllocator) commit(requiredAvailableSize uintptr) error {
+	if requiredAvailableSize > a.endPtr-a.offset {
+		return AllocationLimitError
+	}
+	committedBytes := a.committedPtr - a.startPtr
+	targetBytes := a.offset - a.startPtr + requiredAvailableSize
+	if targetBytes < 2*committedBytes {
+		targetBytes = 2 * committedBytes
+	}
+	targetBytes += calculatePadding(targetBytes, minInternalBufferSize)
+	if targetBytes > a.endPtr-a.startPtr {
+		targetBytes = a.endPtr - a.startPtr
+	}
+	commitErr := commitAddressSpace(a.reserved[committedBytes:targetBytes])
+	if commitErr != nil {
+		return commitErr
+	}
+	a.committedPtr = a.startPtr + targetBytes
+	return nil
+}
+
+func (a *VirtualAllocator) init() {
+	if a.arenaMask == 0 {
+		a.panicIfClosed()
+		a.arenaMask = uint16(rand.Uint32()) | 1
+		a.check = newPtrCheck()
+	}
+}
+
+func (a *VirtualAllocator) panicIfClosed() {
+	if a.closed {
+		panic(AllocatorClosedError)
+	}
+}
@@ -0,0 +1,169 @@
+package arena
+
+import (
+	"sync"
+)
+
+// BackgroundZeroer is a worker that zeroes buffers of arena.DynamicAllocator in the background,
+// so Clear of the allocator doesn't pay for zeroing of large buffers and only swaps in clean ones.
+// Dirty buffers are returned to the free-list of their allocator only after they are zeroed,
+// so they can't be reused before that.
+//
+// BackgroundZeroer is bounded by maxPendingBytes, so if the worker can't keep up with allocators,
+// buffers that don't fit into this limit are zeroed synchronously by Clear, as if there is no background zeroing.
+// One BackgroundZeroer can be shared by many allocators and is safe for concurrent use.
+//
+// Please call BackgroundZeroer.Close when it isn't needed anymore, to stop the worker goroutine.
+type BackgroundZeroer struct {
+	mu              sync.Mutex
+	queue           []zeroingJob
+	pendingBytes    int
+	maxPendingBytes int
+	closed          bool
+
+	wake    chan struct{}
+	stopped chan struct{}
+}
+
+type zeroingJob struct {
+	arena  clearArena
+	target *zeroedArenas
+}
+
+// zeroedArenas is the per-allocator queue of dirty buffers handed to the arena.BackgroundZeroer
+// and clean buffers that are ready to be moved to the free-list of the allocator.
+// Once the allocator is closed, clean buffers are forwarded to its arena.RawAllocatorPool instead.
+type zeroedArenas struct {
+	mu           sync.Mutex
+	clean        []clearArena
+	pendingBytes int
+	pool         *RawAllocatorPool
+}
+
+// NewBackgroundZeroer creates an instance of arena.BackgroundZeroer and starts its worker goroutine.
+// maxPendingBytes is the upper limit for the count of bytes waiting for zeroing,
+// if it is 0 the count isn't limited.
+func NewBackgroundZeroer(maxPendingBytes int) *BackgroundZeroer {
+	result := &BackgroundZeroer{
+		maxPendingBytes: maxPendingBytes,
+		wake:            make(chan struct{}, 1),
+		stopped:         make(chan struct{}),
+	}
+	go result.run()
+	return result
+}
+
+// PendingBytes returns the count of bytes currently waiting for zeroing.
+func (z *BackgroundZeroer) PendingBytes() int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.pendingBytes
+}
+
+// Close zeroes all pending buffers, returns them to their allocators, and stops the worker goroutine.
+// Subsequent Clear calls of allocators that use this BackgroundZeroer zero their buffers synchronously.
+// Close is idempotent.
+func (z *BackgroundZeroer) Close() {
+	z.mu.Lock()
+	if z.closed {
+		z.mu.Unlock()
+		<-z.stopped
+		return
+	}
+	z.closed = true
+	close(z.wake)
+	z.mu.Unlock()
+	<-z.stopped
+}
+
+// submit hands the dirty arena to the worker and reports false if the arena should be zeroed by the caller.
+func (z *BackgroundZeroer) submit(ar clearArena, target *zeroedArenas) bool {
+	size := ar.len()
+	z.mu.Lock()
+	if z.closed || (z.maxPendingBytes > 0 && z.pendingBytes+size > z.maxPendingBytes) {
+		z.mu.Unlock()
+		return false
+	}
+	// pending bytes of the target are updated before the worker can pick up the job
+	target.mu.Lock()
+	target.pendingBytes += size
+	target.mu.Unlock()
+	z.queue = append(z.queue, zeroingJob{arena: ar, target: target})
+	z.pendingBytes += size
+	select {
+	case z.wake <- struct{}{}:
+	default:
+	}
+	z.mu.Unlock()
+	return true
+}
+
+func (z *BackgroundZeroer) run() {
+	defer close(z.stopped)
+	for range z.wake {
+		z.zeroPendingArenas()
+	}
+	z.zeroPendingArenas()
+}
+
+func (z *BackgroundZeroer) zeroPendingArenas() {
+	for {
+		z.mu.Lock()
+		if len(z.queue) == 0 {
+			z.queue = nil
+			z.mu.Unlock()
+			return
+		}
+		job := z.queue[0]
+		z.queue[0] = zeroingJob{}
+		z.queue = z.queue[1:]
+		z.mu.Unlock()
+
+		job.arena.Clear()
+		job.target.put(job.arena)
+
+		z.mu.Lock()
+		z.pendingBytes -= job.arena.len()
+		z.mu.Unlock()
+	}
+}
+
+func (q *zeroedArenas) put(ar clearArena) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pendingBytes -= ar.len()
+	if q.pool != nil {
+		q.pool.put(ar.RawAllocator)
+		return
+	}
+	q.clean = append(q.clean, ar)
+}
+
+// forwardTo moves all clean arenas to the pool,
+// so arenas that are still pending go to the pool as soon as they are zeroed.
+func (q *zeroedArenas) forwardTo(pool *RawAllocatorPool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, ar := range q.clean {
+		pool.put(ar.RawAllocator)
+	}
+	q.clean = nil
+	q.pool = pool
+}
+
+// take moves all clean arenas to the free-list.
+func (q *zeroedArenas) take(freeList *minHeapOfClearArenas) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, ar := range q.clean {
+		freeList.Push(ar.RawAllocator, ar.clearCycle)
+		q.clean[i] = clearArena{}
+	}
+	q.clean = q.clean[:0]
+}
+
+func (q *zeroedArenas) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pendingBytes
+}